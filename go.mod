@@ -11,6 +11,7 @@ require (
 	github.com/stretchr/testify v1.8.4
 	google.golang.org/grpc v1.59.0
 	k8s.io/api v0.26.11
+	k8s.io/apimachinery v0.26.11
 	sigs.k8s.io/kustomize/kyaml v0.13.9
 )
 
@@ -175,7 +176,6 @@ require (
 	gopkg.in/yaml.v2 v2.4.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 	k8s.io/apiextensions-apiserver v0.26.10 // indirect
-	k8s.io/apimachinery v0.26.11 // indirect
 	k8s.io/apiserver v0.26.11 // indirect
 	k8s.io/cli-runtime v0.26.11 // indirect
 	k8s.io/client-go v0.26.11 // indirect
@@ -2,6 +2,9 @@ package plugin
 
 import (
 	"context"
+	"sync"
+	"time"
+
 	"github.com/hashicorp/go-hclog"
 	"github.com/hashicorp/vault/sdk/framework"
 	"github.com/hashicorp/vault/sdk/logical"
@@ -10,7 +13,18 @@ import (
 // backend is the backend for the argo cd tokens plugin
 type backend struct {
 	*framework.Backend
-	logger hclog.Logger
+	logger         hclog.Logger
+	rotateRootLock sync.Mutex
+	// gcLock guards the last runs of the garbage collector and of the reconciliation
+	gcLock         sync.Mutex
+	lastSweeps     map[string]time.Time
+	lastReconciles map[string]time.Time
+	clients        *clientCache
+	// staticRolesLock serializes the rotations of the static roles with their updates
+	staticRolesLock sync.Mutex
+	// accountChecksLock guards the cached account preflights
+	accountChecksLock sync.Mutex
+	accountChecks     map[string]accountCheck
 }
 
 // Factory is the factory that produces the backend.
@@ -24,19 +38,48 @@ func Factory(ctx context.Context, c *logical.BackendConfig) (logical.Backend, er
 
 // getBackend returns a configured backend
 func getBackend(conf *logical.BackendConfig) *backend {
-	backend := &backend{logger: conf.Logger}
+	backend := &backend{
+		logger:         conf.Logger,
+		lastSweeps:     map[string]time.Time{},
+		lastReconciles: map[string]time.Time{},
+		clients:        newClientCache(conf.Logger, mountTokenIdPrefix(conf.BackendUUID)),
+		accountChecks:  map[string]accountCheck{},
+	}
 	backend.Backend = &framework.Backend{
 		BackendType: logical.TypeLogical,
+		// the paths are matched in order, the revoke paths go first as <instance>/account/<name> also matches revoke/account/<name>
 		Paths: framework.PathAppend(
+			pathRevoke(backend),
 			pathProjectToken(backend),
+			pathApplicationToken(backend),
 			pathAccountToken(backend),
+			pathRotateRoot(backend),
 			pathConfig(backend),
+			pathRoles(backend),
+			pathCreds(backend),
+			pathStaticRoles(backend),
+			pathTidy(backend),
+			pathRevocations(backend),
+			pathTokens(backend),
+			pathReconcile(backend),
+			pathIntrospect(backend),
+			pathDiscovery(backend),
 		),
 		Secrets: []*framework.Secret{
 			secretProjectToken(backend),
 			secretAccountToken(backend),
 		},
-		Help: trimHelp(helpBackend),
+		PathsSpecial: &logical.Paths{
+			SealWrapStorage: []string{staticCredsStoragePrefix, profileStoragePrefix},
+		},
+		Help:         trimHelp(helpBackend),
+		PeriodicFunc: backend.periodicFunc,
+		Clean:        backend.clean,
 	}
 	return backend
 }
+
+// clean closes the argo cd connections when the backend is unmounted or reloaded
+func (b *backend) clean(_ context.Context) {
+	b.clients.clear()
+}
@@ -13,8 +13,14 @@ func TestCreateBackend(t *testing.T) {
 }
 
 func getTestBackend(t *testing.T) (*backend, logical.Storage) {
+	return getTestMountBackend(t, "", &logical.InmemStorage{})
+}
+
+// getTestMountBackend returns a backend of the mount with the given uuid, the mounts sharing an argo cd instance are given their own storage
+func getTestMountBackend(t *testing.T, backendUUID string, storage logical.Storage) (*backend, logical.Storage) {
 	config := logical.TestBackendConfig()
-	config.StorageView = &logical.InmemStorage{}
+	config.StorageView = storage
+	config.BackendUUID = backendUUID
 	b, err := Factory(context.Background(), config)
 	require.NoError(t, err)
 	return b.(*backend), config.StorageView
@@ -0,0 +1,136 @@
+package plugin
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/go-hclog"
+)
+
+const (
+	accountClientKind     = "account"
+	projectClientKind     = "project"
+	applicationClientKind = "application"
+)
+
+// clientCache holds the argo cd api clients by connection config, so the grpc-web connections are reused across requests.
+// A client is only closed once it is released by all the requests using it, so invalidating the cache does not break in-flight requests
+type clientCache struct {
+	lock    sync.Mutex
+	logger  hclog.Logger
+	entries map[string]*cachedClient
+	// tokenIdPrefix is the prefix of the ids of the tokens created by the clients of the mount
+	tokenIdPrefix string
+}
+
+type cachedClient struct {
+	closer io.Closer
+	client interface{}
+	refs   int
+	stale  bool
+}
+
+// clientRelease releases the cached client when the request is done with it
+type clientRelease struct {
+	cache *clientCache
+	entry *cachedClient
+	once  sync.Once
+}
+
+func newClientCache(logger hclog.Logger, tokenIdPrefix string) *clientCache {
+	return &clientCache{
+		logger:        logger,
+		entries:       map[string]*cachedClient{},
+		tokenIdPrefix: tokenIdPrefix,
+	}
+}
+
+// idPrefix returns the prefix of the ids of the tokens created by the clients, the prefix of the plugin without cache
+func (cache *clientCache) idPrefix() string {
+	if cache == nil {
+		return tokenIdPrefix
+	}
+
+	return cache.tokenIdPrefix
+}
+
+// cacheKey identifies the connection config, including the admin token, so a new token gets new clients
+func (c *configEntry) cacheKey() string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%t|%t|%s", c.ArgoCDUrl, c.Insecure, c.Plaintext, c.AdminToken)))
+	return hex.EncodeToString(hash[:])
+}
+
+func clientCacheKey(kind string, config *configEntry) string {
+	return kind + "/" + config.cacheKey()
+}
+
+// getCachedClient returns the cached client for the key, dialing a new one if needed.
+// The returned closer releases the client, it must be closed once the request is done with it
+func getCachedClient[C any](cache *clientCache, key string, dial func() (io.Closer, C, error)) (C, io.Closer, error) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	entry, ok := cache.entries[key]
+	if !ok {
+		closer, client, err := dial()
+		if err != nil {
+			return client, nil, err
+		}
+		entry = &cachedClient{closer: closer, client: client}
+		cache.entries[key] = entry
+	}
+
+	entry.refs++
+	return entry.client.(C), &clientRelease{cache: cache, entry: entry}, nil
+}
+
+func (r *clientRelease) Close() error {
+	var err error
+	r.once.Do(func() {
+		r.cache.lock.Lock()
+		defer r.cache.lock.Unlock()
+
+		r.entry.refs--
+		if r.entry.stale && r.entry.refs == 0 {
+			err = r.entry.closer.Close()
+		}
+	})
+	return err
+}
+
+// evict removes the entry from the cache and closes it unless it is still in use. The lock must be held
+func (cache *clientCache) evict(key string, entry *cachedClient) {
+	delete(cache.entries, key)
+	entry.stale = true
+	if entry.refs == 0 {
+		if err := entry.closer.Close(); err != nil {
+			cache.logger.Error(fmt.Sprintf("error while closing the argo cd client: %s", err))
+		}
+	}
+}
+
+// invalidate closes the clients of the connection config
+func (cache *clientCache) invalidate(config *configEntry) {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for _, kind := range []string{accountClientKind, projectClientKind, applicationClientKind} {
+		key := clientCacheKey(kind, config)
+		if entry, ok := cache.entries[key]; ok {
+			cache.evict(key, entry)
+		}
+	}
+}
+
+// clear closes all the clients
+func (cache *clientCache) clear() {
+	cache.lock.Lock()
+	defer cache.lock.Unlock()
+
+	for key, entry := range cache.entries {
+		cache.evict(key, entry)
+	}
+}
@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/go-hclog"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"io"
+	"sync"
+	"testing"
+)
+
+type countingCloser struct {
+	closed int
+}
+
+func (c *countingCloser) Close() error {
+	c.closed++
+	return nil
+}
+
+func getTestDial(dials *int, closer *countingCloser) func() (io.Closer, string, error) {
+	return func() (io.Closer, string, error) {
+		*dials++
+		return closer, fmt.Sprintf("client-%d", *dials), nil
+	}
+}
+
+func TestClientCache(t *testing.T) {
+	config := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "some-dummy-token"}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "clients are reused",
+			fn: func(t *testing.T) {
+				cache := newClientCache(hclog.NewNullLogger(), tokenIdPrefix)
+				dials := 0
+				closer := &countingCloser{}
+				key := clientCacheKey(accountClientKind, &config)
+
+				c1, release1, err := getCachedClient(cache, key, getTestDial(&dials, closer))
+				require.NoError(t, err)
+				c2, release2, err := getCachedClient(cache, key, getTestDial(&dials, closer))
+				require.NoError(t, err)
+
+				a := assert.New(t)
+				a.EqualValues(1, dials)
+				a.EqualValues(c1, c2)
+				require.NoError(t, release1.Close())
+				require.NoError(t, release2.Close())
+				a.Zero(closer.closed)
+			},
+		},
+		{
+			name: "clients in use are closed once released",
+			fn: func(t *testing.T) {
+				cache := newClientCache(hclog.NewNullLogger(), tokenIdPrefix)
+				dials := 0
+				closer := &countingCloser{}
+				key := clientCacheKey(projectClientKind, &config)
+
+				_, release, err := getCachedClient(cache, key, getTestDial(&dials, closer))
+				require.NoError(t, err)
+
+				cache.invalidate(&config)
+				a := assert.New(t)
+				a.Zero(closer.closed)
+				a.Empty(cache.entries)
+
+				require.NoError(t, release.Close())
+				require.NoError(t, release.Close())
+				a.EqualValues(1, closer.closed)
+
+				_, _, err = getCachedClient(cache, key, getTestDial(&dials, closer))
+				require.NoError(t, err)
+				a.EqualValues(2, dials)
+			},
+		},
+		{
+			name: "the admin token is part of the key",
+			fn: func(t *testing.T) {
+				rotated := config
+				rotated.AdminToken = "some-other-token"
+				assert.NotEqual(t, clientCacheKey(accountClientKind, &config), clientCacheKey(accountClientKind, &rotated))
+			},
+		},
+		{
+			name: "clear",
+			fn: func(t *testing.T) {
+				cache := newClientCache(hclog.NewNullLogger(), tokenIdPrefix)
+				dials := 0
+				closer := &countingCloser{}
+
+				_, release, err := getCachedClient(cache, clientCacheKey(accountClientKind, &config), getTestDial(&dials, closer))
+				require.NoError(t, err)
+				require.NoError(t, release.Close())
+				_, _, err = getCachedClient(cache, clientCacheKey(projectClientKind, &config), getTestDial(&dials, closer))
+				require.NoError(t, err)
+
+				cache.clear()
+				a := assert.New(t)
+				a.Empty(cache.entries)
+				a.EqualValues(1, closer.closed)
+			},
+		},
+		{
+			name: "concurrent use",
+			fn: func(t *testing.T) {
+				cache := newClientCache(hclog.NewNullLogger(), tokenIdPrefix)
+				dials := 0
+				closer := &countingCloser{}
+				key := clientCacheKey(accountClientKind, &config)
+
+				var wg sync.WaitGroup
+				for i := 0; i < 50; i++ {
+					wg.Add(1)
+					go func() {
+						defer wg.Done()
+						_, release, err := getCachedClient(cache, key, getTestDial(&dials, closer))
+						if err == nil {
+							_ = release.Close()
+						}
+					}()
+				}
+				wg.Wait()
+				assert.EqualValues(t, 1, dials)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestConfigWriteInvalidatesClients(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "gc_interval": 0})
+	config := readConfigSuccess(t, r)
+
+	dials := 0
+	closer := &countingCloser{}
+	_, release, err := getCachedClient(b.clients, clientCacheKey(accountClientKind, &config), getTestDial(&dials, closer))
+	require.NoError(t, err)
+	require.NoError(t, release.Close())
+
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-other-token", "gc_interval": 0})
+	a := assert.New(t)
+	a.EqualValues(1, closer.closed)
+	a.Empty(b.clients.entries)
+
+	_, release, err = getCachedClient(b.clients, clientCacheKey(accountClientKind, &config), getTestDial(&dials, closer))
+	require.NoError(t, err)
+	b.Clean(context.Background())
+	a.Empty(b.clients.entries)
+	a.EqualValues(1, closer.closed)
+	require.NoError(t, release.Close())
+	a.EqualValues(2, closer.closed)
+}
@@ -4,40 +4,71 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient"
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/google/uuid"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 const (
-	totalRetries = 4
+	// tokenIdPrefix marks the ids of the tokens issued by the plugin
+	tokenIdPrefix = "vault-"
+	// adminTokenIdPrefix marks the ids of the admin tokens minted by the root rotation, which are not plugin token ids,
+	// so the other mounts sharing the account never collect, revoke or report them as plugin tokens
+	adminTokenIdPrefix = "admin-"
+	// mountTagLength is the length of the tag of the mount in the ids of its tokens
+	mountTagLength = 8
 )
 
-var retryWaitSeconds = []time.Duration{0, 3, 5, 10} // first value should remain 0
-
 type projectClientContext struct {
 	client        project.ProjectServiceClient
 	clientContext context.Context
 	closer        io.Closer
+	instance      string
+	serverAddr    string
+	fingerprint   string
+	retryPolicy   retryPolicy
+	tokenIdPrefix string
 }
 
 type accountClientContext struct {
 	client        account.AccountServiceClient
 	clientContext context.Context
 	closer        io.Closer
+	instance      string
+	serverAddr    string
+	fingerprint   string
+	retryPolicy   retryPolicy
+	tokenIdPrefix string
+}
+
+type applicationClientContext struct {
+	client        application.ApplicationServiceClient
+	clientContext context.Context
+	closer        io.Closer
 }
 
 type accountTokenMetadata struct {
 	Id          string        `json:"id" structs:"id" mapstructure:"id"`
+	Instance    string        `json:"instance" structs:"instance" mapstructure:"instance"`
+	ServerAddr  string        `json:"argo_cd_url" structs:"argo_cd_url" mapstructure:"argo_cd_url"`
+	Fingerprint string        `json:"config_fingerprint" structs:"config_fingerprint" mapstructure:"config_fingerprint"`
 	AccountName string        `json:"account_name" structs:"account_name" mapstructure:"account_name"`
 	TTL         time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
 }
 
 type projectTokenMetadata struct {
 	Id          string        `json:"id" structs:"id" mapstructure:"id"`
+	Instance    string        `json:"instance" structs:"instance" mapstructure:"instance"`
+	ServerAddr  string        `json:"argo_cd_url" structs:"argo_cd_url" mapstructure:"argo_cd_url"`
+	Fingerprint string        `json:"config_fingerprint" structs:"config_fingerprint" mapstructure:"config_fingerprint"`
 	ProjectName string        `json:"project_name" structs:"project_name" mapstructure:"project_name"`
 	RoleName    string        `json:"role_name" structs:"role_name" mapstructure:"role_name"`
 	TTL         time.Duration `json:"ttl" structs:"ttl" mapstructure:"ttl"`
@@ -53,6 +84,34 @@ type projectToken struct {
 	token    string
 }
 
+// mountTokenIdPrefix returns the prefix of the ids of the tokens issued by the mount: the prefix of the plugin and a tag of the mount,
+// so a mount tells its tokens from the tokens of the other mounts sharing the argo cd instance
+func mountTokenIdPrefix(backendUUID string) string {
+	tag := strings.ReplaceAll(backendUUID, "-", "")
+	if len(tag) < mountTagLength {
+		return tokenIdPrefix
+	}
+
+	return tokenIdPrefix + tag[:mountTagLength] + "-"
+}
+
+// newTokenId returns a new id for a token issued by the mount
+func newTokenId(prefix string) string {
+	return prefix + uuid.New().String()
+}
+
+// isPluginTokenId returns true if the token id has the format of the ids issued by the plugin
+func isPluginTokenId(id string) bool {
+	return strings.HasPrefix(id, tokenIdPrefix)
+}
+
+// isLegacyTokenId returns true if the token id has the format of the ids issued by the plugin before they were prefixed, a bare uuid.
+// Argo cd also gives such ids to the tokens created without id, e.g. by argocd account generate-token
+func isLegacyTokenId(id string) bool {
+	_, err := uuid.Parse(id)
+	return err == nil && len(id) == 36
+}
+
 func (c *configEntry) toClientOptions() *apiclient.ClientOptions {
 	clientOptions := apiclient.ClientOptions{
 		ServerAddr:   c.ArgoCDUrl,
@@ -66,59 +125,153 @@ func (c *configEntry) toClientOptions() *apiclient.ClientOptions {
 	return &clientOptions
 }
 
-func NewProjectClient(ctx context.Context, config *configEntry) (*projectClientContext, error) {
-	clientOptions := config.toClientOptions()
-
-	client, err := apiclient.NewClient(clientOptions)
+// dialProjectClient opens a new connection to argo cd for the project service
+func dialProjectClient(config *configEntry) (io.Closer, project.ProjectServiceClient, error) {
+	client, err := apiclient.NewClient(config.toClientOptions())
 	if err != nil {
-		return nil, fmt.Errorf("error while creating new apiClient: %s", err)
+		return nil, nil, fmt.Errorf("error while creating new apiClient: %s", err)
 	}
 
 	closer, projectClient, err := client.NewProjectClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while creating new projectClient: %s", err)
+	}
 
+	return closer, projectClient, nil
+}
+
+// dialAccountClient opens a new connection to argo cd for the account service
+func dialAccountClient(config *configEntry) (io.Closer, account.AccountServiceClient, error) {
+	client, err := apiclient.NewClient(config.toClientOptions())
 	if err != nil {
-		return nil, fmt.Errorf("error while creating new projectClient: %s", err)
+		return nil, nil, fmt.Errorf("error while creating new apiClient: %s", err)
+	}
+
+	closer, accountClient, err := client.NewAccountClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while creating new accountClient: %s", err)
+	}
+
+	return closer, accountClient, nil
+}
+
+// dialApplicationClient opens a new connection to argo cd for the application service
+func dialApplicationClient(config *configEntry) (io.Closer, application.ApplicationServiceClient, error) {
+	client, err := apiclient.NewClient(config.toClientOptions())
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while creating new apiClient: %s", err)
+	}
+
+	closer, applicationClient, err := client.NewApplicationClient()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error while creating new applicationClient: %s", err)
+	}
+
+	return closer, applicationClient, nil
+}
+
+// NewProjectClient returns a project client for the config, reusing the connection from the cache when one is given.
+// The closer of the client context must be closed once the request is done with it
+func NewProjectClient(ctx context.Context, cache *clientCache, config *configEntry) (*projectClientContext, error) {
+	dial := func() (io.Closer, project.ProjectServiceClient, error) { return dialProjectClient(config) }
+
+	var closer io.Closer
+	var projectClient project.ProjectServiceClient
+	var err error
+	if cache == nil {
+		closer, projectClient, err = dial()
+	} else {
+		projectClient, closer, err = getCachedClient(cache, clientCacheKey(projectClientKind, config), dial)
+	}
+	if err != nil {
+		return nil, err
 	}
 
 	clientContext := projectClientContext{
 		client:        projectClient,
 		clientContext: ctx,
 		closer:        closer,
+		instance:      config.Instance,
+		serverAddr:    config.ArgoCDUrl,
+		fingerprint:   config.fingerprint(),
+		retryPolicy:   config.retryPolicy(),
+		tokenIdPrefix: cache.idPrefix(),
 	}
 
 	return &clientContext, nil
 }
 
-func NewAccountClient(ctx context.Context, config *configEntry) (*accountClientContext, error) {
-	clientOptions := config.toClientOptions()
+// NewAccountClient returns an account client for the config, reusing the connection from the cache when one is given.
+// The closer of the client context must be closed once the request is done with it
+func NewAccountClient(ctx context.Context, cache *clientCache, config *configEntry) (*accountClientContext, error) {
+	dial := func() (io.Closer, account.AccountServiceClient, error) { return dialAccountClient(config) }
 
-	client, err := apiclient.NewClient(clientOptions)
-	if err != nil {
-		return nil, fmt.Errorf("error while creating new apiClient: %s", err)
+	var closer io.Closer
+	var accountClient account.AccountServiceClient
+	var err error
+	if cache == nil {
+		closer, accountClient, err = dial()
+	} else {
+		accountClient, closer, err = getCachedClient(cache, clientCacheKey(accountClientKind, config), dial)
 	}
-
-	closer, accountClient, err := client.NewAccountClient()
 	if err != nil {
-		return nil, fmt.Errorf("error while creating new accountClient: %s", err)
+		return nil, err
 	}
 
 	clientContext := accountClientContext{
 		client:        accountClient,
 		clientContext: ctx,
 		closer:        closer,
+		instance:      config.Instance,
+		serverAddr:    config.ArgoCDUrl,
+		fingerprint:   config.fingerprint(),
+		retryPolicy:   config.retryPolicy(),
+		tokenIdPrefix: cache.idPrefix(),
+	}
+
+	return &clientContext, nil
+}
+
+// NewApplicationClient returns an application client for the config, reusing the connection from the cache when one is given.
+// The closer of the client context must be closed once the request is done with it
+func NewApplicationClient(ctx context.Context, cache *clientCache, config *configEntry) (*applicationClientContext, error) {
+	dial := func() (io.Closer, application.ApplicationServiceClient, error) { return dialApplicationClient(config) }
+
+	var closer io.Closer
+	var applicationClient application.ApplicationServiceClient
+	var err error
+	if cache == nil {
+		closer, applicationClient, err = dial()
+	} else {
+		applicationClient, closer, err = getCachedClient(cache, clientCacheKey(applicationClientKind, config), dial)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	clientContext := applicationClientContext{
+		client:        applicationClient,
+		clientContext: ctx,
+		closer:        closer,
 	}
 
 	return &clientContext, nil
 }
 
 func (clientCtx *projectClientContext) GenerateToken(projectName string, projectRoleName string, expiresIn time.Duration) (*projectToken, error) {
-	retries := 0
 	var response *project.ProjectTokenResponse
-	var err error
 
-	for retries < totalRetries {
-		id := uuid.New().String()
-		time.Sleep(retryWaitSeconds[retries] * time.Second)
+	// the same id is used for all the attempts, so a token created by an attempt whose response was lost can be found
+	id := newTokenId(clientCtx.tokenIdPrefix)
+	attempts := 0
+	err := clientCtx.retryPolicy.do(clientCtx.clientContext, func() error {
+		if attempts > 0 {
+			if err := clientCtx.deleteTokenIfExists(id, projectName, projectRoleName); err != nil {
+				return err
+			}
+		}
+		attempts++
+
 		createTokenRequest := &project.ProjectTokenCreateRequest{
 			Project:   projectName,
 			Role:      projectRoleName,
@@ -127,35 +280,58 @@ func (clientCtx *projectClientContext) GenerateToken(projectName string, project
 		}
 
 		projectClient := clientCtx.client
+		var err error
 		response, err = projectClient.CreateToken(clientCtx.clientContext, createTokenRequest)
-
-		if err == nil {
-			token := projectToken{
-				metadata: projectTokenMetadata{
-					Id:          id,
-					ProjectName: projectName,
-					RoleName:    projectRoleName,
-					TTL:         expiresIn,
-				},
-				token: response.Token,
+		return err
+	})
+	if err != nil {
+		if mayHaveSucceeded(err) {
+			// the last attempt may have created the token although it failed
+			if cleanupErr := clientCtx.cleanupToken(id, projectName, projectRoleName); cleanupErr != nil {
+				return nil, fmt.Errorf("Error in Generate token for projectClient: %w, the token(%s) may be left in argo cd: %s", err, id, cleanupErr)
 			}
-		
-			return &token, nil
 		}
-		retries++
+		return nil, fmt.Errorf("Error in Generate token for projectClient: %w", err)
 	}
-	return nil, fmt.Errorf("Error in Generate token for projectClient: %s", err)
 
+	token := projectToken{
+		metadata: projectTokenMetadata{
+			Id:          id,
+			Instance:    clientCtx.instance,
+			ServerAddr:  clientCtx.serverAddr,
+			Fingerprint: clientCtx.fingerprint,
+			ProjectName: projectName,
+			RoleName:    projectRoleName,
+			TTL:         expiresIn,
+		},
+		token: response.Token,
+	}
+
+	return &token, nil
 }
 
 func (clientCtx *accountClientContext) GenerateToken(accountName string, expiresIn time.Duration) (*accountToken, error) {
-	retries := 0
+	return clientCtx.generateToken(newTokenId(clientCtx.tokenIdPrefix), accountName, expiresIn)
+}
+
+// GenerateAdminToken creates a new admin token for the account, its id is not a plugin token id
+func (clientCtx *accountClientContext) GenerateAdminToken(accountName string, expiresIn time.Duration) (*accountToken, error) {
+	return clientCtx.generateToken(newTokenId(adminTokenIdPrefix), accountName, expiresIn)
+}
+
+func (clientCtx *accountClientContext) generateToken(id string, accountName string, expiresIn time.Duration) (*accountToken, error) {
 	var response *account.CreateTokenResponse
-	var err error
 
-	for retries < totalRetries {
-		id := uuid.New().String()
-		time.Sleep(retryWaitSeconds[retries] * time.Second)
+	// the same id is used for all the attempts, so a token created by an attempt whose response was lost can be found
+	attempts := 0
+	err := clientCtx.retryPolicy.do(clientCtx.clientContext, func() error {
+		if attempts > 0 {
+			if err := clientCtx.deleteTokenIfExists(id, accountName); err != nil {
+				return err
+			}
+		}
+		attempts++
+
 		createTokenRequest := &account.CreateTokenRequest{
 			Name:      accountName,
 			ExpiresIn: toDurationSeconds(expiresIn),
@@ -163,23 +339,38 @@ func (clientCtx *accountClientContext) GenerateToken(accountName string, expires
 		}
 
 		accountClient := clientCtx.client
+		var err error
 		response, err = accountClient.CreateToken(clientCtx.clientContext, createTokenRequest)
-		if err == nil {
-			token := accountToken{
-				metadata: accountTokenMetadata{
-					Id:          id,
-					AccountName: accountName,
-					TTL:         expiresIn,
-				},
-				token: response.Token,
+		return err
+	})
+	if err != nil {
+		if mayHaveSucceeded(err) {
+			// the last attempt may have created the token although it failed
+			if cleanupErr := clientCtx.cleanupToken(id, accountName); cleanupErr != nil {
+				return nil, fmt.Errorf("Error in Generate token for accountClient: %w, the token(%s) may be left in argo cd: %s", err, id, cleanupErr)
 			}
-		
-			return &token, nil
 		}
-		retries++
+		return nil, fmt.Errorf("Error in Generate token for accountClient: %w", err)
 	}
-	return nil, fmt.Errorf("Error in Generate token for accountClient: %s", err)
 
+	token := accountToken{
+		metadata: accountTokenMetadata{
+			Id:          id,
+			Instance:    clientCtx.instance,
+			ServerAddr:  clientCtx.serverAddr,
+			Fingerprint: clientCtx.fingerprint,
+			AccountName: accountName,
+			TTL:         expiresIn,
+		},
+		token: response.Token,
+	}
+
+	return &token, nil
+}
+
+// isNotFound returns true when argo cd reports a missing token, account, project or role
+func isNotFound(err error) bool {
+	return status.Code(err) == codes.NotFound
 }
 
 func (clientCtx *accountClientContext) DeleteToken(tokenId string, accountName string) error {
@@ -192,24 +383,230 @@ func (clientCtx *accountClientContext) DeleteToken(tokenId string, accountName s
 	_, err := accountClient.DeleteToken(clientCtx.clientContext, deleteTokenRequest)
 
 	if err != nil {
-		return fmt.Errorf("error in delete token for accountClient: %s", err)
+		return fmt.Errorf("error in delete token for accountClient: %w", err)
 	}
 
 	return nil
 }
 
 func (clientCtx *projectClientContext) DeleteToken(tokenId string, projectName string, roleName string) error {
+	return clientCtx.DeleteTokenWithIat(tokenId, 0, projectName, roleName)
+}
+
+// DeleteTokenWithIat deletes a token of the project role, tokens created without id are deleted by their issued at time
+func (clientCtx *projectClientContext) DeleteTokenWithIat(tokenId string, iat int64, projectName string, roleName string) error {
 	deleteTokenRequest := &project.ProjectTokenDeleteRequest{
 		Project: projectName,
 		Role:    roleName,
 		Id:      tokenId,
+		Iat:     iat,
 	}
 
 	projectClient := clientCtx.client
 	_, err := projectClient.DeleteToken(clientCtx.clientContext, deleteTokenRequest)
 
 	if err != nil {
-		return fmt.Errorf("error in delete token for projectClient: %s", err)
+		return fmt.Errorf("error in delete token for projectClient: %w", err)
+	}
+
+	return nil
+}
+
+func (clientCtx *accountClientContext) ListAccounts() ([]*account.Account, error) {
+	accountClient := clientCtx.client
+	accounts, err := accountClient.ListAccounts(clientCtx.clientContext, &account.ListAccountRequest{})
+
+	if err != nil {
+		return nil, fmt.Errorf("error in list accounts for accountClient: %w", err)
+	}
+
+	return accounts.Items, nil
+}
+
+func (clientCtx *accountClientContext) ListAccountNames() ([]string, error) {
+	accounts, err := clientCtx.ListAccounts()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(accounts))
+	for _, item := range accounts {
+		names = append(names, item.Name)
+	}
+
+	return names, nil
+}
+
+func (clientCtx *accountClientContext) GetAccount(accountName string) (*account.Account, error) {
+	accountClient := clientCtx.client
+	response, err := accountClient.GetAccount(clientCtx.clientContext, &account.GetAccountRequest{Name: accountName})
+
+	if err != nil {
+		return nil, fmt.Errorf("error in get account for accountClient: %w", err)
+	}
+
+	return response, nil
+}
+
+func (clientCtx *projectClientContext) ListProjects() ([]v1alpha1.AppProject, error) {
+	projectClient := clientCtx.client
+	projects, err := projectClient.List(clientCtx.clientContext, &project.ProjectQuery{})
+
+	if err != nil {
+		return nil, fmt.Errorf("error in list projects for projectClient: %w", err)
+	}
+
+	return projects.Items, nil
+}
+
+func (clientCtx *projectClientContext) ListProjectNames() ([]string, error) {
+	projects, err := clientCtx.ListProjects()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(projects))
+	for _, item := range projects {
+		names = append(names, item.Name)
+	}
+
+	return names, nil
+}
+
+func (clientCtx *projectClientContext) GetProject(projectName string) (*v1alpha1.AppProject, error) {
+	projectClient := clientCtx.client
+	response, err := projectClient.Get(clientCtx.clientContext, &project.ProjectQuery{Name: projectName})
+
+	if err != nil {
+		return nil, fmt.Errorf("error in get project for projectClient: %w", err)
+	}
+
+	return response, nil
+}
+
+func (clientCtx *applicationClientContext) GetApplication(applicationName string) (*v1alpha1.Application, error) {
+	applicationClient := clientCtx.client
+	response, err := applicationClient.Get(clientCtx.clientContext, &application.ApplicationQuery{Name: &applicationName})
+
+	if err != nil {
+		return nil, fmt.Errorf("error in get application for applicationClient: %w", err)
+	}
+
+	return response, nil
+}
+
+// CreateRole adds the role to the project, the update is retried when the project was modified concurrently
+func (clientCtx *projectClientContext) CreateRole(projectName string, role v1alpha1.ProjectRole) error {
+	err := clientCtx.retryPolicy.do(clientCtx.clientContext, func() error {
+		proj, err := clientCtx.GetProject(projectName)
+		if err != nil {
+			return err
+		}
+
+		for _, existing := range proj.Spec.Roles {
+			// a previous attempt created the role although its response was lost
+			if existing.Name == role.Name {
+				return nil
+			}
+		}
+		proj.Spec.Roles = append(proj.Spec.Roles, role)
+
+		_, err = clientCtx.client.Update(clientCtx.clientContext, &project.ProjectUpdateRequest{Project: proj})
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("error in create role for projectClient: %w", err)
+	}
+
+	return nil
+}
+
+// DeleteRole removes the role and its tokens from the project, the update is retried when the project was modified concurrently.
+// A role that does not exist is not an error
+func (clientCtx *projectClientContext) DeleteRole(projectName string, roleName string) error {
+	err := clientCtx.retryPolicy.do(clientCtx.clientContext, func() error {
+		proj, err := clientCtx.GetProject(projectName)
+		if err != nil {
+			return err
+		}
+
+		roles := make([]v1alpha1.ProjectRole, 0, len(proj.Spec.Roles))
+		for _, role := range proj.Spec.Roles {
+			if role.Name != roleName {
+				roles = append(roles, role)
+			}
+		}
+		if len(roles) == len(proj.Spec.Roles) {
+			return nil
+		}
+		proj.Spec.Roles = roles
+
+		_, err = clientCtx.client.Update(clientCtx.clientContext, &project.ProjectUpdateRequest{Project: proj})
+		return err
+	})
+
+	if err != nil {
+		return fmt.Errorf("error in delete role for projectClient: %w", err)
+	}
+
+	return nil
+}
+
+// deleteTokenIfExists deletes the token if a previous attempt created it although it failed.
+// The token cannot be adopted as argo cd only returns the jwt when it is created
+func (clientCtx *accountClientContext) deleteTokenIfExists(tokenId string, accountName string) error {
+	acc, err := clientCtx.GetAccount(accountName)
+	if err != nil {
+		return err
+	}
+
+	for _, token := range acc.Tokens {
+		if token.Id == tokenId {
+			return clientCtx.DeleteToken(tokenId, accountName)
+		}
+	}
+
+	return nil
+}
+
+// cleanupToken deletes the token if the attempts created it although they failed, even when the request was cancelled
+func (clientCtx *accountClientContext) cleanupToken(tokenId string, accountName string) error {
+	ctx, cancel := cleanupContext(clientCtx.clientContext)
+	defer cancel()
+
+	cleanupCtx := *clientCtx
+	cleanupCtx.clientContext = ctx
+	return cleanupCtx.deleteTokenIfExists(tokenId, accountName)
+}
+
+// cleanupToken deletes the token if the attempts created it although they failed, even when the request was cancelled
+func (clientCtx *projectClientContext) cleanupToken(tokenId string, projectName string, roleName string) error {
+	ctx, cancel := cleanupContext(clientCtx.clientContext)
+	defer cancel()
+
+	cleanupCtx := *clientCtx
+	cleanupCtx.clientContext = ctx
+	return cleanupCtx.deleteTokenIfExists(tokenId, projectName, roleName)
+}
+
+// deleteTokenIfExists deletes the token if a previous attempt created it although it failed.
+// The token cannot be adopted as argo cd only returns the jwt when it is created
+func (clientCtx *projectClientContext) deleteTokenIfExists(tokenId string, projectName string, roleName string) error {
+	proj, err := clientCtx.GetProject(projectName)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range proj.Spec.Roles {
+		if role.Name != roleName {
+			continue
+		}
+		for _, token := range role.JWTTokens {
+			if token.ID == tokenId {
+				return clientCtx.DeleteToken(tokenId, projectName, roleName)
+			}
+		}
 	}
 
 	return nil
@@ -6,8 +6,16 @@ import (
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
 	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"k8s.io/api/core/v1"
+	"strings"
+	"sync"
+	"testing"
+	"time"
 )
 
 type testCloser struct{}
@@ -21,12 +29,33 @@ type testAccountClient struct {
 	deleteTokenResponse *account.EmptyResponse
 	createTokenError    error
 	DeleteTokenError    error
+	// createTokenLost simulates a token created by argo cd whose response was lost
+	createTokenLost     bool
+	createTokenRequests []*account.CreateTokenRequest
+	deleteTokenRequests []*account.DeleteTokenRequest
+	accounts            []*account.Account
+	getAccountError     error
+	// lock guards the recorded requests, as the bulk revocations delete tokens concurrently
+	lock sync.Mutex
 }
 
 func (client *testAccountClient) CreateToken(ctx context.Context, in *account.CreateTokenRequest, opts ...grpc.CallOption) (*account.CreateTokenResponse, error) {
+	client.createTokenRequests = append(client.createTokenRequests, in)
+	if client.createTokenLost {
+		for _, item := range client.accounts {
+			if item.Name == in.Name {
+				item.Tokens = append(item.Tokens, &account.Token{Id: in.Id})
+			}
+		}
+		client.createTokenLost = false
+		return nil, status.Error(codes.Unavailable, "response lost")
+	}
 	return client.createTokenResponse, client.createTokenError
 }
 func (client *testAccountClient) DeleteToken(ctx context.Context, in *account.DeleteTokenRequest, opts ...grpc.CallOption) (*account.EmptyResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.deleteTokenRequests = append(client.deleteTokenRequests, in)
 	return client.deleteTokenResponse, client.DeleteTokenError
 }
 func (client *testAccountClient) CanI(ctx context.Context, in *account.CanIRequest, opts ...grpc.CallOption) (*account.CanIResponse, error) {
@@ -36,10 +65,18 @@ func (client *testAccountClient) UpdatePassword(ctx context.Context, in *account
 	return nil, nil
 }
 func (client *testAccountClient) ListAccounts(ctx context.Context, in *account.ListAccountRequest, opts ...grpc.CallOption) (*account.AccountsList, error) {
-	return nil, nil
+	return &account.AccountsList{Items: client.accounts}, nil
 }
 func (client *testAccountClient) GetAccount(ctx context.Context, in *account.GetAccountRequest, opts ...grpc.CallOption) (*account.Account, error) {
-	return nil, nil
+	if client.getAccountError != nil {
+		return nil, client.getAccountError
+	}
+	for _, item := range client.accounts {
+		if item.Name == in.Name {
+			return item, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "account '%s' does not exist", in.Name)
 }
 
 func getTestAccountClientContext(accountClient *testAccountClient) *accountClientContext {
@@ -47,6 +84,7 @@ func getTestAccountClientContext(accountClient *testAccountClient) *accountClien
 		client:        accountClient,
 		clientContext: context.Background(),
 		closer:        testCloser{},
+		tokenIdPrefix: tokenIdPrefix,
 	}
 }
 
@@ -55,31 +93,73 @@ type testProjectClient struct {
 	deleteTokenResponse *project.EmptyResponse
 	createTokenError    error
 	DeleteTokenError    error
+	// createTokenLost simulates a token created by argo cd whose response was lost
+	createTokenLost     bool
+	createTokenRequests []*project.ProjectTokenCreateRequest
+	deleteTokenRequests []*project.ProjectTokenDeleteRequest
+	projects            []*v1alpha1.AppProject
+	updateRequests      []*project.ProjectUpdateRequest
+	updateError         error
+	// lock guards the recorded requests, as the bulk revocations delete tokens concurrently
+	lock sync.Mutex
 }
 
 func (client *testProjectClient) CreateToken(ctx context.Context, in *project.ProjectTokenCreateRequest, opts ...grpc.CallOption) (*project.ProjectTokenResponse, error) {
+	client.createTokenRequests = append(client.createTokenRequests, in)
+	if client.createTokenLost {
+		for _, item := range client.projects {
+			for i := range item.Spec.Roles {
+				if item.Name == in.Project && item.Spec.Roles[i].Name == in.Role {
+					item.Spec.Roles[i].JWTTokens = append(item.Spec.Roles[i].JWTTokens, v1alpha1.JWTToken{ID: in.Id})
+				}
+			}
+		}
+		client.createTokenLost = false
+		return nil, status.Error(codes.Unavailable, "response lost")
+	}
 	return client.createTokenResponse, client.createTokenError
 }
 func (client *testProjectClient) DeleteToken(ctx context.Context, in *project.ProjectTokenDeleteRequest, opts ...grpc.CallOption) (*project.EmptyResponse, error) {
+	client.lock.Lock()
+	defer client.lock.Unlock()
+	client.deleteTokenRequests = append(client.deleteTokenRequests, in)
 	return client.deleteTokenResponse, client.DeleteTokenError
 }
 func (client *testProjectClient) Create(ctx context.Context, in *project.ProjectCreateRequest, opts ...grpc.CallOption) (*v1alpha1.AppProject, error) {
 	return nil, nil
 }
 func (client *testProjectClient) List(ctx context.Context, in *project.ProjectQuery, opts ...grpc.CallOption) (*v1alpha1.AppProjectList, error) {
-	return nil, nil
+	list := &v1alpha1.AppProjectList{}
+	for _, item := range client.projects {
+		list.Items = append(list.Items, *item)
+	}
+	return list, nil
 }
 func (client *testProjectClient) GetDetailedProject(ctx context.Context, in *project.ProjectQuery, opts ...grpc.CallOption) (*project.DetailedProjectsResponse, error) {
 	return nil, nil
 }
 func (client *testProjectClient) Get(ctx context.Context, in *project.ProjectQuery, opts ...grpc.CallOption) (*v1alpha1.AppProject, error) {
-	return nil, nil
+	for _, item := range client.projects {
+		if item.Name == in.Name {
+			return item, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "appprojects.argoproj.io \"%s\" not found", in.Name)
 }
 func (client *testProjectClient) GetGlobalProjects(ctx context.Context, in *project.ProjectQuery, opts ...grpc.CallOption) (*project.GlobalProjectsResponse, error) {
 	return nil, nil
 }
 func (client *testProjectClient) Update(ctx context.Context, in *project.ProjectUpdateRequest, opts ...grpc.CallOption) (*v1alpha1.AppProject, error) {
-	return nil, nil
+	client.updateRequests = append(client.updateRequests, in)
+	if client.updateError != nil {
+		return nil, client.updateError
+	}
+	for i, item := range client.projects {
+		if item.Name == in.Project.Name {
+			client.projects[i] = in.Project
+		}
+	}
+	return in.Project, nil
 }
 func (client *testProjectClient) Delete(ctx context.Context, in *project.ProjectQuery, opts ...grpc.CallOption) (*project.EmptyResponse, error) {
 	return nil, nil
@@ -100,5 +180,137 @@ func getTestProjectClientContext(projectClient *testProjectClient) *projectClien
 		client:        projectClient,
 		clientContext: context.Background(),
 		closer:        testCloser{},
+		tokenIdPrefix: tokenIdPrefix,
+	}
+}
+
+// cacheTestClients puts the test clients in the client cache of the backend for the config, so the requests handled by the backend use them
+func cacheTestClients(b *backend, config *configEntry, accountClient *testAccountClient, projectClient *testProjectClient) {
+	b.clients.entries[clientCacheKey(accountClientKind, config)] = &cachedClient{closer: testCloser{}, client: account.AccountServiceClient(accountClient)}
+	b.clients.entries[clientCacheKey(projectClientKind, config)] = &cachedClient{closer: testCloser{}, client: project.ProjectServiceClient(projectClient)}
+}
+
+func TestMountTokenIdPrefix(t *testing.T) {
+	a := assert.New(t)
+	a.Equal("vault-1a2b3c4d-", mountTokenIdPrefix("1a2b3c4d-5e6f-7a8b-9c0d-1e2f3a4b5c6d"))
+	a.Equal(tokenIdPrefix, mountTokenIdPrefix(""))
+
+	id := newTokenId(mountTokenIdPrefix("1a2b3c4d-5e6f-7a8b-9c0d-1e2f3a4b5c6d"))
+	a.True(strings.HasPrefix(id, "vault-1a2b3c4d-"))
+	a.True(isPluginTokenId(id))
+}
+
+func TestGenerateTokenRetry(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "account token created by a lost attempt is deleted",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					createTokenResponse: &account.CreateTokenResponse{Token: "some-token"},
+					createTokenLost:     true,
+					accounts:            []*account.Account{{Name: "some-account"}},
+				}
+				clientCtx := getTestAccountClientContext(&accountClient)
+				clientCtx.retryPolicy = policy
+				token, err := clientCtx.GenerateToken("some-account", time.Hour)
+				require.NoError(t, err)
+
+				a := assert.New(t)
+				a.EqualValues("some-token", token.token)
+				require.Len(t, accountClient.createTokenRequests, 2)
+				a.EqualValues(token.metadata.Id, accountClient.createTokenRequests[0].Id)
+				a.EqualValues(token.metadata.Id, accountClient.createTokenRequests[1].Id)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.EqualValues(token.metadata.Id, accountClient.deleteTokenRequests[0].Id)
+				a.EqualValues("some-account", accountClient.deleteTokenRequests[0].Name)
+			},
+		},
+		{
+			name: "account token not created is not deleted",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					createTokenError: status.Error(codes.Unavailable, "unavailable"),
+					accounts:         []*account.Account{{Name: "some-account"}},
+				}
+				clientCtx := getTestAccountClientContext(&accountClient)
+				clientCtx.retryPolicy = policy
+				_, err := clientCtx.GenerateToken("some-account", time.Hour)
+				require.ErrorContains(t, err, "unavailable")
+
+				a := assert.New(t)
+				require.Len(t, accountClient.createTokenRequests, 3)
+				a.EqualValues(accountClient.createTokenRequests[0].Id, accountClient.createTokenRequests[2].Id)
+				a.Empty(accountClient.deleteTokenRequests)
+			},
+		},
+		{
+			name: "account token created by the last attempt is deleted",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					createTokenLost: true,
+					accounts:        []*account.Account{{Name: "some-account"}},
+				}
+				clientCtx := getTestAccountClientContext(&accountClient)
+				clientCtx.retryPolicy = retryPolicy{maxAttempts: 1}
+				_, err := clientCtx.GenerateToken("some-account", time.Hour)
+				require.ErrorContains(t, err, "response lost")
+
+				a := assert.New(t)
+				require.Len(t, accountClient.createTokenRequests, 1)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.EqualValues(accountClient.createTokenRequests[0].Id, accountClient.deleteTokenRequests[0].Id)
+			},
+		},
+		{
+			name: "project token created before the request was cancelled is deleted",
+			fn: func(t *testing.T) {
+				projectClient := testProjectClient{
+					createTokenLost: true,
+					projects:        []*v1alpha1.AppProject{getTestProject("some-project", v1alpha1.ProjectRole{Name: "some-role"})},
+				}
+				clientCtx := getTestProjectClientContext(&projectClient)
+				clientCtx.retryPolicy = retryPolicy{maxAttempts: 3, initialBackoff: time.Hour, maxBackoff: time.Hour}
+				ctx, cancel := context.WithCancel(context.Background())
+				cancel()
+				clientCtx.clientContext = ctx
+				_, err := clientCtx.GenerateToken("some-project", "some-role", time.Hour)
+				require.ErrorIs(t, err, context.Canceled)
+
+				a := assert.New(t)
+				require.Len(t, projectClient.createTokenRequests, 1)
+				require.Len(t, projectClient.deleteTokenRequests, 1)
+				a.EqualValues(projectClient.createTokenRequests[0].Id, projectClient.deleteTokenRequests[0].Id)
+			},
+		},
+		{
+			name: "project token created by a lost attempt is deleted",
+			fn: func(t *testing.T) {
+				projectClient := testProjectClient{
+					createTokenResponse: &project.ProjectTokenResponse{Token: "some-token"},
+					createTokenLost:     true,
+					projects:            []*v1alpha1.AppProject{getTestProject("some-project", v1alpha1.ProjectRole{Name: "some-role"})},
+				}
+				clientCtx := getTestProjectClientContext(&projectClient)
+				clientCtx.retryPolicy = policy
+				token, err := clientCtx.GenerateToken("some-project", "some-role", time.Hour)
+				require.NoError(t, err)
+
+				a := assert.New(t)
+				a.EqualValues("some-token", token.token)
+				require.Len(t, projectClient.createTokenRequests, 2)
+				a.EqualValues(token.metadata.Id, projectClient.createTokenRequests[1].Id)
+				require.Len(t, projectClient.deleteTokenRequests, 1)
+				a.EqualValues(token.metadata.Id, projectClient.deleteTokenRequests[0].Id)
+				a.EqualValues("some-role", projectClient.deleteTokenRequests[0].Role)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
 	}
 }
@@ -0,0 +1,133 @@
+package plugin
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/google/uuid"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// dynamicRoleDescription marks the project roles created by the plugin for a single lease
+	dynamicRoleDescription = "dynamic role created by vault for a single lease, deleted when the lease is revoked"
+	// dynamicRoleCreatedAt separates the description from the creation time of the role
+	dynamicRoleCreatedAt = ", created at "
+	fldDynamicRole       = "dynamic_role"
+	// dynamicRoleGracePeriod is the time given to the creation of the token of a dynamic role,
+	// a dynamic role still without token after it was abandoned and is deleted by the garbage collector
+	dynamicRoleGracePeriod = 15 * time.Minute
+)
+
+// newDynamicRoleName returns a new unique name for a project role created by the mount, prefixed by the id prefix of the mount
+func newDynamicRoleName(idPrefix string) string {
+	return idPrefix + uuid.New().String()
+}
+
+// isDynamicRole returns true if the project role was created for a single lease by the mount with the given id prefix.
+// The roles created before the creation time was recorded only have the description
+func isDynamicRole(role *v1alpha1.ProjectRole, idPrefix string) bool {
+	return strings.HasPrefix(role.Name, idPrefix) &&
+		(role.Description == dynamicRoleDescription || strings.HasPrefix(role.Description, dynamicRoleDescription+dynamicRoleCreatedAt))
+}
+
+// dynamicRoleCreationTime returns the creation time recorded in the description of the dynamic role, false when it is not recorded
+func dynamicRoleCreationTime(role *v1alpha1.ProjectRole) (time.Time, bool) {
+	rawCreatedAt, ok := strings.CutPrefix(role.Description, dynamicRoleDescription+dynamicRoleCreatedAt)
+	if !ok {
+		return time.Time{}, false
+	}
+
+	createdAt, err := time.Parse(time.RFC3339, rawCreatedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+
+	return createdAt, true
+}
+
+// assertValidPolicyTemplate checks that the policy template has the resource, action, object and effect of an argo cd project policy
+func assertValidPolicyTemplate(template string) error {
+	parts := strings.Split(template, ",")
+	if len(parts) != 4 {
+		return fmt.Errorf("policy(%s) should have the format: resource, action, object, effect", template)
+	}
+
+	for _, part := range parts {
+		if strings.TrimSpace(part) == "" {
+			return fmt.Errorf("policy(%s) should have the format: resource, action, object, effect", template)
+		}
+	}
+
+	return nil
+}
+
+// newDynamicRole returns the project role with the policies from the templates, its creation time is recorded in its description
+func newDynamicRole(projectName string, roleName string, templates []string, now time.Time) v1alpha1.ProjectRole {
+	policies := make([]string, 0, len(templates))
+	for _, template := range templates {
+		parts := strings.Split(template, ",")
+		for i := range parts {
+			parts[i] = strings.TrimSpace(parts[i])
+		}
+		policies = append(policies, fmt.Sprintf("p, proj:%s:%s, %s", projectName, roleName, strings.Join(parts, ", ")))
+	}
+
+	return v1alpha1.ProjectRole{
+		Name:        roleName,
+		Description: dynamicRoleDescription + dynamicRoleCreatedAt + now.UTC().Format(time.RFC3339),
+		Policies:    policies,
+	}
+}
+
+// getDynamicProjectToken creates a project role with the policies for a single lease and a token for it.
+// The role is deleted when the token cannot be created
+func (b *backend) getDynamicProjectToken(
+	clientCtx *projectClientContext,
+	projectName string,
+	templates []string,
+	ttl time.Duration) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	role := newDynamicRole(projectName, newDynamicRoleName(clientCtx.tokenIdPrefix), templates, time.Now())
+	if err := clientCtx.CreateRole(projectName, role); err != nil {
+		errMsg := fmt.Sprintf("error while creating the dynamic role(%s/%s): %s", projectName, role.Name, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	token, err := clientCtx.GenerateToken(projectName, role.Name, ttl)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new token for the dynamic role(%s/%s): %s", projectName, role.Name, err)
+		b.logger.Error(errMsg)
+		if err := clientCtx.DeleteRole(projectName, role.Name); err != nil {
+			b.logger.Error(fmt.Sprintf("error while deleting the dynamic role(%s/%s): %s", projectName, role.Name, err))
+		}
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	responseData := token.toResponseData()
+	responseData[fldDynamicRole] = true
+	leaseData := token.toLeaseData()
+	leaseData[fldDynamicRole] = true
+
+	return newTokenSecret(projectTokenSecretType, token.metadata.TTL).Response(responseData, leaseData), nil
+}
+
+// deleteDynamicRole deletes the project role created for the lease, with its token
+func (b *backend) deleteDynamicRole(clientCtx *projectClientContext, projectName string, roleName string) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	if err := clientCtx.DeleteRole(projectName, roleName); isNotFound(err) {
+		b.logger.Info(fmt.Sprintf("project(%s) of the dynamic role(%s) is already deleted from argo cd: %s", projectName, roleName, err))
+		return nil, nil
+	} else if err != nil {
+		errMsg := fmt.Sprintf("error while deleting the dynamic role(%s/%s): %s", projectName, roleName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	return nil, nil
+}
@@ -0,0 +1,151 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestDynamicProjectRole(t *testing.T) {
+	b, _ := getTestBackend(t)
+	templates := []string{"applications, sync, p1/app-*, allow", "applications,get,p1/*,allow"}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "policies from the templates",
+			fn: func(t *testing.T) {
+				role := newDynamicRole("p1", "vault-r1", templates, time.Now())
+				a := assert.New(t)
+				a.True(isDynamicRole(&role, tokenIdPrefix))
+				a.EqualValues([]string{
+					"p, proj:p1:vault-r1, applications, sync, p1/app-*, allow",
+					"p, proj:p1:vault-r1, applications, get, p1/*, allow",
+				}, role.Policies)
+
+				a.False(isDynamicRole(&v1alpha1.ProjectRole{Name: "vault-r1"}, tokenIdPrefix))
+				a.False(isDynamicRole(&v1alpha1.ProjectRole{Name: "r1", Description: dynamicRoleDescription}, tokenIdPrefix))
+			},
+		},
+		{
+			name: "creation time in the description",
+			fn: func(t *testing.T) {
+				now := time.Unix(1700000000, 0)
+				role := newDynamicRole("p1", "vault-r1", templates, now)
+				createdAt, ok := dynamicRoleCreationTime(&role)
+				a := assert.New(t)
+				a.True(ok)
+				a.True(now.Equal(createdAt))
+
+				// the roles created before the creation time was recorded are still dynamic roles
+				legacy := v1alpha1.ProjectRole{Name: "vault-r1", Description: dynamicRoleDescription}
+				a.True(isDynamicRole(&legacy, tokenIdPrefix))
+				_, ok = dynamicRoleCreationTime(&legacy)
+				a.False(ok)
+			},
+		},
+		{
+			name: "invalid templates",
+			fn: func(t *testing.T) {
+				for _, template := range []string{"applications, sync, p1/*", "applications, sync, , allow", "p, proj:p1:r1, applications, sync, p1/*, allow"} {
+					require.Error(t, assertValidPolicyTemplate(template), template)
+				}
+				require.NoError(t, assertValidPolicyTemplate(templates[0]))
+			},
+		},
+		{
+			name: "token issued for a new role",
+			fn: func(t *testing.T) {
+				projectClient := &testProjectClient{
+					projects:            []*v1alpha1.AppProject{getTestProject("p1", v1alpha1.ProjectRole{Name: "r1"})},
+					createTokenResponse: &project.ProjectTokenResponse{Token: "some-dummy-token"},
+				}
+				res, err := b.getDynamicProjectToken(getTestProjectClientContext(projectClient), "p1", templates, time.Hour)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				roles := projectClient.projects[0].Spec.Roles
+				require.Len(t, roles, 2)
+				a := assert.New(t)
+				a.True(isDynamicRole(&roles[1], tokenIdPrefix))
+				a.Len(roles[1].Policies, 2)
+				a.EqualValues(roles[1].Name, res.Data[fldProjectRoleName])
+				a.EqualValues(roles[1].Name, projectClient.createTokenRequests[0].Role)
+				a.EqualValues(true, res.Data[fldDynamicRole])
+				a.EqualValues(true, res.Secret.InternalData[fldDynamicRole])
+				a.EqualValues("some-dummy-token", res.Data[fldToken])
+			},
+		},
+		{
+			name: "role deleted when the token cannot be created",
+			fn: func(t *testing.T) {
+				projectClient := &testProjectClient{
+					projects:         []*v1alpha1.AppProject{getTestProject("p1", v1alpha1.ProjectRole{Name: "r1"})},
+					createTokenError: fmt.Errorf("some error"),
+				}
+				res, err := b.getDynamicProjectToken(getTestProjectClientContext(projectClient), "p1", templates, time.Hour)
+				require.Error(t, err)
+				require.True(t, res.IsError())
+				assert.Len(t, projectClient.updateRequests, 2)
+				assert.EqualValues(t, []v1alpha1.ProjectRole{{Name: "r1"}}, projectClient.projects[0].Spec.Roles)
+			},
+		},
+		{
+			name: "missing project",
+			fn: func(t *testing.T) {
+				projectClient := &testProjectClient{}
+				res, err := b.getDynamicProjectToken(getTestProjectClientContext(projectClient), "p1", templates, time.Hour)
+				require.Error(t, err)
+				assert.Equal(t, http.StatusNotFound, getHTTPStatus(res, err))
+				assert.Empty(t, projectClient.createTokenRequests)
+			},
+		},
+		{
+			name: "role deleted on revoke",
+			fn: func(t *testing.T) {
+				role := newDynamicRole("p1", "vault-r1", templates, time.Now())
+				projectClient := &testProjectClient{
+					projects: []*v1alpha1.AppProject{getTestProject("p1", v1alpha1.ProjectRole{Name: "r1"}, role)},
+				}
+				res, err := b.deleteDynamicRole(getTestProjectClientContext(projectClient), "p1", "vault-r1")
+				require.NoError(t, err)
+				require.Nil(t, res)
+				assert.EqualValues(t, []v1alpha1.ProjectRole{{Name: "r1"}}, projectClient.projects[0].Spec.Roles)
+
+				// already deleted role or project
+				res, err = b.deleteDynamicRole(getTestProjectClientContext(projectClient), "p1", "vault-r1")
+				require.NoError(t, err)
+				require.Nil(t, res)
+				res, err = b.deleteDynamicRole(getTestProjectClientContext(projectClient), "p2", "vault-r1")
+				require.NoError(t, err)
+				require.Nil(t, res)
+				assert.Len(t, projectClient.updateRequests, 1)
+			},
+		},
+		{
+			name: "revoke failure",
+			fn: func(t *testing.T) {
+				role := newDynamicRole("p1", "vault-r1", templates, time.Now())
+				projectClient := &testProjectClient{
+					projects:    []*v1alpha1.AppProject{getTestProject("p1", role)},
+					updateError: status.Error(codes.PermissionDenied, "permission denied"),
+				}
+				res, err := b.deleteDynamicRole(getTestProjectClientContext(projectClient), "p1", "vault-r1")
+				require.Error(t, err)
+				assert.Equal(t, http.StatusForbidden, getHTTPStatus(res, err))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
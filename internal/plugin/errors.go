@@ -0,0 +1,61 @@
+package plugin
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	fldErrorCode = "error_code"
+	fldGRPCCode  = "grpc_code"
+)
+
+// argoCDError maps a grpc status code from argo cd to the http status code and the error code returned to the vault clients
+type argoCDError struct {
+	httpStatus int
+	errorCode  string
+	hint       string
+}
+
+var argoCDErrors = map[codes.Code]argoCDError{
+	codes.NotFound:         {httpStatus: http.StatusNotFound, errorCode: "not_found"},
+	codes.PermissionDenied: {httpStatus: http.StatusForbidden, errorCode: "permission_denied", hint: "check that the admin token of the config is valid and has the required permissions"},
+	codes.Unauthenticated:  {httpStatus: http.StatusForbidden, errorCode: "unauthenticated", hint: "check that the admin token of the config is valid and not expired"},
+	codes.InvalidArgument:  {httpStatus: http.StatusBadRequest, errorCode: "invalid_argument"},
+	codes.Unavailable:      {httpStatus: http.StatusServiceUnavailable, errorCode: "unavailable"},
+}
+
+// argoCDErrorResponse returns the response for an error from argo cd, with the http status code matching its grpc status code.
+// The error code is returned in the response data, and in the error message as vault only returns the message to http clients.
+// Errors without a matching grpc status code keep the generic error response
+func argoCDErrorResponse(errMsg string, err error) (*logical.Response, error) {
+	code := status.Code(err)
+	mapped, ok := argoCDErrors[code]
+	if !ok {
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if mapped.hint != "" {
+		errMsg = fmt.Sprintf("%s, %s", errMsg, mapped.hint)
+	}
+	errMsg = fmt.Sprintf("%s (%s=%s, %s=%s)", errMsg, fldErrorCode, mapped.errorCode, fldGRPCCode, code)
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			"error":      errMsg,
+			fldErrorCode: mapped.errorCode,
+			fldGRPCCode:  code.String(),
+		},
+	}
+
+	return response, logical.CodedError(mapped.httpStatus, errMsg)
+}
+
+// notListedResponse reports an account or project outside the discovery filters of the config as not found, as the list endpoints omit it
+func notListedResponse(errMsg string) (*logical.Response, error) {
+	return logical.ErrorResponse(errMsg), logical.CodedError(http.StatusNotFound, errMsg)
+}
@@ -0,0 +1,67 @@
+package plugin
+
+import (
+	"fmt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// getHTTPStatus returns the status code of the http response vault sends for the response and error
+func getHTTPStatus(res *logical.Response, err error) int {
+	statusCode, err := logical.RespondErrorCommon(&logical.Request{}, res, err)
+	logical.AdjustErrorStatusCode(&statusCode, err)
+	return statusCode
+}
+
+func TestArgoCDErrorResponse(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		httpStatus int
+		errorCode  string
+		contains   string
+	}{
+		{name: "not found", err: status.Error(codes.NotFound, "account does not exist"), httpStatus: http.StatusNotFound, errorCode: "not_found"},
+		{name: "permission denied", err: status.Error(codes.PermissionDenied, "permission denied"), httpStatus: http.StatusForbidden, errorCode: "permission_denied", contains: "admin token"},
+		{name: "unauthenticated", err: status.Error(codes.Unauthenticated, "invalid session"), httpStatus: http.StatusForbidden, errorCode: "unauthenticated", contains: "admin token"},
+		{name: "invalid argument", err: status.Error(codes.InvalidArgument, "invalid expiry"), httpStatus: http.StatusBadRequest, errorCode: "invalid_argument"},
+		{name: "unavailable", err: fmt.Errorf("wrapped: %w", status.Error(codes.Unavailable, "connection refused")), httpStatus: http.StatusServiceUnavailable, errorCode: "unavailable"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := argoCDErrorResponse("some message", test.err)
+			require.Error(t, err)
+			codedErr, ok := err.(logical.HTTPCodedError)
+			require.True(t, ok)
+
+			a := assert.New(t)
+			a.EqualValues(test.httpStatus, codedErr.Code())
+			a.EqualValues(test.errorCode, res.Data[fldErrorCode])
+			a.EqualValues(status.Code(test.err).String(), res.Data[fldGRPCCode])
+			a.Contains(res.Data["error"], "error_code="+test.errorCode)
+			a.Contains(err.Error(), test.contains)
+
+			a.EqualValues(test.httpStatus, getHTTPStatus(res, err))
+		})
+	}
+
+	t.Run("unmapped errors keep the generic error response", func(t *testing.T) {
+		res, err := argoCDErrorResponse("some message", fmt.Errorf("some error"))
+		require.EqualError(t, err, "some error")
+		require.ErrorContains(t, res.Error(), "some message")
+	})
+
+	t.Run("account token", func(t *testing.T) {
+		b, _ := getTestBackend(t)
+		accountClient := testAccountClient{createTokenError: status.Error(codes.PermissionDenied, "permission denied")}
+		res, err := b.getAccountToken(getTestAccountClientContext(&accountClient), "some-account", time.Hour)
+		assert.EqualValues(t, http.StatusForbidden, getHTTPStatus(res, err))
+	})
+}
@@ -0,0 +1,312 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// sweepOptions selects the expired tokens deleted by a sweep
+type sweepOptions struct {
+	scope     string
+	cutoff    time.Time
+	batchSize int
+	// expiries are the expiry times of the inventory records by token id, the lease governed tokens have no expiry in argo cd
+	expiries map[string]time.Time
+	// maxLifetime expires the tokens of the mount (idPrefix) without expiry nor inventory record that were issued before cutoff-maxLifetime,
+	// 0 never expires them
+	maxLifetime time.Duration
+	// idPrefix is the id prefix of the mount (mountTokenIdPrefix), only its dynamic roles and its tokens without record are deleted
+	idPrefix string
+	// adminTokenId is the id of the admin token of the config, it never expires
+	adminTokenId string
+	// dryRun only reports the expired tokens without deleting them
+	dryRun bool
+	// accounts and projects restrict the sweep to the given names, all the accounts and projects are swept when nil
+	accounts []string
+	projects []string
+}
+
+// sweepResult holds the ids of the deleted tokens (or the tokens that would be deleted for a dry run) grouped by account and by project role
+type sweepResult struct {
+	Accounts map[string][]string            `json:"accounts"`
+	Projects map[string]map[string][]string `json:"projects"`
+	Deleted  int                            `json:"deleted"`
+	Errors   []string                       `json:"errors"`
+	// BatchSizeReached is set when the sweep stopped at the batch size, more expired tokens may be left
+	BatchSizeReached bool `json:"batch_size_reached"`
+}
+
+func newSweepResult() sweepResult {
+	return sweepResult{
+		Accounts: map[string][]string{},
+		Projects: map[string]map[string][]string{},
+		Errors:   []string{},
+	}
+}
+
+// isExpired returns true if the token is in scope and expired before the cutoff.
+// The plugin tokens without expiry are lease governed (lease.go), they expire with their inventory record,
+// or after maxLifetime without record when the mount issued them: the other mounts sharing the instance may govern theirs with longer leases.
+// Other tokens without expiry never expire, nor does the admin token
+func (opts *sweepOptions) isExpired(id string, issuedAt int64, expiresAt int64) bool {
+	if opts.adminTokenId != "" && id == opts.adminTokenId {
+		return false
+	}
+	if !opts.isInScope(id) {
+		return false
+	}
+
+	if expiresAt == 0 {
+		if !isPluginTokenId(id) {
+			return false
+		}
+		if recordExpiresAt, ok := opts.expiries[id]; ok {
+			return !recordExpiresAt.IsZero() && recordExpiresAt.Before(opts.cutoff)
+		}
+		return opts.maxLifetime > 0 && opts.idPrefix != "" && strings.HasPrefix(id, opts.idPrefix) &&
+			issuedAt > 0 && time.Unix(issuedAt, 0).Add(opts.maxLifetime).Before(opts.cutoff)
+	}
+
+	return time.Unix(expiresAt, 0).Before(opts.cutoff)
+}
+
+// isInScope returns true if the scope of the sweep covers the token
+func (opts *sweepOptions) isInScope(id string) bool {
+	switch opts.scope {
+	case gcScopeAll:
+		return true
+	case gcScopeLegacy:
+		return isLegacyTokenId(id)
+	default:
+		return isPluginTokenId(id)
+	}
+}
+
+// isDynamicRole returns true if the project role is a dynamic role of the mount.
+// The dynamic roles created before their name had the tag of the mount are only deleted by the sweeps of scope all
+func (opts *sweepOptions) isDynamicRole(role *v1alpha1.ProjectRole) bool {
+	return isDynamicRole(role, opts.idPrefix) || (opts.scope == gcScopeAll && isDynamicRole(role, tokenIdPrefix))
+}
+
+// isAbandoned returns true if the dynamic role has no token and was created before the grace period ending before the cutoff,
+// its token creation failed without deleting it
+func (opts *sweepOptions) isAbandoned(role *v1alpha1.ProjectRole) bool {
+	createdAt, ok := dynamicRoleCreationTime(role)
+	return ok && len(role.JWTTokens) == 0 && createdAt.Add(dynamicRoleGracePeriod).Before(opts.cutoff)
+}
+
+// allExpired returns true if there are tokens and all of them are expired before the cutoff
+func (opts *sweepOptions) allExpired(tokens []v1alpha1.JWTToken) bool {
+	for _, token := range tokens {
+		if !opts.isExpired(token.ID, token.IssuedAt, token.ExpiresAt) {
+			return false
+		}
+	}
+
+	return len(tokens) > 0
+}
+
+func (result *sweepResult) addProjectToken(projectName string, roleName string, id string) {
+	if _, ok := result.Projects[projectName]; !ok {
+		result.Projects[projectName] = map[string][]string{}
+	}
+	result.Projects[projectName][roleName] = append(result.Projects[projectName][roleName], id)
+	result.Deleted++
+}
+
+// addProjectRole records a dynamic role deleted without tokens
+func (result *sweepResult) addProjectRole(projectName string, roleName string) {
+	if _, ok := result.Projects[projectName]; !ok {
+		result.Projects[projectName] = map[string][]string{}
+	}
+	result.Projects[projectName][roleName] = []string{}
+}
+
+func (result *sweepResult) addAccountToken(accountName string, id string) {
+	result.Accounts[accountName] = append(result.Accounts[accountName], id)
+	result.Deleted++
+}
+
+// sweepExpiredTokens deletes the expired tokens from the accounts and the project roles, up to the batch size
+func (b *backend) sweepExpiredTokens(accountCtx *accountClientContext, projectCtx *projectClientContext, opts sweepOptions) sweepResult {
+	result := newSweepResult()
+
+	accountNames := opts.accounts
+	if accountNames == nil {
+		names, err := accountCtx.ListAccountNames()
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		accountNames = names
+	}
+
+	for _, accountName := range accountNames {
+		acc, err := accountCtx.GetAccount(accountName)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("account(%s): %s", accountName, err))
+			continue
+		}
+
+		for _, token := range acc.Tokens {
+			if !opts.isExpired(token.Id, token.IssuedAt, token.ExpiresAt) {
+				continue
+			}
+			if result.Deleted >= opts.batchSize {
+				result.BatchSizeReached = true
+				return result
+			}
+			if opts.dryRun {
+				result.addAccountToken(accountName, token.Id)
+				continue
+			}
+			if err := accountCtx.DeleteToken(token.Id, accountName); err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("token(%s) for account(%s): %s", token.Id, accountName, err))
+				continue
+			}
+			result.addAccountToken(accountName, token.Id)
+		}
+	}
+
+	projectNames := opts.projects
+	if projectNames == nil {
+		names, err := projectCtx.ListProjectNames()
+		if err != nil {
+			result.Errors = append(result.Errors, err.Error())
+		}
+		projectNames = names
+	}
+
+	for _, projectName := range projectNames {
+		proj, err := projectCtx.GetProject(projectName)
+		if err != nil {
+			result.Errors = append(result.Errors, fmt.Sprintf("project(%s): %s", projectName, err))
+			continue
+		}
+
+		for _, role := range proj.Spec.Roles {
+			// the dynamic roles whose tokens all expired are deleted with their tokens, as their lease revocation was missed.
+			// The abandoned dynamic roles, without tokens, are deleted as well
+			if opts.isDynamicRole(&role) && (opts.allExpired(role.JWTTokens) || opts.isAbandoned(&role)) {
+				if result.Deleted >= opts.batchSize {
+					result.BatchSizeReached = true
+					return result
+				}
+				if !opts.dryRun {
+					if err := projectCtx.DeleteRole(projectName, role.Name); err != nil {
+						result.Errors = append(result.Errors, fmt.Sprintf("dynamic role(%s/%s): %s", projectName, role.Name, err))
+						continue
+					}
+				}
+				if len(role.JWTTokens) == 0 {
+					result.addProjectRole(projectName, role.Name)
+				}
+				for _, token := range role.JWTTokens {
+					result.addProjectToken(projectName, role.Name, token.ID)
+				}
+				continue
+			}
+
+			for _, token := range role.JWTTokens {
+				if !opts.isExpired(token.ID, token.IssuedAt, token.ExpiresAt) {
+					continue
+				}
+				if result.Deleted >= opts.batchSize {
+					result.BatchSizeReached = true
+					return result
+				}
+				if opts.dryRun {
+					result.addProjectToken(projectName, role.Name, token.ID)
+					continue
+				}
+				if err := projectCtx.DeleteToken(token.ID, projectName, role.Name); err != nil {
+					result.Errors = append(result.Errors, fmt.Sprintf("token(%s) for project/role(%s/%s): %s", token.ID, projectName, role.Name, err))
+					continue
+				}
+				result.addProjectToken(projectName, role.Name, token.ID)
+			}
+		}
+	}
+
+	return result
+}
+
+// sweepIfDue runs the garbage collector for the instance once its interval has elapsed since the last run.
+// The last runs are kept in memory, so the garbage collector also runs when the plugin starts.
+// Configs written before the garbage collector existed are swept with the defaults (config.applyGCDefaults)
+func (b *backend) sweepIfDue(ctx context.Context, storage logical.Storage, config *configEntry) error {
+	if config.GCInterval == 0 {
+		return nil
+	}
+
+	b.gcLock.Lock()
+	lastSweep, ok := b.lastSweeps[config.Instance]
+	if ok && time.Since(lastSweep) < config.GCInterval {
+		b.gcLock.Unlock()
+		return nil
+	}
+	b.lastSweeps[config.Instance] = time.Now()
+	b.gcLock.Unlock()
+
+	expiries, err := inventoryExpiries(ctx, storage, config.Instance)
+	if err != nil {
+		return err
+	}
+
+	accountCtx, err := NewAccountClient(ctx, b.clients, config)
+	if err != nil {
+		return fmt.Errorf("error while creating a new account client: %s", err)
+	}
+	defer closeClient(b, accountCtx.closer)
+
+	projectCtx, err := NewProjectClient(ctx, b.clients, config)
+	if err != nil {
+		return fmt.Errorf("error while creating a new project client: %s", err)
+	}
+	defer closeClient(b, projectCtx.closer)
+
+	result := b.sweepExpiredTokens(accountCtx, projectCtx, sweepOptions{
+		scope:        config.GCScope,
+		cutoff:       time.Now(),
+		batchSize:    config.GCBatchSize,
+		expiries:     expiries,
+		maxLifetime:  config.leaseMaxLifetime(),
+		idPrefix:     accountCtx.tokenIdPrefix,
+		adminTokenId: config.adminTokenId(),
+	})
+
+	b.logger.Info(fmt.Sprintf("garbage collector deleted %d expired tokens from instance(%s)", result.Deleted, config.Instance))
+	for _, errMsg := range result.Errors {
+		b.logger.Warn(fmt.Sprintf("garbage collector error for instance(%s): %s", config.Instance, errMsg))
+	}
+
+	return nil
+}
+
+// inventoryExpiries returns the expiry times of the inventory records of the instance by token id
+func inventoryExpiries(ctx context.Context, storage logical.Storage, instance string) (map[string]time.Time, error) {
+	tokens, err := listIssuedTokens(ctx, storage, issuedTokenFilters{})
+	if err != nil {
+		return nil, fmt.Errorf("error while listing the issued tokens: %s", err)
+	}
+
+	expiries := make(map[string]time.Time, len(tokens))
+	for _, token := range tokens {
+		if token.Instance == instance {
+			expiries[token.Id] = token.ExpiresAt
+		}
+	}
+
+	return expiries, nil
+}
+
+func closeClient(b *backend, closer io.Closer) {
+	if err := closer.Close(); err != nil {
+		b.logger.Error(err.Error())
+	}
+}
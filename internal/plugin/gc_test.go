@@ -0,0 +1,397 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"testing"
+	"time"
+)
+
+func getTestProject(name string, roles ...v1alpha1.ProjectRole) *v1alpha1.AppProject {
+	return &v1alpha1.AppProject{
+		ObjectMeta: metav1.ObjectMeta{Name: name},
+		Spec:       v1alpha1.AppProjectSpec{Roles: roles},
+	}
+}
+
+func getTestSweepClients() (*testAccountClient, *testProjectClient) {
+	now := time.Now()
+	expired := now.Add(-1 * time.Hour).Unix()
+	valid := now.Add(1 * time.Hour).Unix()
+	accountClient := &testAccountClient{
+		accounts: []*account.Account{
+			{
+				Name: "a1",
+				Tokens: []*account.Token{
+					{Id: "vault-expired", ExpiresAt: expired},
+					{Id: "vault-valid", ExpiresAt: valid},
+					{Id: "foreign-expired", ExpiresAt: expired},
+					{Id: "vault-no-expiry"},
+				},
+			},
+			{
+				Name:   "a2",
+				Tokens: []*account.Token{{Id: "vault-expired-2", ExpiresAt: expired}},
+			},
+		},
+	}
+	projectClient := &testProjectClient{
+		projects: []*v1alpha1.AppProject{
+			getTestProject("p1",
+				v1alpha1.ProjectRole{
+					Name: "r1",
+					JWTTokens: []v1alpha1.JWTToken{
+						{ID: "vault-expired", ExpiresAt: expired},
+						{ID: "vault-valid", ExpiresAt: valid},
+						{ID: "foreign-expired", ExpiresAt: expired},
+					},
+				},
+				v1alpha1.ProjectRole{Name: "r2"},
+			),
+		},
+	}
+	return accountClient, projectClient
+}
+
+func TestSweepExpiredTokens(t *testing.T) {
+	b, _ := getTestBackend(t)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "plugin scope",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    time.Now(),
+					batchSize: 100,
+				})
+				a := assert.New(t)
+				a.Empty(result.Errors)
+				a.EqualValues(3, result.Deleted)
+				a.EqualValues(map[string][]string{"a1": {"vault-expired"}, "a2": {"vault-expired-2"}}, result.Accounts)
+				a.EqualValues(map[string]map[string][]string{"p1": {"r1": {"vault-expired"}}}, result.Projects)
+				a.Len(accountClient.deleteTokenRequests, 2)
+				a.Len(projectClient.deleteTokenRequests, 1)
+			},
+		},
+		{
+			name: "lease governed tokens after the max lifetime",
+			fn: func(t *testing.T) {
+				now := time.Now()
+				accountClient := &testAccountClient{
+					accounts: []*account.Account{
+						{
+							Name: "a1",
+							Tokens: []*account.Token{
+								{Id: "vault-old", IssuedAt: now.Add(-13 * time.Hour).Unix()},
+								{Id: "vault-recent", IssuedAt: now.Add(-1 * time.Hour).Unix()},
+								{Id: "foreign-old", IssuedAt: now.Add(-13 * time.Hour).Unix()},
+							},
+						},
+					},
+				}
+				opts := sweepOptions{scope: gcScopeAll, cutoff: now, batchSize: 100, maxLifetime: 12 * time.Hour, idPrefix: tokenIdPrefix}
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(&testProjectClient{}), opts)
+				a := assert.New(t)
+				a.EqualValues(map[string][]string{"a1": {"vault-old"}}, result.Accounts)
+
+				opts.maxLifetime = 0
+				result = b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(&testProjectClient{}), opts)
+				a.Zero(result.Deleted)
+			},
+		},
+		{
+			name: "lease governed tokens expire with their inventory record",
+			fn: func(t *testing.T) {
+				now := time.Now()
+				accountClient := &testAccountClient{
+					accounts: []*account.Account{
+						{
+							Name: "a1",
+							Tokens: []*account.Token{
+								{Id: "vault-live", IssuedAt: now.Add(-13 * time.Hour).Unix()},
+								{Id: "vault-expired", IssuedAt: now.Add(-2 * time.Hour).Unix()},
+								{Id: "vault-untracked", IssuedAt: now.Add(-13 * time.Hour).Unix()},
+							},
+						},
+					},
+				}
+				opts := sweepOptions{
+					scope:       gcScopePlugin,
+					cutoff:      now,
+					batchSize:   100,
+					expiries:    map[string]time.Time{"vault-live": now.Add(time.Hour), "vault-expired": now.Add(-time.Hour)},
+					maxLifetime: 12 * time.Hour,
+					idPrefix:    tokenIdPrefix,
+				}
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(&testProjectClient{}), opts)
+				assert.EqualValues(t, map[string][]string{"a1": {"vault-expired", "vault-untracked"}}, result.Accounts)
+			},
+		},
+		{
+			name: "admin token without expiry is kept",
+			fn: func(t *testing.T) {
+				now := time.Now()
+				accountClient := &testAccountClient{
+					accounts: []*account.Account{
+						{
+							Name: "admin",
+							Tokens: []*account.Token{
+								{Id: "vault-admin", IssuedAt: now.Add(-13 * time.Hour).Unix()},
+								{Id: "vault-old", IssuedAt: now.Add(-13 * time.Hour).Unix()},
+							},
+						},
+					},
+				}
+				opts := sweepOptions{scope: gcScopeAll, cutoff: now, batchSize: 100, maxLifetime: 12 * time.Hour, idPrefix: tokenIdPrefix, adminTokenId: "vault-admin"}
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(&testProjectClient{}), opts)
+				a := assert.New(t)
+				a.EqualValues(map[string][]string{"admin": {"vault-old"}}, result.Accounts)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.Equal("vault-old", accountClient.deleteTokenRequests[0].Id)
+			},
+		},
+		{
+			name: "all scope",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopeAll,
+					cutoff:    time.Now(),
+					batchSize: 100,
+				})
+				a := assert.New(t)
+				a.EqualValues(5, result.Deleted)
+				a.EqualValues([]string{"vault-expired", "foreign-expired"}, result.Accounts["a1"])
+				a.EqualValues([]string{"vault-expired", "foreign-expired"}, result.Projects["p1"]["r1"])
+			},
+		},
+		{
+			name: "legacy scope",
+			fn: func(t *testing.T) {
+				expired := time.Now().Add(-1 * time.Hour).Unix()
+				accountClient := &testAccountClient{
+					accounts: []*account.Account{
+						{
+							Name: "a1",
+							Tokens: []*account.Token{
+								{Id: "2a6d4c1e-2b4e-4a8e-9f0c-5b6c7d8e9f00", ExpiresAt: expired},
+								{Id: "3b7e5d2f-3c5f-4b9f-8a1d-6c7d8e9f0a11", ExpiresAt: time.Now().Add(time.Hour).Unix()},
+								{Id: "vault-expired", ExpiresAt: expired},
+								{Id: "foreign-expired", ExpiresAt: expired},
+							},
+						},
+					},
+				}
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(&testProjectClient{}), sweepOptions{
+					scope:     gcScopeLegacy,
+					cutoff:    time.Now(),
+					batchSize: 100,
+				})
+				a := assert.New(t)
+				a.EqualValues(1, result.Deleted)
+				a.EqualValues([]string{"2a6d4c1e-2b4e-4a8e-9f0c-5b6c7d8e9f00"}, result.Accounts["a1"])
+			},
+		},
+		{
+			name: "batch size",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopeAll,
+					cutoff:    time.Now(),
+					batchSize: 2,
+				})
+				a := assert.New(t)
+				a.EqualValues(2, result.Deleted)
+				a.Len(accountClient.deleteTokenRequests, 2)
+				a.Empty(projectClient.deleteTokenRequests)
+			},
+		},
+		{
+			name: "dry run",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    time.Now(),
+					batchSize: 100,
+					dryRun:    true,
+				})
+				a := assert.New(t)
+				a.EqualValues(3, result.Deleted)
+				a.EqualValues(map[string][]string{"a1": {"vault-expired"}, "a2": {"vault-expired-2"}}, result.Accounts)
+				a.Empty(accountClient.deleteTokenRequests)
+				a.Empty(projectClient.deleteTokenRequests)
+			},
+		},
+		{
+			name: "restricted to accounts and projects",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				result := b.sweepExpiredTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    time.Now(),
+					batchSize: 100,
+					accounts:  []string{"a2", "missing"},
+					projects:  []string{},
+				})
+				a := assert.New(t)
+				a.EqualValues(1, result.Deleted)
+				a.EqualValues(map[string][]string{"a2": {"vault-expired-2"}}, result.Accounts)
+				a.Empty(result.Projects)
+				require.Len(t, result.Errors, 1)
+				a.Contains(result.Errors[0], "account(missing)")
+			},
+		},
+		{
+			name: "expired dynamic roles",
+			fn: func(t *testing.T) {
+				now := time.Now()
+				expired := newDynamicRole("p1", "vault-expired-role", []string{"applications, get, p1/*, allow"}, now.Add(-2*time.Hour))
+				expired.JWTTokens = []v1alpha1.JWTToken{{ID: "vault-1", ExpiresAt: now.Add(-1 * time.Hour).Unix()}}
+				live := newDynamicRole("p1", "vault-live-role", []string{"applications, get, p1/*, allow"}, now.Add(-2*time.Hour))
+				live.JWTTokens = []v1alpha1.JWTToken{{ID: "vault-2", ExpiresAt: now.Add(1 * time.Hour).Unix()}}
+				pending := newDynamicRole("p1", "vault-pending-role", []string{"applications, get, p1/*, allow"}, now)
+				abandoned := newDynamicRole("p1", "vault-abandoned-role", []string{"applications, get, p1/*, allow"}, now.Add(-time.Hour))
+				legacy := v1alpha1.ProjectRole{Name: "vault-legacy-role", Description: dynamicRoleDescription}
+				projectClient := &testProjectClient{
+					projects: []*v1alpha1.AppProject{getTestProject("p1", expired, live, pending, abandoned, legacy)},
+				}
+				result := b.sweepExpiredTokens(getTestAccountClientContext(&testAccountClient{}), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    now,
+					batchSize: 100,
+					idPrefix:  tokenIdPrefix,
+				})
+				a := assert.New(t)
+				a.Empty(result.Errors)
+				a.EqualValues(1, result.Deleted)
+				a.EqualValues(map[string]map[string][]string{"p1": {"vault-expired-role": {"vault-1"}, "vault-abandoned-role": {}}}, result.Projects)
+				a.Empty(projectClient.deleteTokenRequests)
+				require.Len(t, projectClient.projects[0].Spec.Roles, 3)
+				a.Equal("vault-live-role", projectClient.projects[0].Spec.Roles[0].Name)
+				a.Equal("vault-pending-role", projectClient.projects[0].Spec.Roles[1].Name)
+				a.Equal("vault-legacy-role", projectClient.projects[0].Spec.Roles[2].Name)
+			},
+		},
+		{
+			name: "dynamic roles of the other mounts",
+			fn: func(t *testing.T) {
+				now := time.Now()
+				newAbandonedRole := func(name string) v1alpha1.ProjectRole {
+					return newDynamicRole("p1", name, []string{"applications, get, p1/*, allow"}, now.Add(-time.Hour))
+				}
+				projectClient := &testProjectClient{
+					projects: []*v1alpha1.AppProject{getTestProject("p1",
+						newAbandonedRole("vault-0a1b2c3d-r1"),
+						newAbandonedRole("vault-9f8e7d6c-r1"),
+						newAbandonedRole("vault-7a3e54c2-91d0-4c5b-a8f4-2b6e0d1c9f37"))},
+				}
+				opts := sweepOptions{scope: gcScopePlugin, cutoff: now, batchSize: 100, idPrefix: "vault-0a1b2c3d-"}
+				result := b.sweepExpiredTokens(getTestAccountClientContext(&testAccountClient{}), getTestProjectClientContext(projectClient), opts)
+				a := assert.New(t)
+				a.Empty(result.Errors)
+				a.EqualValues(map[string]map[string][]string{"p1": {"vault-0a1b2c3d-r1": {}}}, result.Projects)
+				require.Len(t, projectClient.projects[0].Spec.Roles, 2)
+
+				// the roles named before the mount tag are only deleted by scope all, with the roles of the other mounts
+				opts.scope = gcScopeAll
+				result = b.sweepExpiredTokens(getTestAccountClientContext(&testAccountClient{}), getTestProjectClientContext(projectClient), opts)
+				a.Empty(result.Errors)
+				a.EqualValues(map[string]map[string][]string{"p1": {"vault-9f8e7d6c-r1": {}, "vault-7a3e54c2-91d0-4c5b-a8f4-2b6e0d1c9f37": {}}}, result.Projects)
+				a.Empty(projectClient.projects[0].Spec.Roles)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestSweepMountsSharingAccount(t *testing.T) {
+	ctx := context.Background()
+	now := time.Now()
+	b1, s1 := getTestMountBackend(t, "0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d", &logical.InmemStorage{})
+	b2, s2 := getTestMountBackend(t, "9f8e7d6c-5b4a-3928-1706-f5e4d3c2b1a0", &logical.InmemStorage{})
+	config := configEntry{
+		ArgoCDUrl:          "argocd.wfecd.splunk.lol",
+		AdminToken:         getTestToken(t, tokenClaims{Subject: "admin:apiKey", Id: "admin-1"}),
+		AccountTokenMaxTTL: 6 * time.Hour,
+		ProjectTokenMaxTTL: 6 * time.Hour,
+		LeaseGoverned:      true,
+		GCScope:            gcScopePlugin,
+		GCInterval:         time.Hour,
+		GCBatchSize:        100,
+	}
+	// the lease governed tokens of both mounts have no expiry nor record in the storage of the other mount
+	issuedAt := now.Add(-13 * time.Hour).Unix()
+	accountClient := &testAccountClient{
+		accounts: []*account.Account{
+			{
+				Name: "a1",
+				Tokens: []*account.Token{
+					{Id: "vault-0a1b2c3d-old", IssuedAt: issuedAt},
+					{Id: "vault-9f8e7d6c-old", IssuedAt: issuedAt},
+					{Id: "vault-old", IssuedAt: issuedAt},
+					{Id: "admin-1", IssuedAt: issuedAt},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name     string
+		b        *backend
+		s        logical.Storage
+		expected string
+	}{
+		{name: "first mount", b: b1, s: s1, expected: "vault-0a1b2c3d-old"},
+		{name: "second mount", b: b2, s: s2, expected: "vault-9f8e7d6c-old"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			accountClient.deleteTokenRequests = nil
+			cacheTestClients(test.b, &config, accountClient, &testProjectClient{})
+			require.NoError(t, test.b.sweepIfDue(ctx, test.s, &config))
+			require.Len(t, accountClient.deleteTokenRequests, 1)
+			assert.Equal(t, test.expected, accountClient.deleteTokenRequests[0].Id)
+		})
+	}
+}
+
+func TestInventoryExpiries(t *testing.T) {
+	_, s := getTestBackend(t)
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Hour).UTC()
+	require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey("vault-1"), &issuedToken{Id: "vault-1", ExpiresAt: expiresAt}))
+	require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey("vault-2"), &issuedToken{Id: "vault-2", Instance: "i1"}))
+
+	expiries, err := inventoryExpiries(ctx, s, "")
+	require.NoError(t, err)
+	require.Len(t, expiries, 1)
+	assert.True(t, expiresAt.Equal(expiries["vault-1"]))
+}
+
+func TestIsPluginTokenId(t *testing.T) {
+	a := assert.New(t)
+	a.True(isPluginTokenId(newTokenId(tokenIdPrefix)))
+	a.False(isPluginTokenId("2a6d4c1e-2b4e-4a8e-9f0c-5b6c7d8e9f00"))
+}
+
+func TestIsLegacyTokenId(t *testing.T) {
+	a := assert.New(t)
+	a.True(isLegacyTokenId("2a6d4c1e-2b4e-4a8e-9f0c-5b6c7d8e9f00"))
+	a.False(isLegacyTokenId(newTokenId(tokenIdPrefix)))
+	a.False(isLegacyTokenId("2a6d4c1e2b4e4a8e9f0c5b6c7d8e9f00"))
+	a.False(isLegacyTokenId("some-token"))
+}
@@ -2,9 +2,17 @@ package plugin
 
 const helpBackend = `
 This backend can create argo cd account tokens and project tokens using the config provided.
-For each argo cd instance that the backend needs to connect to should be enabled to a different path,
-and the write engine-path/config endpoint should be called first to setup the config.
+The write engine-path/config endpoint should be called first to setup the config of the default argo cd instance.
 Once the config is set, the account and project paths can be used to create the ephemeral tokens.
+Additional argo cd instances can be configured with engine-path/config/instance-name,
+their tokens are created from the engine-path/instance-name/account and engine-path/instance-name/project paths.
+The instance names cannot be the first word of a path of the plugin, such as account, revoke or tokens.
+Roles can be configured on the roles path to bind a role name to an account or project role,
+the creds path then creates ephemeral tokens for the role.
+Static roles can be configured on the static-roles path to keep a single rotated token for an account,
+the static-creds path then returns the current token.
+Errors from argo cd are returned with the matching http status code and an error_code in the error message:
+not_found (404), permission_denied and unauthenticated (403), invalid_argument (400), unavailable (503).
 `
 
 const helpPathConfigSynopsis = `
@@ -14,32 +22,362 @@ Configures argo cd connection for the given path
 const helpPathConfigDescription = `
 config properties:
 vault write engine-path/config "key1=value1" "key2=value2"
+vault write engine-path/config/instance-name "key1=value1" "key2=value2"
 keys:
 argo_cd_url: URL for the argo cd instance (do not add https in front of the URL)
 admin_token: Token for an account that has admin access for the given argo cd instance
-account_token_max_ttl: Max TTL for the account tokens created from this plugin
-project_token_max_ttl: Max TTL for the project tokens created from this plugin
+account_token_max_ttl: Max TTL for the account tokens created from this plugin (default: 6h)
+project_token_max_ttl: Max TTL for the project tokens created from this plugin (default: 6h)
+account_token_default_ttl: Default TTL for the account tokens created from this plugin (default: 1h)
+project_token_default_ttl: Default TTL for the project tokens created from this plugin (default: 1h)
+root_rotation_period: Period after which the admin token is rotated automatically (default: 0, no automatic rotation)
+gc_scope: Expired tokens deleted by the garbage collector, plugin (ids starting with vault-) or all (default: plugin)
+gc_interval: Interval between the garbage collector runs, 0 disables it (default: 1h)
+gc_batch_size: Max number of expired tokens deleted by a garbage collector run (default: 100)
+retry_max_attempts: Max number of attempts to create a token when argo cd reports a transient error (default: 4)
+retry_initial_backoff: Wait before the first retry, doubled on every retry with jitter (default: 1s)
+retry_max_backoff: Max wait between two retries (default: 10s)
+reconcile_interval: Interval between the reconcile runs that report the orphan and ghost tokens, 0 disables them (default: 1h)
+discovery_accounts: Comma separated accounts listed by the discovery endpoints, glob patterns are supported (default: all the accounts)
+discovery_projects: Comma separated projects listed by the discovery endpoints, glob patterns are supported (default: all the projects)
+lease_governed: Create the tokens without expiry in argo cd, with leases renewable up to the max ttl (default: false)
+application_project_role: Project role the application tokens are created for, in the project of the application (default: a dynamic role scoped to the application)
+application_actions: Comma separated actions allowed on the application by the dynamic roles of the application tokens (default: get,sync)
+- token creation is only retried on transient errors: unavailable, deadline exceeded and conflicts
+- discovery_accounts and discovery_projects are display filters of the discovery endpoints, they do not restrict the tokens issued,
+  restrict the issuing paths with vault policies instead. allowed_accounts and allowed_projects are their deprecated names
+- the max TTLs are capped by the max lease TTL of the mount, the default TTLs by the default lease TTL of the mount and the max TTLs,
+  a warning is returned when a requested TTL was capped
+- application_actions are argo cd application actions: get, create, update, delete, sync, override or action,
+  they are required unless application_project_role is set
+- admin_token is only required for the initial config, it is kept when not provided
+- once the plugin rotated the admin token, admin_token is rejected when it was issued before the rotation,
+  a newer admin_token replaces the rotated admin token with a warning, the rotated admin token is not deleted
+- when argo_cd_url, insecure or plaintext change, the previous connection is retained
+  so the outstanding leases are still revoked against the argo cd server that issued them
+  the retained connections are deleted once no lease can use them anymore
+- with lease_governed, revoking the lease is the only way to delete the token before the garbage collector,
+  which deletes them once the expiry of their inventory record (engine-path/tokens) passed,
+  or once the max ttl passed for the tokens of this mount (vault-<mount tag>-) without record.
+  The tokens of the other mounts without record and the admin token are never deleted
+`
+
+const helpPathRotateRootSynopsis = `
+Rotate the admin token of the argo cd instance
+`
+
+const helpPathRotateRootDescription = `
+- vault write -force engine-path/config/rotate-root
+- vault write -force engine-path/config/instance-name/rotate-root
+-- finds the account of the admin token from its subject
+-- creates a new token for that account with the same lifetime as the current admin token
+-- saves the new token in the config, then deletes the previous token from argo cd
+-- once rotated, the admin token is only known to the plugin
+-- the id of the new admin token starts with admin-, so no mount treats it as a token issued by the plugin
+`
+
+const helpPathTidySynopsis = `
+Delete the expired tokens from argo cd
+`
+
+const helpPathTidyDescription = `
+- vault write engine-path/tidy dry_run=true safety_buffer=1h batch_size=500 accounts=account-name projects=project-name
+- vault write engine-path/instance-name/tidy
+-- deletes the tokens that expired for longer than safety_buffer from the accounts and the project roles
+-- dry_run only reports the tokens that would be deleted
+-- when accounts or projects are set, only the given accounts and projects are tidied
+-- scope defaults to the gc_scope of the config: plugin (issued by the plugin) or all
+-- scope=legacy deletes the expired tokens with a bare uuid id, issued by the plugin before its ids were prefixed with vault-,
+   run it once after the upgrade, as the plugin scope never collects them.
+   Argo cd also gives bare uuid ids to the tokens created without id, run it with dry_run first
+-- returns the token ids grouped by account and by project role
+-- a run deletes at most batch_size tokens, the gc_batch_size of the config by default, so it completes within the request timeout.
+   batch_size_reached tells more expired tokens may be left, the tidy is then run again
+`
+
+const helpPathTidyStatusSynopsis = `
+Report the last tidy run
+`
+
+const helpPathTidyStatusDescription = `
+- vault read engine-path/tidy-status
+- vault read engine-path/instance-name/tidy-status
+-- reports the start time, duration, token counts and errors of the last tidy run, and whether it stopped at the batch size
+`
+
+const helpPathPendingRevocationsSynopsis = `
+List the token deletions that failed when their lease was revoked
+`
+
+const helpPathPendingRevocationsDescription = `
+- vault list -detailed engine-path/revocations/pending
+-- when argo cd cannot delete the token of a revoked lease, the revocation is acknowledged to vault and queued
+-- the queued deletions are retried with an exponential backoff (1m up to 1h) until they succeed
+-- a deletion is dropped once the token expired in argo cd, the garbage collector then deletes the expired token
+-- the deletions of the lease governed tokens, which never expire in argo cd, are never dropped
+-- lists the token ids with the reason of the last failure, the number of retries and the next retry
+`
+
+const helpPathTokensListSynopsis = `
+List the tokens issued by the plugin
+`
+
+const helpPathTokensListDescription = `
+- vault list -detailed engine-path/tokens
+- curl -X LIST "$VAULT_ADDR/v1/engine-path/tokens?account_name=account-name"
+-- lists the tokens issued by the plugin whose lease was not revoked yet
+-- the account_name, project_name, project_role_name and role_name query parameters only list the matching tokens
+-- returns the instance, account or project role, vault role, requester entity and display name, issue and expiry times of each token
+-- the tokens themselves are never recorded
+`
+
+const helpPathTokensSynopsis = `
+Read a token issued by the plugin
+`
+
+const helpPathTokensDescription = `
+- vault read engine-path/tokens/token-id
+-- returns the inventory record of the token: the instance, account or project role, vault role,
+   requester entity and display name, issue and expiry times
+-- the record is removed once the lease of the token is revoked and the token deleted from argo cd
+`
+
+const helpPathRevokeSynopsis = `
+Delete all the tokens of an argo cd account or project role from argo cd, their vault leases are not revoked
+`
+
+const helpPathRevokeDescription = `
+- vault write engine-path/revoke/account/account-name plugin_issued_only=true
+- vault write engine-path/revoke/project/project_name/role/role_name
+- vault write engine-path/instance-name/revoke/account/account-name
+-- deletes every token registered in argo cd for the account or project role, including the tokens not issued by the plugin
+-- plugin_issued_only only deletes the tokens issued by the plugin
+-- the tokens are deleted concurrently, 8 at a time
+-- the admin token of the config is skipped, so the plugin keeps its access to argo cd
+-- returns the result of each deletion: deleted, already_deleted, failed with the error or skipped
+-- only the tokens are deleted from argo cd: vault leases cannot be revoked by the plugin, so leases_revoked is always false.
+   lease_prefixes lists the prefixes to revoke with vault lease revoke -prefix: the token path, the creds paths of the bound roles,
+   and the creds and application paths the inventory recorded for the tokens of the account or project role.
+   The revocation of the leases succeeds as their tokens are already deleted
+`
+
+const helpPathReconcileSynopsis = `
+Reconcile the tokens issued by the plugin with the tokens in argo cd
+`
+
+const helpPathReconcileDescription = `
+- vault write engine-path/reconcile delete_orphans=true
+- vault write engine-path/instance-name/reconcile
+-- compares the inventory of the issued tokens (engine-path/tokens) with the tokens in argo cd
+-- orphans are tokens with the id prefix of the mount (vault-<mount tag>-) in argo cd without lease, the admin token is never an orphan
+-- ghosts are leases whose token is gone from argo cd, their revocation succeeds
+-- delete_orphans deletes the orphans from argo cd, otherwise they are only reported
+-- the tokens issued in the last 5 minutes are skipped
+-- tokens issued before the inventory existed are reported as orphans, review the report before deleting them
+-- also runs every reconcile_interval of the config, the periodic runs only report the orphans
+`
+
+const helpPathReconcileStatusSynopsis = `
+Report the last reconcile run
+`
+
+const helpPathReconcileStatusDescription = `
+- vault read engine-path/reconcile-status
+- vault read engine-path/instance-name/reconcile-status
+-- reports the start time, duration, orphans, ghosts and errors of the last reconcile run, on demand or periodic
+`
+
+const helpPathIntrospectSynopsis = `
+Decode an argo cd token and check whether it still exists
+`
+
+const helpPathIntrospectDescription = `
+- vault write engine-path/introspect token=...
+- vault write engine-path/instance-name/introspect token=...
+-- decodes the token without verifying its signature: issuer, subject, id, issued_at, expires_at
+-- token_type is account (subject account-name:apiKey), project (subject proj:project-name:role-name) or unknown
+-- exists reports whether the token is still registered in argo cd, a warning is returned when it cannot be checked
+-- issued_by_mount reports whether this mount issued the token: its id has the prefix of the mount (vault-<mount tag>-),
+   it is in the inventory or the pending revocations, it is the token of a static role or the admin token of the config
+-- plugin_issued reports whether the token id has the plugin format (vault-)
+`
+
+const helpPathConfigListSynopsis = `
+List the named argo cd instances
+`
+
+const helpPathConfigListDescription = `
+- vault list engine-path/config
+-- lists the names of the argo cd instances configured with engine-path/config/instance-name
+-- the default instance configured with engine-path/config is not listed
+`
+
+const helpPathAccountsListSynopsis = `
+List the argo cd accounts passing the discovery filters of the config
+`
+
+const helpPathAccountsListDescription = `
+- vault list -detailed engine-path/accounts
+- vault list -detailed engine-path/instance-name/accounts
+-- lists the accounts of argo cd matching discovery_accounts in the config, a display filter that does not restrict the tokens issued
+-- returns whether each account is enabled, and its capabilities (apiKey is required to issue tokens)
+`
+
+const helpPathProjectsListSynopsis = `
+List the argo cd projects passing the discovery filters of the config
+`
+
+const helpPathProjectsListDescription = `
+- vault list -detailed engine-path/projects
+- vault list -detailed engine-path/instance-name/projects
+-- lists the projects of argo cd matching discovery_projects in the config, a display filter that does not restrict the tokens issued
+-- returns the description and the role names of each project
+`
+
+const helpPathProjectsReadSynopsis = `
+Read the roles of an argo cd project
+`
+
+const helpPathProjectsReadDescription = `
+- vault read engine-path/projects/project-name
+- vault read engine-path/instance-name/projects/project-name
+-- returns the roles of the project with their description, policies and groups
+-- projects outside discovery_projects in the config are not found, as they are not listed
 `
 
 const helpPathAccountSynopsis = `
-Create tokens for the given argo cd account
+Create and list tokens for the given argo cd account
 `
 
 const helpPathAccountDescription = `
 - vault write engine-path/account/account-name expires_in=2h
+- vault write engine-path/instance-name/account/account-name expires_in=2h
 -- creates a token for the specified account
--- Default value for expires_in=1h
+-- the account must exist, be enabled and have the apiKey capability, otherwise the request is rejected with the reason
+-- Default value for expires_in=account_token_default_ttl of the config
 -- returns created token
 -- when the token expires, it is removed from argo cd
+- vault read engine-path/account/account-name
+- vault read engine-path/instance-name/account/account-name
+-- lists the tokens registered in argo cd for the account with their id, issued_at and expires_at
+-- status is live (issued by the mount, recorded in the inventory), expired (issued by the mount, not deleted yet),
+   revoking (issued by the mount, deletion queued after the lease was revoked),
+   untracked (issued by the mount, not recorded in the inventory) or foreign (not issued by the mount, e.g. by another mount of the plugin)
+-- plugin_issued reports whether the token was issued by the mount
+-- the tokens issued before the plugin prefixed its ids with vault- are reported as foreign, engine-path/tidy with scope=legacy collects them once expired
 `
 const helpPathProjectSynopsis = `
-Create tokens for the given argo cd project role
+Create and list tokens for the given argo cd project role
 `
 
 const helpPathProjectDescription = `
 - vault write engine-path/project/project_name/role/role_name expires_in=2h
+- vault write engine-path/instance-name/project/project_name/role/role_name expires_in=2h
 -- creates a token for the specified role in an argo cd project
--- Default value for expires_in=1h
+-- Default value for expires_in=project_token_default_ttl of the config
+-- returns created token
+-- when the token expires, it is removed from argo cd
+- vault read engine-path/project/project_name/role/role_name
+- vault read engine-path/instance-name/project/project_name/role/role_name
+-- returns the policies and groups of the role, with the jwt tokens registered in argo cd for the role
+-- each token has its id, issued_at, expires_at, whether it was issued by the mount and whether it expired
+-- status is live, expired, revoking, untracked or foreign as for the account tokens
+`
+
+const helpPathApplicationSynopsis = `
+Create tokens scoped to an argo cd application
+`
+
+const helpPathApplicationDescription = `
+- vault write engine-path/application/application-name ttl=2h
+- vault write engine-path/instance-name/application/application-name
+-- finds the project of the application and creates a token for it
+-- by default, a dynamic role allowing only the application_actions of the config (default: get,sync) on the application
+   is created in the project and deleted with its token when the lease is revoked
+-- application_project_role of the config creates the token for that role of the project instead
+-- the role and the actions are only taken from the config, the caller cannot choose them
+-- returns the token with the application_name, project_name and project_role_name it was created for
+`
+
+const helpPathRolesListSynopsis = `
+List the configured roles
+`
+
+const helpPathRolesListDescription = `
+- vault list engine-path/roles
+-- lists the names of all the roles configured in this mount
+`
+
+const helpPathRolesSynopsis = `
+Manage roles that bind a vault role name to an argo cd account or project role
+`
+
+const helpPathRolesDescription = `
+role properties:
+vault write engine-path/roles/role-name "key1=value1" "key2=value2"
+keys:
+instance: named argo cd instance the role issues tokens from (default: the instance configured with engine-path/config)
+account_name: argo cd account the role issues tokens for
+project_name: argo cd project the role issues tokens for (requires project_role_name)
+project_role_name: argo cd project role the role issues tokens for (requires project_name)
+policies: policy templates (resource, action, object, effect) of a dynamic project role created in project_name for each lease, e.g. "applications, sync, project-name/app-*, allow"
+default_ttl: Default TTL for the tokens issued from this role (default: the default TTL in the config)
+max_ttl: Max TTL for the tokens issued from this role, capped by the max TTL in the config
+- account_name and project_name/project_role_name are mutually exclusive
+- project_role_name and policies are mutually exclusive
+- a dynamic project role is named vault-<mount tag>-<uuid>, it is deleted from the project with its token when the lease is revoked
+- the garbage collector deletes the dynamic roles of the mount whose tokens all expired, and the ones still without token 15m after their creation.
+  The dynamic roles named vault-<uuid>, created before the mount tag, and the ones of the other mounts are only deleted with gc scope all
+- vault policies can be written against engine-path/creds/role-name instead of the argo cd account or project paths
+`
+
+const helpPathCredsSynopsis = `
+Create tokens for the argo cd account or project role bound to the given role
+`
+
+const helpPathCredsDescription = `
+- vault read engine-path/creds/role-name
+- vault write engine-path/creds/role-name ttl=2h
+-- creates a token for the account or project role bound to the role
+-- Default value for ttl is the default_ttl of the role
 -- returns created token
 -- when the token expires, it is removed from argo cd
 `
+
+const helpPathStaticRolesListSynopsis = `
+List the configured static roles
+`
+
+const helpPathStaticRolesListDescription = `
+- vault list engine-path/static-roles
+-- lists the names of all the static roles configured in this mount
+`
+
+const helpPathStaticRolesSynopsis = `
+Manage static roles that keep a single rotated token for an argo cd account
+`
+
+const helpPathStaticRolesDescription = `
+static role properties:
+vault write engine-path/static-roles/role-name "key1=value1" "key2=value2"
+keys:
+instance: named argo cd instance the static role issues tokens from (default: the instance configured with engine-path/config)
+account_name: argo cd account the static role issues tokens for
+rotation_period: Period after which the token is rotated (default: 24h, min: 1m)
+grace_period: Time the previous token stays valid after a rotation, before it is deleted from argo cd (default: 1h)
+- the first token is created when the static role is created
+- the tokens are rotated from the periodic func, each token expires after rotation_period + grace_period
+- account_name and instance cannot be changed, the static role must be deleted and created again
+- vault delete engine-path/static-roles/role-name deletes the current and previous tokens from argo cd
+`
+
+const helpPathStaticCredsSynopsis = `
+Read the current token of a static role
+`
+
+const helpPathStaticCredsDescription = `
+- vault read engine-path/static-creds/role-name
+-- returns the current token of the static role without lease, for the consumers that cannot renew leases
+-- last_rotated and next_rotation are the times of the last and next rotations, ttl is the number of seconds until the next rotation
+-- the tokens are stored seal wrapped
+`
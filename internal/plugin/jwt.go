@@ -0,0 +1,82 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const (
+	apiKeySubjectSuffix  = ":apiKey"
+	projectSubjectPrefix = "proj:"
+)
+
+// tokenClaims holds the claims of an argo cd token that the plugin needs
+type tokenClaims struct {
+	Issuer    string `json:"iss"`
+	Subject   string `json:"sub"`
+	Id        string `json:"jti"`
+	IssuedAt  int64  `json:"iat"`
+	ExpiresAt int64  `json:"exp"`
+}
+
+// parseTokenClaims decodes the claims of an argo cd token without verifying its signature
+func parseTokenClaims(token string) (tokenClaims, error) {
+	var claims tokenClaims
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		return claims, fmt.Errorf("invalid token: expected 3 parts, got %d", len(parts))
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return claims, fmt.Errorf("invalid token: error while decoding the payload: %s", err)
+	}
+
+	if err := json.Unmarshal(payload, &claims); err != nil {
+		return claims, fmt.Errorf("invalid token: error while decoding the claims: %s", err)
+	}
+
+	return claims, nil
+}
+
+// accountName returns the argo cd account of an account token, from its subject (account-name:apiKey)
+func (c *tokenClaims) accountName() (string, error) {
+	if !strings.HasSuffix(c.Subject, apiKeySubjectSuffix) {
+		return "", fmt.Errorf("token subject(%s) is not an argo cd account api key", c.Subject)
+	}
+
+	return strings.TrimSuffix(c.Subject, apiKeySubjectSuffix), nil
+}
+
+// projectRole returns the argo cd project and role of a project token, from its subject (proj:project-name:role-name)
+func (c *tokenClaims) projectRole() (string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(c.Subject, projectSubjectPrefix), ":")
+	if !strings.HasPrefix(c.Subject, projectSubjectPrefix) || len(parts) != 2 {
+		return "", "", fmt.Errorf("token subject(%s) is not an argo cd project role", c.Subject)
+	}
+
+	return parts[0], parts[1], nil
+}
+
+// lifetime returns the duration the token was issued for, 0 if it does not expire
+func (c *tokenClaims) lifetime() time.Duration {
+	if c.ExpiresAt == 0 || c.IssuedAt == 0 {
+		return 0
+	}
+
+	return time.Duration(c.ExpiresAt-c.IssuedAt) * time.Second
+}
+
+// adminTokenId returns the id of the admin token of the config, empty when the admin token is not an argo cd token.
+// The admin token is never deleted by the plugin, it would lose its access to argo cd
+func (c *configEntry) adminTokenId() string {
+	claims, err := parseTokenClaims(c.AdminToken)
+	if err != nil {
+		return ""
+	}
+
+	return claims.Id
+}
@@ -0,0 +1,100 @@
+package plugin
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func getTestToken(t *testing.T, claims tokenClaims) string {
+	header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`))
+	payload, err := json.Marshal(claims)
+	require.NoError(t, err)
+	return header + "." + base64.RawURLEncoding.EncodeToString(payload) + ".c2lnbmF0dXJl"
+}
+
+func TestParseTokenClaims(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "account token",
+			fn: func(t *testing.T) {
+				expected := tokenClaims{
+					Issuer:    "argocd",
+					Subject:   "argocd-tokens-plugin:apiKey",
+					Id:        "some-id",
+					IssuedAt:  1700000000,
+					ExpiresAt: 1700003600,
+				}
+				claims, err := parseTokenClaims(getTestToken(t, expected))
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues(expected, claims)
+				a.EqualValues(1*time.Hour, claims.lifetime())
+
+				accountName, err := claims.accountName()
+				require.NoError(t, err)
+				a.EqualValues("argocd-tokens-plugin", accountName)
+			},
+		},
+		{
+			name: "project token",
+			fn: func(t *testing.T) {
+				claims, err := parseTokenClaims(getTestToken(t, tokenClaims{Subject: "proj:p1:r1", IssuedAt: 1700000000}))
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues(0, claims.lifetime())
+
+				_, err = claims.accountName()
+				require.ErrorContains(t, err, "is not an argo cd account api key")
+
+				projectName, roleName, err := claims.projectRole()
+				require.NoError(t, err)
+				a.EqualValues("p1", projectName)
+				a.EqualValues("r1", roleName)
+			},
+		},
+		{
+			name: "unknown subject",
+			fn: func(t *testing.T) {
+				for _, subject := range []string{"admin", "proj:p1", "proj:p1:r1:x"} {
+					claims := tokenClaims{Subject: subject}
+					_, _, err := claims.projectRole()
+					require.ErrorContains(t, err, "is not an argo cd project role")
+				}
+			},
+		},
+		{
+			name: "admin token id",
+			fn: func(t *testing.T) {
+				config := configEntry{AdminToken: getTestToken(t, tokenClaims{Subject: "admin:apiKey", Id: "admin-id"})}
+				assert.Equal(t, "admin-id", config.adminTokenId())
+
+				config = configEntry{AdminToken: "some-dummy-token"}
+				assert.Empty(t, config.adminTokenId())
+			},
+		},
+		{
+			name: "invalid token",
+			fn: func(t *testing.T) {
+				_, err := parseTokenClaims("some-dummy-token")
+				require.ErrorContains(t, err, "expected 3 parts")
+
+				_, err = parseTokenClaims("a.!!!.c")
+				require.ErrorContains(t, err, "error while decoding the payload")
+
+				_, err = parseTokenClaims("a.bm90LWpzb24.c")
+				require.ErrorContains(t, err, "error while decoding the claims")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,88 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// fldLeaseGoverned marks the leases of the tokens created without expiry in argo cd
+const fldLeaseGoverned = "lease_governed"
+
+// tokenExpiresIn returns the expiry of the argo cd token, the lease governed tokens do not expire in argo cd
+func (c *configEntry) tokenExpiresIn(ttl time.Duration) time.Duration {
+	if c.LeaseGoverned {
+		return 0
+	}
+
+	return ttl
+}
+
+// leaseMaxLifetime returns the longest time a lease governed token can live, as its lease cannot be renewed past the max ttl.
+// It is 0 when the config is not lease governed. It only applies to the tokens of the mount, the other mounts have their own max ttls
+func (c *configEntry) leaseMaxLifetime() time.Duration {
+	if !c.LeaseGoverned {
+		return 0
+	}
+	if c.AccountTokenMaxTTL > c.ProjectTokenMaxTTL {
+		return c.AccountTokenMaxTTL
+	}
+
+	return c.ProjectTokenMaxTTL
+}
+
+// governLease makes the lease of the token renewable up to maxTTL when the config is lease governed.
+// The token was created without expiry, so revoking the lease is the only way to delete it
+func (c *configEntry) governLease(response *logical.Response, ttl time.Duration, maxTTL time.Duration) {
+	if !c.LeaseGoverned || response == nil || response.Secret == nil {
+		return
+	}
+
+	response.Secret.TTL = ttl
+	response.Secret.MaxTTL = maxTTL
+	response.Secret.Renewable = true
+	response.Secret.InternalData[fldLeaseGoverned] = true
+	response.Secret.InternalData[fldMaxTTL] = maxTTL.String()
+}
+
+// isLeaseGoverned returns true if the token of the lease has no expiry in argo cd
+func isLeaseGoverned(leaseData map[string]interface{}) bool {
+	leaseGoverned, _ := getFromData[bool](leaseData, fldLeaseGoverned)
+	return leaseGoverned
+}
+
+// renewTokenCallback extends the lease of a lease governed token by the requested increment, the ttl of the lease without increment.
+// The renewals are capped at the max ttl recorded when the token was issued. The other tokens expire in argo cd, their leases are not renewable
+func (b *backend) renewTokenCallback(_ context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	if !isLeaseGoverned(req.Secret.InternalData) {
+		return logical.ErrorResponse("the lease cannot be renewed as its token expires in argo cd"), nil
+	}
+
+	rawMaxTTL, err := getFromData[string](req.Secret.InternalData, fldMaxTTL)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	maxTTL, err := time.ParseDuration(rawMaxTTL)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while parsing the max ttl(%s) of the lease: %s", rawMaxTTL, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	ttl, warnings, err := framework.CalculateTTL(b.System(), req.Secret.Increment, req.Secret.TTL, 0, maxTTL, 0, req.Secret.IssueTime)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while calculating the ttl of the renewed lease: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	response := &logical.Response{Secret: req.Secret, Warnings: warnings}
+	response.Secret.TTL = ttl
+	response.Secret.MaxTTL = maxTTL
+
+	return response, nil
+}
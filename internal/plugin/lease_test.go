@@ -0,0 +1,123 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestLeaseGovernedTokens(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	config := configEntry{LeaseGoverned: true, AccountTokenMaxTTL: 6 * time.Hour, ProjectTokenMaxTTL: 12 * time.Hour}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "token without expiry and renewable lease",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{createTokenResponse: &account.CreateTokenResponse{Token: "some-dummy-token"}}
+				res, err := b.getAccountToken(getTestAccountClientContext(accountClient), "a1", config.tokenExpiresIn(time.Hour))
+				require.NoError(t, err)
+				config.governLease(res, time.Hour, config.AccountTokenMaxTTL)
+
+				a := assert.New(t)
+				a.EqualValues(0, accountClient.createTokenRequests[0].ExpiresIn)
+				a.True(res.Secret.Renewable)
+				a.Equal(time.Hour, res.Secret.TTL)
+				a.Equal(6*time.Hour, res.Secret.MaxTTL)
+				a.True(isLeaseGoverned(res.Secret.InternalData))
+
+				// the inventory record expires with the max ttl of the lease
+				now := time.Now()
+				res.Secret.InternalData[fldSecretType] = accountTokenSecretType
+				token, err := newIssuedToken(&logical.Request{}, "", res, now)
+				require.NoError(t, err)
+				a.Equal(now.Add(6*time.Hour), token.ExpiresAt)
+			},
+		},
+		{
+			name: "tokens expire in argo cd without opt-in",
+			fn: func(t *testing.T) {
+				legacy := configEntry{AccountTokenMaxTTL: 6 * time.Hour}
+				accountClient := &testAccountClient{createTokenResponse: &account.CreateTokenResponse{Token: "some-dummy-token"}}
+				res, err := b.getAccountToken(getTestAccountClientContext(accountClient), "a1", legacy.tokenExpiresIn(time.Hour))
+				require.NoError(t, err)
+				legacy.governLease(res, time.Hour, legacy.AccountTokenMaxTTL)
+
+				a := assert.New(t)
+				a.EqualValues(3600, accountClient.createTokenRequests[0].ExpiresIn)
+				a.False(res.Secret.Renewable)
+				a.False(isLeaseGoverned(res.Secret.InternalData))
+
+				res, err = b.renewTokenCallback(ctx, &logical.Request{Secret: res.Secret}, nil)
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "the lease cannot be renewed")
+			},
+		},
+		{
+			name: "renew up to the max ttl",
+			fn: func(t *testing.T) {
+				secret := &logical.Secret{InternalData: map[string]interface{}{
+					fldID:            "vault-1",
+					fldLeaseGoverned: true,
+					fldMaxTTL:        (6 * time.Hour).String(),
+				}}
+				secret.TTL = time.Hour
+				secret.IssueTime = time.Now()
+				res, err := b.renewTokenCallback(ctx, &logical.Request{Secret: secret}, nil)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				a := assert.New(t)
+				a.Equal(time.Hour, res.Secret.TTL)
+				a.Equal(6*time.Hour, res.Secret.MaxTTL)
+
+				// the lease is extended by the increment
+				secret.Increment = 2 * time.Hour
+				res, err = b.renewTokenCallback(ctx, &logical.Request{Secret: secret}, nil)
+				require.NoError(t, err)
+				a.Equal(2*time.Hour, res.Secret.TTL)
+
+				// the increment is capped by the max ttl left since the token was issued
+				secret.IssueTime = time.Now().Add(-5 * time.Hour)
+				res, err = b.renewTokenCallback(ctx, &logical.Request{Secret: secret}, nil)
+				require.NoError(t, err)
+				a.InDelta(time.Hour, res.Secret.TTL, float64(2*time.Second))
+				a.NotEmpty(res.Warnings)
+			},
+		},
+		{
+			name: "revocation retried after the lease ttl",
+			fn: func(t *testing.T) {
+				req := revokeRequest(s, map[string]interface{}{fldID: "vault-2", fldLeaseGoverned: true}, time.Second)
+				req.Secret.IssueTime = time.Now().Add(-time.Hour)
+				_, err := b.queueRevocation(ctx, req, accountTokenSecretType, "vault-2", context.DeadlineExceeded)
+				require.NoError(t, err)
+
+				rev, err := readFromStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey("vault-2"))
+				require.NoError(t, err)
+				assert.False(t, rev.expired(time.Now()))
+			},
+		},
+		{
+			name: "max lifetime",
+			fn: func(t *testing.T) {
+				assert.Equal(t, 12*time.Hour, config.leaseMaxLifetime())
+
+				// the tokens of the configs that are not lease governed always expire in argo cd
+				notGoverned := config
+				notGoverned.LeaseGoverned = false
+				assert.Zero(t, notGoverned.leaseMaxLifetime())
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
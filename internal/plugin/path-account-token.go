@@ -16,7 +16,7 @@ var getAccountTokenSchema = map[string]*framework.FieldSchema{
 	},
 	fldTTL: {
 		Type:        framework.TypeDurationSecond,
-		Description: `Expires in (default: 1h, max: 180d)`,
+		Description: `Expires in (default: account_token_default_ttl of the config, max: account_token_max_ttl of the config)`,
 	},
 }
 
@@ -30,6 +30,26 @@ func pathAccountToken(b *backend) []*framework.Path {
 					Callback: b.getAccountTokenCallback,
 					Summary:  "gets a token for an argo cd account",
 				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readAccountTokensCallback,
+					Summary:  "lists the tokens of an argo cd account",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathAccountSynopsis),
+			HelpDescription: trimHelp(helpPathAccountDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/account/%s", framework.GenericNameRegex(fldInstance), framework.GenericNameRegex(fldAccountName)),
+			Fields:  withInstanceField(getAccountTokenSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.getAccountTokenCallback,
+					Summary:  "gets a token for an argo cd account of a named argo cd instance",
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readAccountTokensCallback,
+					Summary:  "lists the tokens of an argo cd account of a named argo cd instance",
+				},
 			},
 			HelpSynopsis:    trimHelp(helpPathAccountSynopsis),
 			HelpDescription: trimHelp(helpPathAccountDescription),
@@ -42,46 +62,113 @@ func (b *backend) getAccountTokenCallback(
 	req *logical.Request,
 	data *framework.FieldData) (*logical.Response, error) {
 
-	config, err := getConfig(ctx, req)
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
 	if err != nil {
 		errMsg := fmt.Sprintf("error while reading config: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), fmt.Errorf(errMsg)
 	}
 
-	clientCtx, err := NewAccountClient(ctx, &config)
+	accountName, err := getFromFieldData[string](data, fldAccountName)
+	if err != nil {
+		return logical.ErrorResponse(fmt.Sprintf("error while getting account name from data: %s", err)), err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
 	if err != nil {
 		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
 	}
 
-	accountName, err := getFromFieldData[string](data, fldAccountName)
-	if err != nil {
-		return logical.ErrorResponse(fmt.Sprintf("error while getting account name from data: %s", err)), err
+	if response := b.preflightAccount(clientCtx, accountName); response != nil {
+		closeClient(b, clientCtx.closer)
+		return response, nil
 	}
 
-	ttl := getTTLFromFieldData(data, fldTTL, 1*time.Hour, config.AccountTokenMaxTTL)
+	defaultTTL, maxTTL := config.accountTokenTTLs(b.System())
+	ttl, capped := getCappedTTLFromFieldData(data, fldTTL, defaultTTL, maxTTL)
 
-	return b.getAccountToken(clientCtx, accountName, ttl)
+	response, err := b.getAccountToken(clientCtx, accountName, config.tokenExpiresIn(ttl))
+	if err == nil {
+		config.governLease(response, ttl, maxTTL)
+		addCappedTTLWarning(response, fldTTL, capped, ttl)
+		b.recordIssuedToken(ctx, req, "", response)
+	}
+
+	return response, err
 }
 
 func (b *backend) getAccountToken(
 	clientCtx *accountClientContext,
 	accountName string,
 	ttl time.Duration) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
 	token, err := clientCtx.GenerateToken(accountName, ttl)
 	if err != nil {
 		b.logger.Error(err.Error())
+		return argoCDErrorResponse(err.Error(), err)
+	}
+
+	response := newTokenSecret(accountTokenSecretType, token.metadata.TTL).Response(token.toResponseData(), token.toLeaseData())
+
+	return response, nil
+}
+
+func (b *backend) readAccountTokensCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accountName, err := getFromFieldData[string](data, fldAccountName)
+	if err != nil {
 		return logical.ErrorResponse(err.Error()), err
 	}
 
-	err = clientCtx.closer.Close()
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	records, err := readTokenRecords(ctx, req.Storage, getInstanceFromFieldData(data), b.clients.idPrefix())
 	if err != nil {
 		b.logger.Error(err.Error())
+		return logical.ErrorResponse(err.Error()), err
 	}
-	
-	response := newTokenSecret(accountTokenSecretType, token.metadata.TTL).Response(token.toResponseData(), token.toLeaseData())
 
-	return response, nil
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return b.readAccountTokens(clientCtx, accountName, records)
+}
+
+// readAccountTokens returns the tokens registered in argo cd for the account, with their status
+func (b *backend) readAccountTokens(
+	clientCtx *accountClientContext,
+	accountName string,
+	records tokenRecords) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	acc, err := clientCtx.GetAccount(accountName)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading account(%s): %s", accountName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	now := time.Now()
+	tokens := make([]map[string]interface{}, 0, len(acc.Tokens))
+	for _, token := range acc.Tokens {
+		tokens = append(tokens, tokenInfo(token.Id, token.IssuedAt, token.ExpiresAt, records, now))
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			fldAccountName: accountName,
+			fldTokens:      tokens,
+		},
+	}, nil
 }
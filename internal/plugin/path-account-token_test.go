@@ -61,6 +61,21 @@ func TestGenerateAccountToken(t *testing.T) {
 				a.False(ok)
 			},
 		},
+		{
+			name: "named instance is recorded in the lease",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					createTokenResponse: &account.CreateTokenResponse{Token: "some-dummy-token"},
+				}
+				clientCtx := getTestAccountClientContext(&accountClient)
+				clientCtx.instance = "some-instance"
+				res, err := b.getAccountToken(clientCtx, "some-account", 1*time.Hour)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues("some-instance", res.Data["instance"])
+				a.EqualValues("some-instance", res.Secret.InternalData["instance"])
+			},
+		},
 		{
 			name: "failure",
 			fn: func(t *testing.T) {
@@ -76,3 +91,64 @@ func TestGenerateAccountToken(t *testing.T) {
 		t.Run(test.name, test.fn)
 	}
 }
+
+func TestReadAccountTokens(t *testing.T) {
+	b, _ := getTestBackend(t)
+	now := time.Now()
+	accountClient := testAccountClient{
+		accounts: []*account.Account{
+			{
+				Name: "some-account",
+				Tokens: []*account.Token{
+					{Id: "vault-live", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+					{Id: "vault-expired", IssuedAt: now.Add(-2 * time.Hour).Unix(), ExpiresAt: now.Add(-time.Hour).Unix()},
+					{Id: "vault-revoking", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+					{Id: "manual", IssuedAt: now.Unix()},
+					{Id: "vault-0a1b2c3d-untracked", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+					{Id: "vault-9f8e7d6c-other-mount", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+				},
+			},
+		},
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "tokens with status",
+			fn: func(t *testing.T) {
+				res, err := b.readAccountTokens(getTestAccountClientContext(&accountClient), "some-account", tokenRecords{
+					idPrefix: "vault-0a1b2c3d-",
+					issued:   map[string]bool{"vault-live": true, "vault-expired": true},
+					pending:  map[string]bool{"vault-revoking": true},
+				})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues("some-account", res.Data["account_name"])
+				tokens := res.Data["tokens"].([]map[string]interface{})
+				require.Len(t, tokens, 6)
+				a.Equal("live", tokens[0]["status"])
+				a.Equal(time.Unix(now.Unix(), 0).UTC(), tokens[0]["issued_at"])
+				a.Equal("expired", tokens[1]["status"])
+				a.Equal("revoking", tokens[2]["status"])
+				a.Equal("foreign", tokens[3]["status"])
+				a.True(tokens[3]["expires_at"].(time.Time).IsZero())
+				a.Equal("untracked", tokens[4]["status"])
+				a.Equal("foreign", tokens[5]["status"])
+				a.Equal(false, tokens[5]["plugin_issued"])
+			},
+		},
+		{
+			name: "missing account",
+			fn: func(t *testing.T) {
+				res, err := b.readAccountTokens(getTestAccountClientContext(&accountClient), "missing", tokenRecords{})
+				require.Error(t, err)
+				assert.Equal(t, "not_found", res.Data[fldErrorCode])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
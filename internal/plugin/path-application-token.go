@@ -0,0 +1,164 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const fldApplicationName = "application_name"
+
+// knownApplicationActions are the actions argo cd policies allow on an application
+var knownApplicationActions = []string{"get", "create", "update", "delete", "sync", "override", "action"}
+
+// defaultApplicationActions are the actions allowed by the dynamic roles scoped to an application
+var defaultApplicationActions = []string{"get", "sync"}
+
+var getApplicationTokenSchema = map[string]*framework.FieldSchema{
+	fldApplicationName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Application name`,
+	},
+	fldTTL: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Expires in (default: project_token_default_ttl of the config, max: project_token_max_ttl of the config)`,
+	},
+}
+
+func pathApplicationToken(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("application/%s", framework.GenericNameRegex(fldApplicationName)),
+			Fields:  getApplicationTokenSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.getApplicationTokenCallback,
+					Summary:  "gets a token for the project of an application",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathApplicationSynopsis),
+			HelpDescription: trimHelp(helpPathApplicationDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/application/%s", framework.GenericNameRegex(fldInstance), framework.GenericNameRegex(fldApplicationName)),
+			Fields:  withInstanceField(getApplicationTokenSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.getApplicationTokenCallback,
+					Summary:  "gets a token for the project of an application of a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathApplicationSynopsis),
+			HelpDescription: trimHelp(helpPathApplicationDescription),
+		},
+	}
+}
+
+// applicationActions returns the actions allowed by the dynamic roles of the application tokens,
+// the configs written before they were configurable allow the default actions
+func (c *configEntry) applicationActions() []string {
+	if c.ApplicationActions == nil {
+		return defaultApplicationActions
+	}
+
+	return c.ApplicationActions
+}
+
+// applicationPolicies returns the policy templates of a dynamic role allowing the actions on a single application
+func applicationPolicies(projectName string, applicationName string, actions []string) []string {
+	policies := make([]string, 0, len(actions))
+	for _, action := range actions {
+		policies = append(policies, fmt.Sprintf("applications, %s, %s/%s, allow", action, projectName, applicationName))
+	}
+
+	return policies
+}
+
+func (b *backend) getApplicationTokenCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	applicationName, err := getFromFieldData[string](data, fldApplicationName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	applicationCtx, err := NewApplicationClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new application client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	projectName, err := b.getApplicationProject(applicationCtx, applicationName)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading application(%s): %s", applicationName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	defaultTTL, maxTTL := config.projectTokenTTLs(b.System())
+	ttl, capped := getCappedTTLFromFieldData(data, fldTTL, defaultTTL, maxTTL)
+
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	response, err := b.getApplicationToken(clientCtx, projectName, applicationName, config.ApplicationRole, config.applicationActions(), config.tokenExpiresIn(ttl))
+	if err == nil {
+		config.governLease(response, ttl, maxTTL)
+		addCappedTTLWarning(response, fldTTL, capped, ttl)
+		b.recordIssuedToken(ctx, req, "", response)
+	}
+
+	return response, err
+}
+
+// getApplicationProject returns the project of the application
+func (b *backend) getApplicationProject(clientCtx *applicationClientContext, applicationName string) (string, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	app, err := clientCtx.GetApplication(applicationName)
+	if err != nil {
+		return "", err
+	}
+
+	return app.Spec.Project, nil
+}
+
+// getApplicationToken creates a token for the project role of the config when it is set, otherwise for a dynamic role allowing the actions on the application only
+func (b *backend) getApplicationToken(
+	clientCtx *projectClientContext,
+	projectName string,
+	applicationName string,
+	projectRoleName string,
+	actions []string,
+	ttl time.Duration) (*logical.Response, error) {
+	var response *logical.Response
+	var err error
+	if projectRoleName != "" {
+		response, err = b.getProjectToken(clientCtx, projectName, projectRoleName, ttl)
+	} else {
+		response, err = b.getDynamicProjectToken(clientCtx, projectName, applicationPolicies(projectName, applicationName, actions), ttl)
+	}
+
+	if err == nil && response != nil && response.Data != nil {
+		response.Data[fldApplicationName] = applicationName
+	}
+	// the application is recorded with the token, so the bulk revocations list the lease prefix of its path
+	if err == nil && response != nil && response.Secret != nil {
+		response.Secret.InternalData[fldApplicationName] = applicationName
+	}
+
+	return response, err
+}
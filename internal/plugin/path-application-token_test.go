@@ -0,0 +1,158 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/application"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"net/http"
+	"testing"
+	"time"
+)
+
+// testApplicationClient only implements Get, the other calls of the application service are not used by the plugin
+type testApplicationClient struct {
+	application.ApplicationServiceClient
+	applications []*v1alpha1.Application
+}
+
+func (client *testApplicationClient) Get(ctx context.Context, in *application.ApplicationQuery, opts ...grpc.CallOption) (*v1alpha1.Application, error) {
+	for _, item := range client.applications {
+		if item.Name == in.GetName() {
+			return item, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "applications.argoproj.io \"%s\" not found", in.GetName())
+}
+
+func getTestApplicationClientContext(applicationClient *testApplicationClient) *applicationClientContext {
+	return &applicationClientContext{
+		client:        applicationClient,
+		clientContext: context.Background(),
+		closer:        testCloser{},
+	}
+}
+
+func TestApplicationToken(t *testing.T) {
+	b, s := getTestBackend(t)
+	applicationClient := &testApplicationClient{
+		applications: []*v1alpha1.Application{
+			{ObjectMeta: metav1.ObjectMeta{Name: "app1"}, Spec: v1alpha1.ApplicationSpec{Project: "p1"}},
+		},
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "project of the application",
+			fn: func(t *testing.T) {
+				projectName, err := b.getApplicationProject(getTestApplicationClientContext(applicationClient), "app1")
+				require.NoError(t, err)
+				assert.Equal(t, "p1", projectName)
+
+				_, err = b.getApplicationProject(getTestApplicationClientContext(applicationClient), "missing")
+				require.True(t, isNotFound(err))
+				res, err := argoCDErrorResponse("error while reading application(missing)", err)
+				assert.Equal(t, http.StatusNotFound, getHTTPStatus(res, err))
+			},
+		},
+		{
+			name: "dynamic role scoped to the application",
+			fn: func(t *testing.T) {
+				projectClient := &testProjectClient{
+					projects:            []*v1alpha1.AppProject{getTestProject("p1")},
+					createTokenResponse: &project.ProjectTokenResponse{Token: "some-dummy-token"},
+				}
+				res, err := b.getApplicationToken(getTestProjectClientContext(projectClient), "p1", "app1", "", defaultApplicationActions, time.Hour)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				roles := projectClient.projects[0].Spec.Roles
+				require.Len(t, roles, 1)
+				a := assert.New(t)
+				a.True(isDynamicRole(&roles[0], tokenIdPrefix))
+				a.EqualValues([]string{
+					"p, proj:p1:" + roles[0].Name + ", applications, get, p1/app1, allow",
+					"p, proj:p1:" + roles[0].Name + ", applications, sync, p1/app1, allow",
+				}, roles[0].Policies)
+				a.Equal("app1", res.Data[fldApplicationName])
+				a.Equal("app1", res.Secret.InternalData[fldApplicationName])
+				a.Equal("p1", res.Data[fldProjectName])
+				a.Equal(roles[0].Name, res.Data[fldProjectRoleName])
+			},
+		},
+		{
+			name: "configured project role",
+			fn: func(t *testing.T) {
+				projectClient := &testProjectClient{
+					projects:            []*v1alpha1.AppProject{getTestProject("p1", v1alpha1.ProjectRole{Name: "r1"})},
+					createTokenResponse: &project.ProjectTokenResponse{Token: "some-dummy-token"},
+				}
+				res, err := b.getApplicationToken(getTestProjectClientContext(projectClient), "p1", "app1", "r1", nil, time.Hour)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Empty(projectClient.updateRequests)
+				a.Equal("r1", projectClient.createTokenRequests[0].Role)
+				a.Equal("app1", res.Data[fldApplicationName])
+				a.Equal("app1", res.Secret.InternalData[fldApplicationName])
+				a.Equal("r1", res.Data[fldProjectRoleName])
+				a.Nil(res.Secret.InternalData[fldDynamicRole])
+			},
+		},
+		{
+			name: "role and actions from the config",
+			fn: func(t *testing.T) {
+				r := &logical.Request{Storage: s}
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token"})
+				config := readConfigSuccess(t, r)
+				a := assert.New(t)
+				a.Empty(config.ApplicationRole)
+				a.EqualValues(defaultApplicationActions, config.applicationActions())
+
+				// the configs written before the application actions were configurable allow the default actions
+				config.ApplicationActions = nil
+				a.EqualValues(defaultApplicationActions, config.applicationActions())
+
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "application_project_role": "r1", "application_actions": ""})
+				config = readConfigSuccess(t, r)
+				a.Equal("r1", config.ApplicationRole)
+				a.Empty(config.applicationActions())
+
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "application_actions": "get,override"})
+				config = readConfigSuccess(t, r)
+				a.Empty(config.ApplicationRole)
+				a.EqualValues([]string{"get", "override"}, config.applicationActions())
+			},
+		},
+		{
+			name: "invalid application actions",
+			fn: func(t *testing.T) {
+				r := &logical.Request{Storage: s}
+				updateConfigError(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "application_actions": "get,*"},
+					"invalid application action: action(*) should be one of get, create, update, delete, sync, override, action")
+				updateConfigError(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "application_actions": ""},
+					"application actions should be set when application project role is not")
+			},
+		},
+		{
+			name: "role and actions not taken from the request",
+			fn: func(t *testing.T) {
+				a := assert.New(t)
+				a.NotContains(getApplicationTokenSchema, fldProjectRoleName)
+				a.NotContains(getApplicationTokenSchema, "actions")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
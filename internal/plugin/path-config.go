@@ -4,7 +4,9 @@ import (
 	"context"
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
 	"github.com/hashicorp/vault/sdk/logical"
+	"math"
 	"net/url"
 	"sigs.k8s.io/kustomize/kyaml/errors"
 	"strings"
@@ -13,12 +15,35 @@ import (
 
 const (
 	cfgStorageKey            = "config"
+	cfgStoragePrefix         = "config/"
 	cfgFldArgoCdUrl          = "argo_cd_url"
 	cfgFldAdminToken         = "admin_token"
 	cfgFldAccountTokenMaxTTL = "account_token_max_ttl"
 	cfgFldProjectTokenMaxTTL = "project_token_max_ttl"
+	cfgFldAccountTokenTTL    = "account_token_default_ttl"
+	cfgFldProjectTokenTTL    = "project_token_default_ttl"
 	cfgFldInsecure           = "insecure"
 	cfgFldPlaintext          = "plaintext"
+	cfgFldRootRotationPeriod = "root_rotation_period"
+	cfgFldRootRotatedAt      = "root_rotated_at"
+	cfgFldGCScope            = "gc_scope"
+	cfgFldGCInterval         = "gc_interval"
+	cfgFldGCBatchSize        = "gc_batch_size"
+	cfgFldRetryMaxAttempts   = "retry_max_attempts"
+	cfgFldRetryInitBackoff   = "retry_initial_backoff"
+	cfgFldRetryMaxBackoff    = "retry_max_backoff"
+	cfgFldDiscoveryAccounts  = "discovery_accounts"
+	cfgFldDiscoveryProjects  = "discovery_projects"
+	cfgFldAllowedAccounts    = "allowed_accounts" // deprecated alias of discovery_accounts
+	cfgFldAllowedProjects    = "allowed_projects" // deprecated alias of discovery_projects
+	cfgFldReconcileInterval  = "reconcile_interval"
+	cfgFldLeaseGoverned      = "lease_governed"
+	cfgFldApplicationRole    = "application_project_role"
+	cfgFldApplicationActions = "application_actions"
+	gcScopePlugin            = "plugin"
+	gcScopeAll               = "all"
+	gcScopeLegacy            = "legacy" // tidy only scope of the tokens issued before their ids were prefixed
+	fldInstance              = "instance"
 	fldAccountName           = "account_name"
 	fldProjectName           = "project_name"
 	fldProjectRoleName       = "project_role_name"
@@ -27,27 +52,68 @@ const (
 	fldToken                 = "token"
 	accountTokenSecretType   = "account_token_secret"
 	projectTokenSecretType   = "project_token_secret"
+	defaultTokenTTL          = 1 * time.Hour
+	defaultTokenMaxTTL       = 6 * time.Hour
+	defaultGCInterval        = 1 * time.Hour
+	defaultGCBatchSize       = 100
 )
 
 // configEntry represents the vault config
 type configEntry struct {
-	ArgoCDUrl          string        `json:"argo_cd_url" structs:"argo_cd_url" mapstructure:"argo_cd_url"`
-	AdminToken         string        `json:"admin_token" structs:"admin_token" mapstructure:"admin_token"`
-	AccountTokenMaxTTL time.Duration `json:"account_token_max_ttl" structs:"account_token_max_ttl" mapstructure:"account_token_max_ttl"`
-	ProjectTokenMaxTTL time.Duration `json:"project_token_max_ttl" structs:"project_token_max_ttl" mapstructure:"project_token_max_ttl"`
-	Insecure           bool          `json:"insecure" structs:"insecure" mapstructure:"insecure"`
-	Plaintext          bool          `json:"plaintext" structs:"plaintext" mapstructure:"plaintext"`
+	Instance            string        `json:"instance" structs:"instance" mapstructure:"instance"`
+	ArgoCDUrl           string        `json:"argo_cd_url" structs:"argo_cd_url" mapstructure:"argo_cd_url"`
+	AdminToken          string        `json:"admin_token" structs:"admin_token" mapstructure:"admin_token"`
+	AccountTokenMaxTTL  time.Duration `json:"account_token_max_ttl" structs:"account_token_max_ttl" mapstructure:"account_token_max_ttl"`
+	ProjectTokenMaxTTL  time.Duration `json:"project_token_max_ttl" structs:"project_token_max_ttl" mapstructure:"project_token_max_ttl"`
+	AccountTokenTTL     time.Duration `json:"account_token_default_ttl" structs:"account_token_default_ttl" mapstructure:"account_token_default_ttl"`
+	ProjectTokenTTL     time.Duration `json:"project_token_default_ttl" structs:"project_token_default_ttl" mapstructure:"project_token_default_ttl"`
+	Insecure            bool          `json:"insecure" structs:"insecure" mapstructure:"insecure"`
+	Plaintext           bool          `json:"plaintext" structs:"plaintext" mapstructure:"plaintext"`
+	RootRotationPeriod  time.Duration `json:"root_rotation_period" structs:"root_rotation_period" mapstructure:"root_rotation_period"`
+	RootRotatedAt       time.Time     `json:"root_rotated_at" structs:"root_rotated_at" mapstructure:"root_rotated_at"`
+	GCScope             string        `json:"gc_scope" structs:"gc_scope" mapstructure:"gc_scope"`
+	GCInterval          time.Duration `json:"gc_interval" structs:"gc_interval" mapstructure:"gc_interval"`
+	GCBatchSize         int           `json:"gc_batch_size" structs:"gc_batch_size" mapstructure:"gc_batch_size"`
+	RetryMaxAttempts    int           `json:"retry_max_attempts" structs:"retry_max_attempts" mapstructure:"retry_max_attempts"`
+	RetryInitialBackoff time.Duration `json:"retry_initial_backoff" structs:"retry_initial_backoff" mapstructure:"retry_initial_backoff"`
+	RetryMaxBackoff     time.Duration `json:"retry_max_backoff" structs:"retry_max_backoff" mapstructure:"retry_max_backoff"`
+	DiscoveryAccounts   []string      `json:"discovery_accounts" structs:"discovery_accounts" mapstructure:"discovery_accounts"`
+	DiscoveryProjects   []string      `json:"discovery_projects" structs:"discovery_projects" mapstructure:"discovery_projects"`
+	ReconcileInterval   time.Duration `json:"reconcile_interval" structs:"reconcile_interval" mapstructure:"reconcile_interval"`
+	LeaseGoverned       bool          `json:"lease_governed" structs:"lease_governed" mapstructure:"lease_governed"`
+	ApplicationRole     string        `json:"application_project_role" structs:"application_project_role" mapstructure:"application_project_role"`
+	ApplicationActions  []string      `json:"application_actions" structs:"application_actions" mapstructure:"application_actions"`
+	// AllowedAccounts and AllowedProjects are the discovery filters of the configs written before they were renamed (applyLegacyDiscoveryFilters)
+	AllowedAccounts []string `json:"allowed_accounts,omitempty" structs:"allowed_accounts" mapstructure:"allowed_accounts"`
+	AllowedProjects []string `json:"allowed_projects,omitempty" structs:"allowed_projects" mapstructure:"allowed_projects"`
 }
 
 // toResponse returns the logical response corresponding to the config entry, ensuring that the Admin Token is not exposed
 func (c *configEntry) toResponse() *logical.Response {
 	return &logical.Response{
 		Data: map[string]interface{}{
+			fldInstance:              c.Instance,
 			cfgFldArgoCdUrl:          c.ArgoCDUrl,
 			cfgFldAccountTokenMaxTTL: c.AccountTokenMaxTTL.String(),
 			cfgFldProjectTokenMaxTTL: c.ProjectTokenMaxTTL.String(),
+			cfgFldAccountTokenTTL:    c.AccountTokenTTL.String(),
+			cfgFldProjectTokenTTL:    c.ProjectTokenTTL.String(),
 			cfgFldInsecure:           c.Insecure,
 			cfgFldPlaintext:          c.Plaintext,
+			cfgFldRootRotationPeriod: c.RootRotationPeriod.String(),
+			cfgFldRootRotatedAt:      c.RootRotatedAt,
+			cfgFldGCScope:            c.GCScope,
+			cfgFldGCInterval:         c.GCInterval.String(),
+			cfgFldGCBatchSize:        c.GCBatchSize,
+			cfgFldRetryMaxAttempts:   c.RetryMaxAttempts,
+			cfgFldRetryInitBackoff:   c.RetryInitialBackoff.String(),
+			cfgFldRetryMaxBackoff:    c.RetryMaxBackoff.String(),
+			cfgFldDiscoveryAccounts:  c.DiscoveryAccounts,
+			cfgFldDiscoveryProjects:  c.DiscoveryProjects,
+			cfgFldReconcileInterval:  c.ReconcileInterval.String(),
+			cfgFldLeaseGoverned:      c.LeaseGoverned,
+			cfgFldApplicationRole:    c.ApplicationRole,
+			cfgFldApplicationActions: c.applicationActions(),
 		},
 	}
 }
@@ -63,11 +129,19 @@ var configSchema = map[string]*framework.FieldSchema{
 	},
 	cfgFldAccountTokenMaxTTL: {
 		Type:        framework.TypeDurationSecond,
-		Description: `Max TTL for account tokens`,
+		Description: `Max TTL for account tokens, capped by the max lease ttl of the mount (default: 6h)`,
 	},
 	cfgFldProjectTokenMaxTTL: {
 		Type:        framework.TypeDurationSecond,
-		Description: `Max TTL for project tokens`,
+		Description: `Max TTL for project tokens, capped by the max lease ttl of the mount (default: 6h)`,
+	},
+	cfgFldAccountTokenTTL: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Default TTL for account tokens, capped by account_token_max_ttl (default: 1h or the default lease ttl of the mount if lower)`,
+	},
+	cfgFldProjectTokenTTL: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Default TTL for project tokens, capped by project_token_max_ttl (default: 1h or the default lease ttl of the mount if lower)`,
 	},
 	cfgFldInsecure: {
 		Type:        framework.TypeBool,
@@ -77,19 +151,159 @@ var configSchema = map[string]*framework.FieldSchema{
 		Type:        framework.TypeBool,
 		Description: `Argo CD plaintext communication (This should not be used in production environments)`,
 	},
+	cfgFldRootRotationPeriod: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Period after which the admin token is rotated automatically (default: 0, no automatic rotation)`,
+	},
+	cfgFldGCScope: {
+		Type:        framework.TypeString,
+		Description: `Expired tokens deleted by the garbage collector: plugin (issued by the plugin) or all (default: plugin)`,
+	},
+	cfgFldGCInterval: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Interval between the garbage collector runs, 0 disables it (default: 1h)`,
+	},
+	cfgFldGCBatchSize: {
+		Type:        framework.TypeInt,
+		Description: `Max number of expired tokens deleted by a garbage collector run (default: 100)`,
+	},
+	cfgFldRetryMaxAttempts: {
+		Type:        framework.TypeInt,
+		Description: `Max number of attempts to create a token when argo cd reports a transient error (default: 4)`,
+	},
+	cfgFldRetryInitBackoff: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Wait before the first retry, doubled on every retry (default: 1s)`,
+	},
+	cfgFldRetryMaxBackoff: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Max wait between two retries (default: 10s)`,
+	},
+	cfgFldDiscoveryAccounts: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Accounts listed by the discovery endpoints, glob patterns are supported. Only a display filter, it does not restrict the tokens issued (default: all the accounts)`,
+	},
+	cfgFldDiscoveryProjects: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Projects listed by the discovery endpoints, glob patterns are supported. Only a display filter, it does not restrict the tokens issued (default: all the projects)`,
+	},
+	cfgFldAllowedAccounts: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Deprecated, use discovery_accounts`,
+		Deprecated:  true,
+	},
+	cfgFldAllowedProjects: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Deprecated, use discovery_projects`,
+		Deprecated:  true,
+	},
+	cfgFldReconcileInterval: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Interval between the reconcile runs, 0 disables them (default: 1h)`,
+	},
+	cfgFldLeaseGoverned: {
+		Type:        framework.TypeBool,
+		Description: `Issue tokens without expiry in argo cd, with leases renewable up to the max ttl. Revoking the lease is then the only way to delete the token (default: false)`,
+	},
+	cfgFldApplicationRole: {
+		Type:        framework.TypeString,
+		Description: `Project role the application tokens are created for, in the project of the application (default: a dynamic role scoped to the application)`,
+	},
+	cfgFldApplicationActions: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Actions allowed on the application by the dynamic roles of the application tokens: get, create, update, delete, sync, override or action (default: get,sync)`,
+	},
+}
+
+// instanceSchema is the config schema for the named argo cd instances
+var instanceSchema = withInstanceField(configSchema)
+
+// withInstanceField returns a copy of the schema including the instance field.
+// The instance is only taken from the path, so it is kept out of the schemas of the default instance paths
+func withInstanceField(schema map[string]*framework.FieldSchema) map[string]*framework.FieldSchema {
+	fields := map[string]*framework.FieldSchema{
+		fldInstance: {
+			Type:        framework.TypeString,
+			Description: `Name of the argo cd instance`,
+		},
+	}
+	for k, v := range schema {
+		fields[k] = v
+	}
+
+	return fields
+}
+
+// reservedInstanceNames are the first words of the paths of the default instance and of the config paths,
+// the paths of a named instance taking one of them would be routed to those paths
+var reservedInstanceNames = []string{
+	"account", "accounts", "application", "config", "creds", "introspect", "project", "projects", "reconcile", "reconcile-status",
+	"revocations", "revoke", "roles", "rotate-root", "static-creds", "static-roles", "tidy", "tidy-status", "tokens",
 }
 
-// initFromInputs initializes the entry from partial input data
-func (c *configEntry) initFromInputs(data *framework.FieldData) error {
+// getInstanceFromFieldData returns the instance name from the path, or the default instance ("") if not present
+func getInstanceFromFieldData(data *framework.FieldData) string {
+	instance, err := getFromFieldData[string](data, fldInstance)
+	if err != nil {
+		return ""
+	}
+
+	return instance
+}
+
+// configStorageKey returns the storage key of the config for the given instance
+func configStorageKey(instance string) string {
+	if instance == "" {
+		return cfgStorageKey
+	}
+
+	return cfgStoragePrefix + instance
+}
+
+// isAccountListed returns true if the discovery endpoints list the account, all the accounts are listed when discovery_accounts is empty
+func (c *configEntry) isAccountListed(accountName string) bool {
+	return len(c.DiscoveryAccounts) == 0 || strutil.StrListContainsGlob(c.DiscoveryAccounts, accountName)
+}
+
+// isProjectListed returns true if the discovery endpoints list the project, all the projects are listed when discovery_projects is empty
+func (c *configEntry) isProjectListed(projectName string) bool {
+	return len(c.DiscoveryProjects) == 0 || strutil.StrListContainsGlob(c.DiscoveryProjects, projectName)
+}
+
+// accountTokenTTLs returns the default and max ttls of the account tokens
+func (c *configEntry) accountTokenTTLs(sys logical.SystemView) (time.Duration, time.Duration) {
+	return tokenTTLs(sys, c.AccountTokenTTL, c.AccountTokenMaxTTL)
+}
+
+// projectTokenTTLs returns the default and max ttls of the project tokens
+func (c *configEntry) projectTokenTTLs(sys logical.SystemView) (time.Duration, time.Duration) {
+	return tokenTTLs(sys, c.ProjectTokenTTL, c.ProjectTokenMaxTTL)
+}
+
+// tokenTTLs caps the ttls from the config by the max lease ttl of the mount, which can be tuned after the config was written.
+// Configs written before the default ttls existed default to 1h, lowered to the default lease ttl of the mount as for the new configs
+func tokenTTLs(sys logical.SystemView, defaultTTL time.Duration, maxTTL time.Duration) (time.Duration, time.Duration) {
+	if defaultTTL == 0 {
+		defaultTTL = min(defaultTokenTTL, sys.DefaultLeaseTTL())
+	}
+	maxTTL = min(maxTTL, sys.MaxLeaseTTL())
+
+	return min(defaultTTL, maxTTL), maxTTL
+}
+
+// initFromInputs initializes the entry from partial input data, the token ttls are capped by the lease ttls of the mount.
+// Returns a warning for each requested ttl that was capped
+func (c *configEntry) initFromInputs(data *framework.FieldData, sys logical.SystemView) ([]string, error) {
 	var allErorrs error
 	argoCDURL, err := getFromFieldData[string](data, cfgFldArgoCdUrl)
 	if err != nil {
 		allErorrs = errors.Wrap(err)
 	}
 
-	adminToken, err := getFromFieldData[string](data, cfgFldAdminToken)
-	if err != nil {
-		allErorrs = errors.Wrap(err)
+	// The admin token is only required for the initial config, as it is not known anymore once rotated by the plugin
+	adminToken, adminTokenErr := getFromFieldData[string](data, cfgFldAdminToken)
+	if adminTokenErr != nil && c.AdminToken == "" {
+		allErorrs = errors.Wrap(adminTokenErr)
 	}
 
 	//Explicitly set insecure to false by default if not provided
@@ -104,33 +318,161 @@ func (c *configEntry) initFromInputs(data *framework.FieldData) error {
 		plaintext = false
 	}
 
-	c.AccountTokenMaxTTL = getTTLFromFieldData(data, cfgFldAccountTokenMaxTTL, 6*time.Hour, 12*time.Hour)
-	c.ProjectTokenMaxTTL = getTTLFromFieldData(data, cfgFldProjectTokenMaxTTL, 6*time.Hour, 12*time.Hour)
+	//Explicitly set lease_governed to false by default if not provided
+	leaseGoverned, leaseGovernedErr := getFromFieldData[bool](data, cfgFldLeaseGoverned)
+	if leaseGovernedErr != nil {
+		leaseGoverned = false
+	}
+
+	var warnings []string
+	var capped bool
+	maxLeaseTTL := sys.MaxLeaseTTL()
+	c.AccountTokenMaxTTL, capped = getCappedTTLFromFieldData(data, cfgFldAccountTokenMaxTTL, min(defaultTokenMaxTTL, maxLeaseTTL), maxLeaseTTL)
+	warnings = appendCappedTTLWarning(warnings, cfgFldAccountTokenMaxTTL, capped, c.AccountTokenMaxTTL)
+	c.ProjectTokenMaxTTL, capped = getCappedTTLFromFieldData(data, cfgFldProjectTokenMaxTTL, min(defaultTokenMaxTTL, maxLeaseTTL), maxLeaseTTL)
+	warnings = appendCappedTTLWarning(warnings, cfgFldProjectTokenMaxTTL, capped, c.ProjectTokenMaxTTL)
+
+	//The default ttls are lowered to the default lease ttl of the mount
+	defaultTTL := min(defaultTokenTTL, sys.DefaultLeaseTTL())
+	c.AccountTokenTTL, capped = getCappedTTLFromFieldData(data, cfgFldAccountTokenTTL, defaultTTL, c.AccountTokenMaxTTL)
+	warnings = appendCappedTTLWarning(warnings, cfgFldAccountTokenTTL, capped, c.AccountTokenTTL)
+	c.ProjectTokenTTL, capped = getCappedTTLFromFieldData(data, cfgFldProjectTokenTTL, defaultTTL, c.ProjectTokenMaxTTL)
+	warnings = appendCappedTTLWarning(warnings, cfgFldProjectTokenTTL, capped, c.ProjectTokenTTL)
+
+	c.RootRotationPeriod = getTTLFromFieldData(data, cfgFldRootRotationPeriod, 0, math.MaxInt64)
+	c.GCInterval = getTTLFromFieldData(data, cfgFldGCInterval, defaultGCInterval, math.MaxInt64)
+	c.ReconcileInterval = getTTLFromFieldData(data, cfgFldReconcileInterval, 1*time.Hour, math.MaxInt64)
+	c.RetryInitialBackoff = getTTLFromFieldData(data, cfgFldRetryInitBackoff, defaultRetryInitialBackoff, math.MaxInt64)
+	c.RetryMaxBackoff = getTTLFromFieldData(data, cfgFldRetryMaxBackoff, defaultRetryMaxBackoff, math.MaxInt64)
+
+	//Only delete the expired tokens issued by the plugin by default
+	gcScope, gcScopeErr := getFromFieldData[string](data, cfgFldGCScope)
+	if gcScopeErr != nil {
+		gcScope = gcScopePlugin
+	}
+
+	gcBatchSize, gcBatchSizeErr := getFromFieldData[int](data, cfgFldGCBatchSize)
+	if gcBatchSizeErr != nil {
+		gcBatchSize = defaultGCBatchSize
+	}
+
+	//Create the application tokens for a dynamic role allowing get and sync by default
+	applicationRole, _ := getFromFieldData[string](data, cfgFldApplicationRole)
+	applicationActions, applicationActionsErr := getFromFieldData[[]string](data, cfgFldApplicationActions)
+	if applicationActionsErr != nil {
+		applicationActions = defaultApplicationActions
+	}
+
+	retryMaxAttempts, retryMaxAttemptsErr := getFromFieldData[int](data, cfgFldRetryMaxAttempts)
+	if retryMaxAttemptsErr != nil {
+		retryMaxAttempts = defaultRetryMaxAttempts
+	}
+
+	//List all the accounts and projects by default, the deprecated allow-lists are taken as discovery filters
+	discoveryAccounts, warning := getDiscoveryFilterFromFieldData(data, cfgFldDiscoveryAccounts, cfgFldAllowedAccounts)
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
+
+	discoveryProjects, warning := getDiscoveryFilterFromFieldData(data, cfgFldDiscoveryProjects, cfgFldAllowedProjects)
+	if warning != "" {
+		warnings = append(warnings, warning)
+	}
 
 	if err != nil {
 		allErorrs = errors.Wrap(err)
 	}
 
 	if allErorrs != nil {
-		return allErorrs
+		return nil, allErorrs
 	}
 
-	c.AdminToken = adminToken
+	if adminToken != "" && adminToken != c.AdminToken {
+		warning, err := c.checkAdminTokenReplacement(adminToken)
+		if err != nil {
+			return nil, err
+		}
+		if warning != "" {
+			warnings = append(warnings, warning)
+		}
+		c.AdminToken = adminToken
+		c.RootRotatedAt = time.Time{}
+	}
 	c.ArgoCDUrl = argoCDURL
 	c.Insecure = insecure
 	c.Plaintext = plaintext
+	c.LeaseGoverned = leaseGoverned
+	c.ApplicationRole = applicationRole
+	c.ApplicationActions = applicationActions
+	c.GCScope = gcScope
+	c.GCBatchSize = gcBatchSize
+	c.RetryMaxAttempts = retryMaxAttempts
+	c.DiscoveryAccounts = discoveryAccounts
+	c.DiscoveryProjects = discoveryProjects
+	c.AllowedAccounts = nil
+	c.AllowedProjects = nil
 
-	return c.assertValid()
+	return warnings, c.assertValid()
 }
 
-// getConfig returns the configuration from storage or an empty object if not found
+// getConfig returns the configuration of the default instance from storage
 func getConfig(ctx context.Context, req *logical.Request) (configEntry, error) {
-	return readFromStorage[configEntry](ctx, req.Storage, cfgStorageKey)
+	return getInstanceConfig(ctx, req, "")
+}
+
+// getInstanceConfig returns the configuration of the given instance from storage
+func getInstanceConfig(ctx context.Context, req *logical.Request, instance string) (configEntry, error) {
+	config, err := readFromStorage[configEntry](ctx, req.Storage, configStorageKey(instance))
+	if err == nil {
+		config.applyGCDefaults()
+		config.applyLegacyDiscoveryFilters()
+	}
+
+	return config, err
+}
+
+// getDiscoveryFilterFromFieldData returns the discovery filter from the field, or from its deprecated alias with a warning
+func getDiscoveryFilterFromFieldData(data *framework.FieldData, field string, deprecatedField string) ([]string, string) {
+	if filter, err := getFromFieldData[[]string](data, field); err == nil {
+		return filter, ""
+	}
+
+	if filter, err := getFromFieldData[[]string](data, deprecatedField); err == nil {
+		return filter, fmt.Sprintf("%s is deprecated, use %s: it only filters the discovery endpoints and does not restrict the tokens issued", deprecatedField, field)
+	}
+
+	return nil, ""
+}
+
+// applyLegacyDiscoveryFilters takes the allow-lists of the configs written before they were renamed as their discovery filters
+func (c *configEntry) applyLegacyDiscoveryFilters() {
+	if c.DiscoveryAccounts == nil {
+		c.DiscoveryAccounts = c.AllowedAccounts
+	}
+	if c.DiscoveryProjects == nil {
+		c.DiscoveryProjects = c.AllowedProjects
+	}
+	c.AllowedAccounts = nil
+	c.AllowedProjects = nil
+}
+
+// applyGCDefaults applies the garbage collector defaults to the configs written before the garbage collector existed.
+// Those configs have no gc scope, which is always set since, so a gc interval of 0 is not taken as disabling the garbage collector
+func (c *configEntry) applyGCDefaults() {
+	if c.GCScope != "" {
+		return
+	}
+
+	c.GCScope = gcScopePlugin
+	c.GCInterval = defaultGCInterval
+	if c.GCBatchSize == 0 {
+		c.GCBatchSize = defaultGCBatchSize
+	}
 }
 
 // pathConfigRead implements read on the /config path
-func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
-	cfg, err := getConfig(ctx, req)
+func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	cfg, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
 
 	if err != nil {
 		errMsg := fmt.Sprintf("error while reading config from storage: %s", err)
@@ -142,14 +484,23 @@ func (b *backend) pathConfigRead(ctx context.Context, req *logical.Request, _ *f
 
 // pathConfigWrite implements write on the /config path
 func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	cfg, err := tryReadFromStorage[configEntry](ctx, req.Storage, cfgStorageKey)
+	instance := getInstanceFromFieldData(data)
+	if strutil.StrListContains(reservedInstanceNames, instance) {
+		return logical.ErrorResponse(fmt.Sprintf("instance(%s) is reserved by the paths of the plugin", instance)), nil
+	}
+
+	cfg, err := tryReadFromStorage[configEntry](ctx, req.Storage, configStorageKey(instance))
 	if err != nil {
 		errMsg := fmt.Sprintf("error while reading config from storage: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
 	}
 
-	if err := cfg.initFromInputs(data); err != nil {
+	cfg.Instance = instance
+	existing := cfg
+
+	warnings, err := cfg.initFromInputs(data, b.System())
+	if err != nil {
 		errMsg := fmt.Sprintf("error while init in config: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
@@ -162,13 +513,64 @@ func (b *backend) pathConfigWrite(ctx context.Context, req *logical.Request, dat
 		b.logger.Warn(fmt.Sprintf("ArgoCD server (%s) configured with plaintext communication. This should NOT be used in a production environment!", cfg.ArgoCDUrl))
 	}
 
-	if err := saveToStorage[configEntry](ctx, req.Storage, cfgStorageKey, &cfg); err != nil {
+	if err := retainProfile(ctx, req.Storage, &existing, &cfg, time.Now()); err != nil {
+		errMsg := fmt.Sprintf("error while retaining the previous connection profile: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if err := saveToStorage[configEntry](ctx, req.Storage, configStorageKey(instance), &cfg); err != nil {
 		errMsg := fmt.Sprintf("error while writing config to storage: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
 	}
+	b.clients.invalidate(&existing)
 
-	return cfg.toResponse(), nil
+	response := cfg.toResponse()
+	for _, warning := range warnings {
+		response.AddWarning(warning)
+	}
+
+	return response, nil
+}
+
+// pathConfigList implements list on the /config/ path
+func (b *backend) pathConfigList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	instances, err := req.Storage.List(ctx, cfgStoragePrefix)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing instances from storage: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return logical.ListResponse(instances), nil
+}
+
+// pathConfigDelete implements delete on the /config/instance path
+func (b *backend) pathConfigDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instance := getInstanceFromFieldData(data)
+	existing, err := tryReadFromStorage[configEntry](ctx, req.Storage, configStorageKey(instance))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config(%s) from storage: %s", instance, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	existing.Instance = instance
+	if err := retainProfile(ctx, req.Storage, &existing, nil, time.Now()); err != nil {
+		errMsg := fmt.Sprintf("error while retaining the connection profile: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if err := req.Storage.Delete(ctx, configStorageKey(instance)); err != nil {
+		errMsg := fmt.Sprintf("error while deleting config(%s) from storage: %s", instance, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	b.clients.invalidate(&existing)
+
+	return nil, nil
 }
 
 // pathConfig configures operations on the /config path
@@ -192,6 +594,39 @@ func pathConfig(b *backend) []*framework.Path {
 			HelpSynopsis:    trimHelp(helpPathConfigSynopsis),
 			HelpDescription: trimHelp(helpPathConfigDescription),
 		},
+		{
+			Pattern: "config/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathConfigList,
+					Summary:  "lists the named argo cd instances",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathConfigListSynopsis),
+			HelpDescription: trimHelp(helpPathConfigListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("config/%s", framework.GenericNameRegex(fldInstance)),
+			Fields:  instanceSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback:    b.pathConfigRead,
+					Summary:     "retrieves the configuration of a named argo cd instance",
+					Description: `returns the configuration for the named argo cd instance. Does not expose the API key`,
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback:    b.pathConfigWrite,
+					Summary:     "updates the configuration of a named argo cd instance",
+					Description: `updates the configuration for the named argo cd instance`,
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathConfigDelete,
+					Summary:  "deletes the configuration of a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathConfigSynopsis),
+			HelpDescription: trimHelp(helpPathConfigDescription),
+		},
 	}
 	return paths
 }
@@ -205,5 +640,30 @@ func (c *configEntry) assertValid() error {
 		return fmt.Errorf("invalid argo cd url: argo cd url(%s) should only contain the address without protocol", c.ArgoCDUrl)
 	}
 
+	if c.GCScope != gcScopePlugin && c.GCScope != gcScopeAll {
+		return fmt.Errorf("invalid gc scope: gc scope(%s) should be %s or %s", c.GCScope, gcScopePlugin, gcScopeAll)
+	}
+
+	if c.GCBatchSize <= 0 {
+		return fmt.Errorf("invalid gc batch size: gc batch size(%d) should be greater than 0", c.GCBatchSize)
+	}
+
+	if c.RetryMaxAttempts <= 0 {
+		return fmt.Errorf("invalid retry max attempts: retry max attempts(%d) should be greater than 0", c.RetryMaxAttempts)
+	}
+
+	if c.RetryInitialBackoff > c.RetryMaxBackoff {
+		return fmt.Errorf("invalid retry backoff: retry initial backoff(%s) should not be greater than retry max backoff(%s)", c.RetryInitialBackoff, c.RetryMaxBackoff)
+	}
+
+	if c.ApplicationRole == "" && len(c.ApplicationActions) == 0 {
+		return fmt.Errorf("invalid application actions: application actions should be set when application project role is not")
+	}
+	for _, action := range c.ApplicationActions {
+		if !strutil.StrListContains(knownApplicationActions, action) {
+			return fmt.Errorf("invalid application action: action(%s) should be one of %s", action, strings.Join(knownApplicationActions, ", "))
+		}
+	}
+
 	return nil
 }
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"context"
+	"fmt"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -123,8 +124,18 @@ func TestConfig(t *testing.T) {
 				expected.AdminToken = "some-dummy-token"
 				expected.AccountTokenMaxTTL = 6 * time.Hour
 				expected.ProjectTokenMaxTTL = 6 * time.Hour
+				expected.AccountTokenTTL = 1 * time.Hour
+				expected.ProjectTokenTTL = 1 * time.Hour
 				expected.Plaintext = false
 				expected.Insecure = false
+				expected.GCScope = "plugin"
+				expected.GCInterval = 1 * time.Hour
+				expected.GCBatchSize = 100
+				expected.RetryMaxAttempts = 4
+				expected.RetryInitialBackoff = 1 * time.Second
+				expected.RetryMaxBackoff = 10 * time.Second
+				expected.ReconcileInterval = 1 * time.Hour
+				expected.ApplicationActions = []string{"get", "sync"}
 				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token"})
 				c := readConfigSuccess(t, r)
 				require.EqualValues(t, expected, c)
@@ -156,14 +167,68 @@ func TestConfig(t *testing.T) {
 			},
 		},
 		{
-			name: "ttl_cap",
+			name: "invalid_gc_scope",
+			fn: func(t *testing.T) {
+				updateConfigError(
+					t,
+					b,
+					r,
+					map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "gc_scope": "some-scope"},
+					"invalid gc scope")
+			},
+		},
+		{
+			name: "invalid_gc_batch_size",
+			fn: func(t *testing.T) {
+				updateConfigError(
+					t,
+					b,
+					r,
+					map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "gc_batch_size": 0},
+					"invalid gc batch size")
+			},
+		},
+		{
+			name: "gc_config",
+			fn: func(t *testing.T) {
+				updateConfigSuccess(
+					t,
+					b,
+					r,
+					map[string]interface{}{
+						"argo_cd_url":   "argocd.wfecd.splunk.lol",
+						"admin_token":   "some-dummy-token",
+						"gc_scope":      "all",
+						"gc_interval":   "0",
+						"gc_batch_size": 10,
+					})
+				c := readConfigSuccess(t, r)
+				a := assert.New(t)
+				a.EqualValues("all", c.GCScope)
+				a.EqualValues(0, c.GCInterval)
+				a.EqualValues(10, c.GCBatchSize)
+			},
+		},
+		{
+			name: "invalid_retry_policy",
+			fn: func(t *testing.T) {
+				updateConfigError(
+					t,
+					b,
+					r,
+					map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "retry_max_attempts": 0},
+					"invalid retry max attempts")
+				updateConfigError(
+					t,
+					b,
+					r,
+					map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "retry_initial_backoff": "1m", "retry_max_backoff": "10s"},
+					"invalid retry backoff")
+			},
+		},
+		{
+			name: "retry_config",
 			fn: func(t *testing.T) {
-				expected.ArgoCDUrl = "argocd.wfecd.splunk.lol"
-				expected.AdminToken = "some-dummy-token"
-				expected.AccountTokenMaxTTL = 12 * time.Hour
-				expected.ProjectTokenMaxTTL = 12 * time.Hour
-				expected.Insecure = false
-				expected.Plaintext = false
 				updateConfigSuccess(
 					t,
 					b,
@@ -171,13 +236,136 @@ func TestConfig(t *testing.T) {
 					map[string]interface{}{
 						"argo_cd_url":           "argocd.wfecd.splunk.lol",
 						"admin_token":           "some-dummy-token",
-						"account_token_max_ttl": "50h",
-						"project_token_max_ttl": "40h",
-						"plaintext":             false,
-						"insecure":              false,
+						"retry_max_attempts":    2,
+						"retry_initial_backoff": "2s",
+						"retry_max_backoff":     "1m",
+					})
+				c := readConfigSuccess(t, r)
+				a := assert.New(t)
+				a.EqualValues(2, c.RetryMaxAttempts)
+				a.EqualValues(2*time.Second, c.RetryInitialBackoff)
+				a.EqualValues(time.Minute, c.RetryMaxBackoff)
+			},
+		},
+		{
+			name: "discovery_filters",
+			fn: func(t *testing.T) {
+				updateConfigSuccess(
+					t,
+					b,
+					r,
+					map[string]interface{}{
+						"argo_cd_url":        "argocd.wfecd.splunk.lol",
+						"admin_token":        "some-dummy-token",
+						"discovery_accounts": "ci-*,deployer",
+						"discovery_projects": "team-a",
 					})
 				c := readConfigSuccess(t, r)
+				a := assert.New(t)
+				a.Equal([]string{"ci-*", "deployer"}, c.DiscoveryAccounts)
+				a.Equal([]string{"team-a"}, c.DiscoveryProjects)
+				a.True(c.isAccountListed("ci-build"))
+				a.True(c.isAccountListed("deployer"))
+				a.False(c.isAccountListed("admin"))
+				a.True(c.isProjectListed("team-a"))
+				a.False(c.isProjectListed("team-b"))
+
+				updateConfigSuccess(
+					t,
+					b,
+					r,
+					map[string]interface{}{
+						"argo_cd_url": "argocd.wfecd.splunk.lol",
+					})
+				c = readConfigSuccess(t, r)
+				a.Empty(c.DiscoveryAccounts)
+				a.True(c.isAccountListed("admin"))
+				a.True(c.isProjectListed("team-b"))
+			},
+		},
+		{
+			name: "deprecated allow_lists",
+			fn: func(t *testing.T) {
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Storage:   s,
+					Operation: logical.UpdateOperation,
+					Path:      "config",
+					Data: map[string]interface{}{
+						"argo_cd_url":      "argocd.wfecd.splunk.lol",
+						"allowed_accounts": "ci-*",
+						"allowed_projects": "team-a",
+					},
+				})
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				a := assert.New(t)
+				a.Len(res.Warnings, 2)
+				a.Contains(res.Warnings[0], "allowed_accounts is deprecated, use discovery_accounts")
+				c := readConfigSuccess(t, r)
+				a.Equal([]string{"ci-*"}, c.DiscoveryAccounts)
+				a.Equal([]string{"team-a"}, c.DiscoveryProjects)
+
+				// the allow-lists of the configs written before they were renamed are the discovery filters
+				c = readConfigSuccess(t, r)
+				c.DiscoveryAccounts, c.DiscoveryProjects = nil, nil
+				c.AllowedAccounts, c.AllowedProjects = []string{"deployer"}, []string{"team-b"}
+				require.NoError(t, saveToStorage[configEntry](context.Background(), s, cfgStorageKey, &c))
+				c = readConfigSuccess(t, r)
+				a.Equal([]string{"deployer"}, c.DiscoveryAccounts)
+				a.Equal([]string{"team-b"}, c.DiscoveryProjects)
+				a.Nil(c.AllowedAccounts)
+
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol"})
+				c = readConfigSuccess(t, r)
+				a.Empty(c.DiscoveryAccounts)
+				a.Empty(c.DiscoveryProjects)
+			},
+		},
+		{
+			name: "ttl_cap",
+			fn: func(t *testing.T) {
+				expected.ArgoCDUrl = "argocd.wfecd.splunk.lol"
+				expected.AdminToken = "some-dummy-token"
+				expected.AccountTokenMaxTTL = b.System().MaxLeaseTTL()
+				expected.ProjectTokenMaxTTL = 40 * time.Hour
+				expected.AccountTokenTTL = 30 * time.Hour
+				expected.ProjectTokenTTL = 40 * time.Hour
+				expected.Insecure = false
+				expected.Plaintext = false
+				r.Operation = logical.UpdateOperation
+				r.Path = "config"
+				r.Data = map[string]interface{}{
+					"argo_cd_url":               "argocd.wfecd.splunk.lol",
+					"admin_token":               "some-dummy-token",
+					"account_token_max_ttl":     b.System().MaxLeaseTTL().String() + "1h",
+					"project_token_max_ttl":     "40h",
+					"account_token_default_ttl": "30h",
+					"project_token_default_ttl": "41h",
+					"plaintext":                 false,
+					"insecure":                  false,
+				}
+				res, err := b.HandleRequest(context.Background(), r)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				assert.EqualValues(t, []string{
+					"requested account_token_max_ttl was capped to the max ttl(" + b.System().MaxLeaseTTL().String() + ")",
+					"requested project_token_default_ttl was capped to the max ttl(40h0m0s)",
+				}, res.Warnings)
+				c := readConfigSuccess(t, r)
 				require.EqualValues(t, expected, c)
+
+				// configs written before the default ttls existed, or before the mount was tuned
+				legacy := configEntry{AccountTokenMaxTTL: b.System().MaxLeaseTTL() + time.Hour}
+				defaultTTL, maxTTL := legacy.accountTokenTTLs(b.System())
+				assert.Equal(t, 1*time.Hour, defaultTTL)
+				assert.Equal(t, b.System().MaxLeaseTTL(), maxTTL)
+
+				// the default ttl of the legacy configs is lowered to the default lease ttl of the mount
+				tuned := &logical.StaticSystemView{DefaultLeaseTTLVal: 30 * time.Minute, MaxLeaseTTLVal: 2 * time.Hour}
+				legacy.ProjectTokenMaxTTL = 6 * time.Hour
+				defaultTTL, maxTTL = legacy.projectTokenTTLs(tuned)
+				assert.Equal(t, 30*time.Minute, defaultTTL)
+				assert.Equal(t, 2*time.Hour, maxTTL)
 			},
 		},
 	}
@@ -198,3 +386,128 @@ func TestConfig(t *testing.T) {
 	_, ok := data["admin_token"]
 	a.False(ok)
 }
+
+func TestInstanceConfig(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "named instances",
+			fn: func(t *testing.T) {
+				r.Operation = logical.UpdateOperation
+				r.Path = "config/i1"
+				r.Data = map[string]interface{}{"argo_cd_url": "argocd-1.wfecd.splunk.lol", "admin_token": "some-dummy-token-1"}
+				res, err := b.HandleRequest(context.Background(), r)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				r.Path = "config/i2"
+				r.Data = map[string]interface{}{"argo_cd_url": "argocd-2.wfecd.splunk.lol", "admin_token": "some-dummy-token-2"}
+				res, err = b.HandleRequest(context.Background(), r)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				c, err := getInstanceConfig(context.Background(), r, "i1")
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues("i1", c.Instance)
+				a.EqualValues("argocd-1.wfecd.splunk.lol", c.ArgoCDUrl)
+				a.EqualValues("some-dummy-token-1", c.AdminToken)
+
+				// the default instance is not configured
+				readConfigError(t, r)
+			},
+		},
+		{
+			name: "reserved instance names",
+			fn: func(t *testing.T) {
+				r.Operation = logical.UpdateOperation
+				r.Data = map[string]interface{}{"argo_cd_url": "argocd-1.wfecd.splunk.lol", "admin_token": "some-dummy-token-1"}
+				for _, instance := range []string{"revoke", "tokens", "static-creds"} {
+					r.Path = "config/" + instance
+					res, err := b.HandleRequest(context.Background(), r)
+					require.NoError(t, err)
+					require.ErrorContains(t, res.Error(), fmt.Sprintf("instance(%s) is reserved", instance))
+				}
+			},
+		},
+		{
+			name: "read named instance",
+			fn: func(t *testing.T) {
+				r.Operation = logical.ReadOperation
+				r.Path = "config/i2"
+				r.Data = nil
+				res, err := b.HandleRequest(context.Background(), r)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues("i2", res.Data["instance"])
+				a.EqualValues("argocd-2.wfecd.splunk.lol", res.Data["argo_cd_url"])
+				_, ok := res.Data["admin_token"]
+				a.False(ok)
+			},
+		},
+		{
+			name: "list instances",
+			fn: func(t *testing.T) {
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token"})
+
+				r.Operation = logical.ListOperation
+				r.Path = "config/"
+				r.Data = nil
+				res, err := b.HandleRequest(context.Background(), r)
+				require.NoError(t, err)
+				require.EqualValues(t, []string{"i1", "i2"}, res.Data["keys"])
+			},
+		},
+		{
+			name: "delete instance",
+			fn: func(t *testing.T) {
+				r.Operation = logical.DeleteOperation
+				r.Path = "config/i1"
+				r.Data = nil
+				_, err := b.HandleRequest(context.Background(), r)
+				require.NoError(t, err)
+
+				_, err = getInstanceConfig(context.Background(), r, "i1")
+				require.Error(t, err)
+				c, err := getInstanceConfig(context.Background(), r, "i2")
+				require.NoError(t, err)
+				require.EqualValues(t, "argocd-2.wfecd.splunk.lol", c.ArgoCDUrl)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestConfigAdminToken(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token"})
+	c := readConfigSuccess(t, r)
+	c.RootRotatedAt = time.Now()
+	require.NoError(t, saveToStorage[configEntry](context.Background(), s, cfgStorageKey, &c))
+
+	// the admin token is kept when not provided, e.g. after being rotated by the plugin
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "root_rotation_period": "720h"})
+	c = readConfigSuccess(t, r)
+	a := assert.New(t)
+	a.EqualValues("some-dummy-token", c.AdminToken)
+	a.EqualValues(720*time.Hour, c.RootRotationPeriod)
+	a.False(c.RootRotatedAt.IsZero())
+
+	// the rotated admin token is only replaced by a token issued after the rotation
+	updateConfigError(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-other-token"}, "admin_token can not replace the admin token rotated by the plugin")
+
+	// a new admin token resets the rotation time
+	newer := getTestToken(t, tokenClaims{Subject: "admin:apiKey", IssuedAt: time.Now().Add(time.Minute).Unix()})
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": newer})
+	c = readConfigSuccess(t, r)
+	a.EqualValues(newer, c.AdminToken)
+	a.True(c.RootRotatedAt.IsZero())
+}
@@ -0,0 +1,137 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+var getCredsSchema = map[string]*framework.FieldSchema{
+	fldRoleName: {
+		Type:        framework.TypeString,
+		Description: `Name of the role`,
+	},
+	fldTTL: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Expires in (default: the role default_ttl, max: the role max_ttl)`,
+	},
+}
+
+func pathCreds(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("creds/%s", framework.GenericNameRegex(fldRoleName)),
+			Fields:  getCredsSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.getCredsCallback,
+					Summary:  "gets a token for the argo cd account or project role bound to a role",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.getCredsCallback,
+					Summary:  "gets a token for the argo cd account or project role bound to a role",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathCredsSynopsis),
+			HelpDescription: trimHelp(helpPathCredsDescription),
+		},
+	}
+}
+
+func (b *backend) getCredsCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	role, err := tryReadFromStorage[roleEntry](ctx, req.Storage, roleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if role.Name == "" {
+		return logical.ErrorResponse(fmt.Sprintf("role(%s) does not exist", name)), nil
+	}
+
+	config, err := getInstanceConfig(ctx, req, role.Instance)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if role.isAccountRole() {
+		defaultTTL, maxTTL := config.accountTokenTTLs(b.System())
+		maxTTL = role.maxTTL(maxTTL)
+		ttl, capped := getCappedTTLFromFieldData(data, fldTTL, role.defaultTTL(defaultTTL), maxTTL)
+
+		clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+		if err != nil {
+			errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+			b.logger.Error(errMsg)
+			return logical.ErrorResponse(errMsg), err
+		}
+
+		if response := b.preflightAccount(clientCtx, role.AccountName); response != nil {
+			closeClient(b, clientCtx.closer)
+			return response, nil
+		}
+
+		response, err := b.getAccountToken(clientCtx, role.AccountName, config.tokenExpiresIn(ttl))
+		if err == nil {
+			config.governLease(response, ttl, maxTTL)
+			addCappedTTLWarning(response, fldTTL, capped, ttl)
+			b.recordIssuedToken(ctx, req, role.Name, response)
+		}
+
+		return response, err
+	}
+
+	defaultTTL, maxTTL := config.projectTokenTTLs(b.System())
+	maxTTL = role.maxTTL(maxTTL)
+	ttl, capped := getCappedTTLFromFieldData(data, fldTTL, role.defaultTTL(defaultTTL), maxTTL)
+
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	var response *logical.Response
+	if role.isDynamicProjectRole() {
+		response, err = b.getDynamicProjectToken(clientCtx, role.ProjectName, role.Policies, config.tokenExpiresIn(ttl))
+	} else {
+		response, err = b.getProjectToken(clientCtx, role.ProjectName, role.ProjectRoleName, config.tokenExpiresIn(ttl))
+	}
+	if err == nil {
+		config.governLease(response, ttl, maxTTL)
+		addCappedTTLWarning(response, fldTTL, capped, ttl)
+		b.recordIssuedToken(ctx, req, role.Name, response)
+	}
+
+	return response, err
+}
+
+// defaultTTL returns the default ttl of the role, the default ttl from the config if it is not set
+func (r *roleEntry) defaultTTL(configDefaultTTL time.Duration) time.Duration {
+	if r.DefaultTTL == 0 {
+		return configDefaultTTL
+	}
+
+	return r.DefaultTTL
+}
+
+// maxTTL returns the max ttl of the role capped by the max ttl from the config
+func (r *roleEntry) maxTTL(configMaxTTL time.Duration) time.Duration {
+	if r.MaxTTL == 0 || r.MaxTTL > configMaxTTL {
+		return configMaxTTL
+	}
+
+	return r.MaxTTL
+}
@@ -0,0 +1,78 @@
+package plugin
+
+import (
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestCreds(t *testing.T) {
+	b, s := getTestBackend(t)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "missing role",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.ReadOperation, "creds/missing", nil)
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "role(missing) does not exist")
+			},
+		},
+		{
+			name: "missing config",
+			fn: func(t *testing.T) {
+				_, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{"account_name": "a1"})
+				require.NoError(t, err)
+
+				_, err = roleRequest(b, s, logical.ReadOperation, "creds/r1", nil)
+				require.ErrorContains(t, err, "error while reading the storage entry")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestRoleTTL(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "defaults",
+			fn: func(t *testing.T) {
+				role := roleEntry{AccountName: "a1"}
+				a := assert.New(t)
+				a.EqualValues(1*time.Hour, role.defaultTTL(1*time.Hour))
+				a.EqualValues(6*time.Hour, role.maxTTL(6*time.Hour))
+			},
+		},
+		{
+			name: "role ttls",
+			fn: func(t *testing.T) {
+				role := roleEntry{AccountName: "a1", DefaultTTL: 10 * time.Minute, MaxTTL: 2 * time.Hour}
+				a := assert.New(t)
+				a.EqualValues(10*time.Minute, role.defaultTTL(1*time.Hour))
+				a.EqualValues(2*time.Hour, role.maxTTL(6*time.Hour))
+			},
+		},
+		{
+			name: "role max ttl capped by config",
+			fn: func(t *testing.T) {
+				role := roleEntry{AccountName: "a1", MaxTTL: 24 * time.Hour}
+				a := assert.New(t)
+				a.EqualValues(6*time.Hour, role.maxTTL(6*time.Hour))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
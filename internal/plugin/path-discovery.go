@@ -0,0 +1,252 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	fldEnabled      = "enabled"
+	fldCapabilities = "capabilities"
+	fldDescription  = "description"
+	fldRoles        = "roles"
+	fldPolicies     = "policies"
+	fldGroups       = "groups"
+)
+
+var readProjectSchema = map[string]*framework.FieldSchema{
+	fldProjectName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Project name`,
+	},
+}
+
+func pathDiscovery(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "accounts/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listAccountsCallback,
+					Summary:  "lists the argo cd accounts listed by the discovery filters of the config",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathAccountsListSynopsis),
+			HelpDescription: trimHelp(helpPathAccountsListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/accounts/?$", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(map[string]*framework.FieldSchema{}),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listAccountsCallback,
+					Summary:  "lists the accounts of a named argo cd instance listed by the discovery filters of the config",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathAccountsListSynopsis),
+			HelpDescription: trimHelp(helpPathAccountsListDescription),
+		},
+		{
+			Pattern: "projects/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listProjectsCallback,
+					Summary:  "lists the argo cd projects listed by the discovery filters of the config",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathProjectsListSynopsis),
+			HelpDescription: trimHelp(helpPathProjectsListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/projects/?$", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(map[string]*framework.FieldSchema{}),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.listProjectsCallback,
+					Summary:  "lists the projects of a named argo cd instance listed by the discovery filters of the config",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathProjectsListSynopsis),
+			HelpDescription: trimHelp(helpPathProjectsListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("projects/%s", framework.GenericNameRegex(fldProjectName)),
+			Fields:  readProjectSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readProjectCallback,
+					Summary:  "reads the roles of an argo cd project",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathProjectsReadSynopsis),
+			HelpDescription: trimHelp(helpPathProjectsReadDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/projects/%s", framework.GenericNameRegex(fldInstance), framework.GenericNameRegex(fldProjectName)),
+			Fields:  withInstanceField(readProjectSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readProjectCallback,
+					Summary:  "reads the roles of a project of a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathProjectsReadSynopsis),
+			HelpDescription: trimHelp(helpPathProjectsReadDescription),
+		},
+	}
+}
+
+func (b *backend) listAccountsCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return b.listAccounts(clientCtx, &config)
+}
+
+// listAccounts lists the accounts passing the discovery filters of the config, with their enabled flag and capabilities
+func (b *backend) listAccounts(clientCtx *accountClientContext, config *configEntry) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	accounts, err := clientCtx.ListAccounts()
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing the accounts: %s", err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	names := make([]string, 0, len(accounts))
+	keyInfo := map[string]interface{}{}
+	for _, acc := range accounts {
+		if !config.isAccountListed(acc.Name) {
+			continue
+		}
+		names = append(names, acc.Name)
+		keyInfo[acc.Name] = map[string]interface{}{
+			fldEnabled:      acc.Enabled,
+			fldCapabilities: acc.Capabilities,
+		}
+	}
+
+	return logical.ListResponseWithInfo(names, keyInfo), nil
+}
+
+func (b *backend) listProjectsCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return b.listProjects(clientCtx, &config)
+}
+
+// listProjects lists the projects passing the discovery filters of the config, with their description and role names
+func (b *backend) listProjects(clientCtx *projectClientContext, config *configEntry) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	projects, err := clientCtx.ListProjects()
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing the projects: %s", err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	names := make([]string, 0, len(projects))
+	keyInfo := map[string]interface{}{}
+	for _, proj := range projects {
+		if !config.isProjectListed(proj.Name) {
+			continue
+		}
+
+		roles := make([]string, 0, len(proj.Spec.Roles))
+		for _, role := range proj.Spec.Roles {
+			roles = append(roles, role.Name)
+		}
+
+		names = append(names, proj.Name)
+		keyInfo[proj.Name] = map[string]interface{}{
+			fldDescription: proj.Spec.Description,
+			fldRoles:       roles,
+		}
+	}
+
+	return logical.ListResponseWithInfo(names, keyInfo), nil
+}
+
+func (b *backend) readProjectCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	projectName, err := getFromFieldData[string](data, fldProjectName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if !config.isProjectListed(projectName) {
+		return notListedResponse(fmt.Sprintf("project(%s) is not listed by the discovery filters of the config", projectName))
+	}
+
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return b.readProject(clientCtx, projectName)
+}
+
+// readProject returns the roles of the project with their policies and groups
+func (b *backend) readProject(clientCtx *projectClientContext, projectName string) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	proj, err := clientCtx.GetProject(projectName)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading project(%s): %s", projectName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	roles := map[string]interface{}{}
+	for _, role := range proj.Spec.Roles {
+		roles[role.Name] = map[string]interface{}{
+			fldDescription: role.Description,
+			fldPolicies:    role.Policies,
+			fldGroups:      role.Groups,
+		}
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			fldProjectName: proj.Name,
+			fldDescription: proj.Spec.Description,
+			fldRoles:       roles,
+		},
+	}, nil
+}
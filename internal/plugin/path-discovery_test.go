@@ -0,0 +1,115 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net/http"
+	"testing"
+)
+
+func TestDiscovery(t *testing.T) {
+	b, s := getTestBackend(t)
+	accountClient := testAccountClient{
+		accounts: []*account.Account{
+			{Name: "ci-build", Enabled: true, Capabilities: []string{"apiKey"}},
+			{Name: "ci-deploy", Enabled: false, Capabilities: []string{"login"}},
+			{Name: "admin", Enabled: true, Capabilities: []string{"login", "apiKey"}},
+		},
+	}
+	projectClient := testProjectClient{
+		projects: []*v1alpha1.AppProject{
+			getTestProject("team-a", v1alpha1.ProjectRole{
+				Name:     "deployer",
+				Policies: []string{"p, proj:team-a:deployer, applications, sync, team-a/*, allow"},
+				Groups:   []string{"team-a"},
+			}),
+			getTestProject("team-b"),
+		},
+	}
+	projectClient.projects[0].Spec.Description = "team a"
+	config := configEntry{DiscoveryAccounts: []string{"ci-*"}, DiscoveryProjects: []string{"team-a"}}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "list accounts",
+			fn: func(t *testing.T) {
+				res, err := b.listAccounts(getTestAccountClientContext(&accountClient), &config)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal([]string{"ci-build", "ci-deploy"}, res.Data["keys"])
+				keyInfo := res.Data["key_info"].(map[string]interface{})
+				a.Equal(map[string]interface{}{"enabled": true, "capabilities": []string{"apiKey"}}, keyInfo["ci-build"])
+				a.Equal(map[string]interface{}{"enabled": false, "capabilities": []string{"login"}}, keyInfo["ci-deploy"])
+			},
+		},
+		{
+			name: "list all accounts without discovery filter",
+			fn: func(t *testing.T) {
+				res, err := b.listAccounts(getTestAccountClientContext(&accountClient), &configEntry{})
+				require.NoError(t, err)
+				assert.Len(t, res.Data["keys"], 3)
+			},
+		},
+		{
+			name: "list projects",
+			fn: func(t *testing.T) {
+				res, err := b.listProjects(getTestProjectClientContext(&projectClient), &config)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal([]string{"team-a"}, res.Data["keys"])
+				keyInfo := res.Data["key_info"].(map[string]interface{})
+				a.Equal(map[string]interface{}{"description": "team a", "roles": []string{"deployer"}}, keyInfo["team-a"])
+			},
+		},
+		{
+			name: "read project",
+			fn: func(t *testing.T) {
+				res, err := b.readProject(getTestProjectClientContext(&projectClient), "team-a")
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal("team-a", res.Data["project_name"])
+				roles := res.Data["roles"].(map[string]interface{})
+				a.Equal(map[string]interface{}{
+					"description": "",
+					"policies":    []string{"p, proj:team-a:deployer, applications, sync, team-a/*, allow"},
+					"groups":      []string{"team-a"},
+				}, roles["deployer"])
+			},
+		},
+		{
+			name: "read project outside the discovery filters",
+			fn: func(t *testing.T) {
+				require.NoError(t, saveToStorage[configEntry](context.Background(), s, cfgStorageKey, &config))
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Operation: logical.ReadOperation,
+					Path:      "projects/team-b",
+					Storage:   s,
+				})
+				require.Error(t, err)
+				codedErr, ok := err.(logical.HTTPCodedError)
+				require.True(t, ok)
+				a := assert.New(t)
+				a.EqualValues(http.StatusNotFound, codedErr.Code())
+				a.Contains(res.Error().Error(), "project(team-b) is not listed by the discovery filters of the config")
+			},
+		},
+		{
+			name: "read missing project",
+			fn: func(t *testing.T) {
+				res, err := b.readProject(getTestProjectClientContext(&projectClient), "missing")
+				require.Error(t, err)
+				assert.Equal(t, "not_found", res.Data[fldErrorCode])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,189 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	fldIssuer        = "issuer"
+	fldSubject       = "subject"
+	fldTokenType     = "token_type"
+	fldExists        = "exists"
+	fldIssuedByMount = "issued_by_mount"
+	tokenTypeAccount = "account"
+	tokenTypeProject = "project"
+	tokenTypeUnknown = "unknown"
+)
+
+var introspectSchema = map[string]*framework.FieldSchema{
+	fldToken: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD token to introspect`,
+		DisplayAttrs: &framework.DisplayAttributes{
+			Sensitive: true,
+		},
+	},
+}
+
+func pathIntrospect(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "introspect",
+			Fields:  introspectSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.introspectCallback,
+					Summary:  "decodes an argo cd token and checks whether it still exists",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathIntrospectSynopsis),
+			HelpDescription: trimHelp(helpPathIntrospectDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/introspect", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(introspectSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.introspectCallback,
+					Summary:  "decodes an argo cd token and checks whether it still exists in a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathIntrospectSynopsis),
+			HelpDescription: trimHelp(helpPathIntrospectDescription),
+		},
+	}
+}
+
+// introspectionData returns the claims of the token, with its type and the account or project role it belongs to
+func introspectionData(claims *tokenClaims, now time.Time) map[string]interface{} {
+	data := map[string]interface{}{
+		fldIssuer:       claims.Issuer,
+		fldSubject:      claims.Subject,
+		fldID:           claims.Id,
+		fldIssuedAt:     unixTime(claims.IssuedAt),
+		fldExpiresAt:    unixTime(claims.ExpiresAt),
+		fldExpired:      isExpiredAt(claims.ExpiresAt, now),
+		fldPluginIssued: isPluginTokenId(claims.Id),
+		fldTokenType:    tokenTypeUnknown,
+	}
+
+	if accountName, err := claims.accountName(); err == nil {
+		data[fldTokenType] = tokenTypeAccount
+		data[fldAccountName] = accountName
+	} else if projectName, roleName, err := claims.projectRole(); err == nil {
+		data[fldTokenType] = tokenTypeProject
+		data[fldProjectName] = projectName
+		data[fldProjectRoleName] = roleName
+	}
+
+	return data
+}
+
+func (b *backend) introspectCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	token, err := getFromFieldData[string](data, fldToken)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	claims, err := parseTokenClaims(token)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	response := &logical.Response{Data: introspectionData(&claims, time.Now())}
+
+	// the mount issued the tokens with its id prefix, including the ones whose record is gone,
+	// the tokens it recorded, the tokens of its static roles and its admin token
+	records, err := readTokenRecords(ctx, req.Storage, getInstanceFromFieldData(data), b.clients.idPrefix())
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading the issued token(%s): %s", claims.Id, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	response.Data[fldIssuedByMount] = claims.Id != "" && (records.isMountToken(claims.Id) || claims.Id == config.adminTokenId())
+
+	var exists bool
+	switch response.Data[fldTokenType] {
+	case tokenTypeAccount:
+		clientCtx, clientErr := NewAccountClient(ctx, b.clients, &config)
+		if err = clientErr; err == nil {
+			exists, err = b.accountTokenExists(clientCtx, response.Data[fldAccountName].(string), claims.Id)
+		}
+	case tokenTypeProject:
+		clientCtx, clientErr := NewProjectClient(ctx, b.clients, &config)
+		if err = clientErr; err == nil {
+			exists, err = b.projectTokenExists(clientCtx, response.Data[fldProjectName].(string), response.Data[fldProjectRoleName].(string), &claims)
+		}
+	default:
+		response.AddWarning(fmt.Sprintf("token subject(%s) is neither an account api key nor a project role, its existence cannot be checked", claims.Subject))
+		return response, nil
+	}
+
+	if err != nil {
+		errMsg := fmt.Sprintf("the existence of token(%s) in argo cd cannot be checked: %s", claims.Id, err)
+		b.logger.Warn(errMsg)
+		response.AddWarning(errMsg)
+		return response, nil
+	}
+	response.Data[fldExists] = exists
+
+	return response, nil
+}
+
+// accountTokenExists returns true if the token is registered in argo cd for the account, false if the token or the account does not exist
+func (b *backend) accountTokenExists(clientCtx *accountClientContext, accountName string, id string) (bool, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	acc, err := clientCtx.GetAccount(accountName)
+	if isNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for _, token := range acc.Tokens {
+		if token.Id == id {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// projectTokenExists returns true if the token is registered in argo cd for the project role, false if the token, the role or the project does not exist.
+// Tokens created without id are matched by their issued at time
+func (b *backend) projectTokenExists(clientCtx *projectClientContext, projectName string, roleName string, claims *tokenClaims) (bool, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	proj, err := clientCtx.GetProject(projectName)
+	if isNotFound(err) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+
+	for _, role := range proj.Spec.Roles {
+		if role.Name != roleName {
+			continue
+		}
+		for _, token := range role.JWTTokens {
+			if (claims.Id != "" && token.ID == claims.Id) || (claims.Id == "" && token.IssuedAt == claims.IssuedAt) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
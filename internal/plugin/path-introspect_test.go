@@ -0,0 +1,183 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestIntrospect(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	updateConfigSuccess(t, b, &logical.Request{Storage: s}, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "gc_interval": 0, "reconcile_interval": 0})
+	introspect := func(token string) (*logical.Response, error) {
+		return b.HandleRequest(ctx, &logical.Request{
+			Operation: logical.UpdateOperation,
+			Path:      "introspect",
+			Storage:   s,
+			Data:      map[string]interface{}{fldToken: token},
+		})
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "invalid token",
+			fn: func(t *testing.T) {
+				res, err := introspect("some-dummy-token")
+				require.NoError(t, err)
+				require.True(t, res.IsError())
+				assert.Equal(t, http.StatusBadRequest, getHTTPStatus(res, err))
+			},
+		},
+		{
+			name: "account token",
+			fn: func(t *testing.T) {
+				data := introspectionData(&tokenClaims{
+					Issuer:    "argocd",
+					Subject:   "a1:apiKey",
+					Id:        "vault-1",
+					IssuedAt:  now.Add(-2 * time.Hour).Unix(),
+					ExpiresAt: now.Add(-1 * time.Hour).Unix(),
+				}, now)
+				a := assert.New(t)
+				a.Equal(tokenTypeAccount, data[fldTokenType])
+				a.Equal("a1", data[fldAccountName])
+				a.Equal("argocd", data[fldIssuer])
+				a.Equal("vault-1", data[fldID])
+				a.Equal(true, data[fldExpired])
+				a.Equal(true, data[fldPluginIssued])
+				a.NotContains(data, fldProjectName)
+			},
+		},
+		{
+			name: "project token",
+			fn: func(t *testing.T) {
+				data := introspectionData(&tokenClaims{Subject: "proj:p1:r1", IssuedAt: now.Unix()}, now)
+				a := assert.New(t)
+				a.Equal(tokenTypeProject, data[fldTokenType])
+				a.Equal("p1", data[fldProjectName])
+				a.Equal("r1", data[fldProjectRoleName])
+				a.Equal(false, data[fldExpired])
+				a.Equal(false, data[fldPluginIssued])
+				a.True(data[fldExpiresAt].(time.Time).IsZero())
+			},
+		},
+		{
+			name: "unknown subject issued by the mount",
+			fn: func(t *testing.T) {
+				record := issuedToken{Id: "vault-admin", AccountName: "admin", IssuedAt: now}
+				require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey(record.Id), &record))
+
+				res, err := introspect(getTestToken(t, tokenClaims{Subject: "admin", Id: "vault-admin", IssuedAt: now.Unix()}))
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				a := assert.New(t)
+				a.Equal(tokenTypeUnknown, res.Data[fldTokenType])
+				a.Equal(true, res.Data[fldIssuedByMount])
+				a.NotContains(res.Data, fldExists)
+				a.Len(res.Warnings, 1)
+			},
+		},
+		{
+			name: "account token exists",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{
+					accounts: []*account.Account{{Name: "a1", Tokens: []*account.Token{{Id: "vault-1"}}}},
+				}
+				for id, expected := range map[string]bool{"vault-1": true, "vault-2": false} {
+					exists, err := b.accountTokenExists(getTestAccountClientContext(accountClient), "a1", id)
+					require.NoError(t, err)
+					assert.Equal(t, expected, exists, id)
+				}
+
+				exists, err := b.accountTokenExists(getTestAccountClientContext(accountClient), "a2", "vault-1")
+				require.NoError(t, err)
+				assert.False(t, exists)
+
+				accountClient.getAccountError = status.Error(codes.Unavailable, "argo cd is down")
+				_, err = b.accountTokenExists(getTestAccountClientContext(accountClient), "a1", "vault-1")
+				require.ErrorContains(t, err, "argo cd is down")
+			},
+		},
+		{
+			name: "project token exists",
+			fn: func(t *testing.T) {
+				projectClient := &testProjectClient{
+					projects: []*v1alpha1.AppProject{
+						getTestProject("p1", v1alpha1.ProjectRole{
+							Name:      "r1",
+							JWTTokens: []v1alpha1.JWTToken{{ID: "vault-1", IssuedAt: 1}, {IssuedAt: 2}},
+						}),
+					},
+				}
+				tests := []struct {
+					project, role string
+					claims        tokenClaims
+					expected      bool
+				}{
+					{"p1", "r1", tokenClaims{Id: "vault-1", IssuedAt: 1}, true},
+					{"p1", "r1", tokenClaims{IssuedAt: 2}, true},
+					{"p1", "r1", tokenClaims{IssuedAt: 3}, false},
+					{"p1", "r1", tokenClaims{Id: "vault-2", IssuedAt: 2}, false},
+					{"p1", "r2", tokenClaims{Id: "vault-1", IssuedAt: 1}, false},
+					{"p2", "r1", tokenClaims{Id: "vault-1", IssuedAt: 1}, false},
+				}
+				for _, test := range tests {
+					exists, err := b.projectTokenExists(getTestProjectClientContext(projectClient), test.project, test.role, &test.claims)
+					require.NoError(t, err)
+					assert.Equal(t, test.expected, exists, test)
+				}
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestIntrospectIssuedByMount(t *testing.T) {
+	b, s := getTestMountBackend(t, "0a1b2c3d-4e5f-6a7b-8c9d-0e1f2a3b4c5d", &logical.InmemStorage{})
+	ctx := context.Background()
+	adminToken := getTestToken(t, tokenClaims{Subject: "admin:apiKey", Id: "admin-1", IssuedAt: time.Now().Unix()})
+	updateConfigSuccess(t, b, &logical.Request{Storage: s}, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": adminToken, "gc_interval": 0, "reconcile_interval": 0})
+	require.NoError(t, saveToStorage[staticRoleEntry](ctx, s, staticRoleStorageKey("s1"), &staticRoleEntry{Name: "s1", AccountName: "a1"}))
+	require.NoError(t, saveToStorage[staticCred](ctx, s, staticCredStorageKey("s1"), &staticCred{Id: "vault-static", RotatedAt: time.Now()}))
+
+	tests := []struct {
+		name     string
+		id       string
+		expected bool
+	}{
+		{name: "mount prefix without record", id: "vault-0a1b2c3d-revoked", expected: true},
+		{name: "static role token", id: "vault-static", expected: true},
+		{name: "admin token", id: "admin-1", expected: true},
+		{name: "other mount", id: "vault-9f8e7d6c-other", expected: false},
+		{name: "foreign", id: "manual", expected: false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			res, err := b.HandleRequest(ctx, &logical.Request{
+				Operation: logical.UpdateOperation,
+				Path:      "introspect",
+				Storage:   s,
+				Data:      map[string]interface{}{fldToken: getTestToken(t, tokenClaims{Subject: "some-subject", Id: test.id})},
+			})
+			require.NoError(t, err)
+			require.False(t, res.IsError())
+			assert.Equal(t, test.expected, res.Data[fldIssuedByMount])
+		})
+	}
+}
@@ -20,7 +20,7 @@ var getProjectTokenSchema = map[string]*framework.FieldSchema{
 	},
 	fldTTL: {
 		Type:        framework.TypeDurationSecond,
-		Description: `Expires in (default: 1h, max: 12h)`,
+		Description: `Expires in (default: project_token_default_ttl of the config, max: project_token_max_ttl of the config)`,
 	},
 }
 
@@ -34,6 +34,26 @@ func pathProjectToken(b *backend) []*framework.Path {
 					Callback: b.getProjectTokenCallback,
 					Summary:  "gets a token for a project role",
 				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readProjectRoleTokensCallback,
+					Summary:  "lists the tokens of a project role",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathProjectSynopsis),
+			HelpDescription: trimHelp(helpPathProjectDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/project/%s/role/%s", framework.GenericNameRegex(fldInstance), framework.GenericNameRegex(fldProjectName), framework.GenericNameRegex(fldProjectRoleName)),
+			Fields:  withInstanceField(getProjectTokenSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.getProjectTokenCallback,
+					Summary:  "gets a token for a project role of a named argo cd instance",
+				},
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.readProjectRoleTokensCallback,
+					Summary:  "lists the tokens of a project role of a named argo cd instance",
+				},
 			},
 			HelpSynopsis:    trimHelp(helpPathProjectSynopsis),
 			HelpDescription: trimHelp(helpPathProjectDescription),
@@ -52,23 +72,31 @@ func (b *backend) getProjectTokenCallback(ctx context.Context, req *logical.Requ
 		return logical.ErrorResponse(err.Error()), err
 	}
 
-	config, err := getConfig(ctx, req)
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
 	if err != nil {
 		errMsg := fmt.Sprintf("error while reading config: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
 	}
 
-	ttl := getTTLFromFieldData(data, fldTTL, 1*time.Hour, config.ProjectTokenMaxTTL)
+	defaultTTL, maxTTL := config.projectTokenTTLs(b.System())
+	ttl, capped := getCappedTTLFromFieldData(data, fldTTL, defaultTTL, maxTTL)
 
-	clientCtx, err := NewProjectClient(ctx, &config)
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
 	if err != nil {
 		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
 		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
 	}
 
-	return b.getProjectToken(clientCtx, projectName, projectRoleName, ttl)
+	response, err := b.getProjectToken(clientCtx, projectName, projectRoleName, config.tokenExpiresIn(ttl))
+	if err == nil {
+		config.governLease(response, ttl, maxTTL)
+		addCappedTTLWarning(response, fldTTL, capped, ttl)
+		b.recordIssuedToken(ctx, req, "", response)
+	}
+
+	return response, err
 }
 
 func (b *backend) getProjectToken(
@@ -76,19 +104,90 @@ func (b *backend) getProjectToken(
 	projectName string,
 	projectRoleName string,
 	ttl time.Duration) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
 	token, err := clientCtx.GenerateToken(projectName, projectRoleName, ttl)
 	if err != nil {
 		errMsg := fmt.Sprintf("error while creating a new token for project role(%s/%s): %s", projectName, projectRoleName, err)
 		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	response := newTokenSecret(projectTokenSecretType, token.metadata.TTL).Response(token.toResponseData(), token.toLeaseData())
+
+	return response, nil
+}
+
+func (b *backend) readProjectRoleTokensCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	projectName, err := getFromFieldData[string](data, fldProjectName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	projectRoleName, err := getFromFieldData[string](data, fldProjectRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
 		return logical.ErrorResponse(errMsg), err
 	}
 
-	err = clientCtx.closer.Close()
+	records, err := readTokenRecords(ctx, req.Storage, getInstanceFromFieldData(data), b.clients.idPrefix())
 	if err != nil {
 		b.logger.Error(err.Error())
+		return logical.ErrorResponse(err.Error()), err
 	}
 
-	response := newTokenSecret(projectTokenSecretType, token.metadata.TTL).Response(token.toResponseData(), token.toLeaseData())
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
 
-	return response, nil
+	return b.readProjectRoleTokens(clientCtx, projectName, projectRoleName, records)
+}
+
+// readProjectRoleTokens returns the jwt tokens registered in argo cd for the project role with their status, and the policies of the role
+func (b *backend) readProjectRoleTokens(
+	clientCtx *projectClientContext,
+	projectName string,
+	projectRoleName string,
+	records tokenRecords) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	proj, err := clientCtx.GetProject(projectName)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading project(%s): %s", projectName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	now := time.Now()
+	for _, role := range proj.Spec.Roles {
+		if role.Name != projectRoleName {
+			continue
+		}
+
+		tokens := make([]map[string]interface{}, 0, len(role.JWTTokens))
+		for _, token := range role.JWTTokens {
+			tokens = append(tokens, tokenInfo(token.ID, token.IssuedAt, token.ExpiresAt, records, now))
+		}
+
+		return &logical.Response{
+			Data: map[string]interface{}{
+				fldProjectName:     projectName,
+				fldProjectRoleName: projectRoleName,
+				fldPolicies:        role.Policies,
+				fldGroups:          role.Groups,
+				fldTokens:          tokens,
+			},
+		}, nil
+	}
+
+	return nil, nil
 }
@@ -3,6 +3,7 @@ package plugin
 import (
 	"fmt"
 	"github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -77,3 +78,62 @@ func TestGenerateProjectToken(t *testing.T) {
 		t.Run(test.name, test.fn)
 	}
 }
+
+func TestReadProjectRoleTokens(t *testing.T) {
+	b, _ := getTestBackend(t)
+	now := time.Now()
+	projectClient := testProjectClient{
+		projects: []*v1alpha1.AppProject{
+			getTestProject("some-project", v1alpha1.ProjectRole{
+				Name:     "some-role",
+				Policies: []string{"p, proj:some-project:some-role, applications, get, some-project/*, allow"},
+				JWTTokens: []v1alpha1.JWTToken{
+					{ID: "vault-live", IssuedAt: now.Unix(), ExpiresAt: now.Add(time.Hour).Unix()},
+					{ID: "manual-expired", IssuedAt: now.Add(-2 * time.Hour).Unix(), ExpiresAt: now.Add(-time.Hour).Unix()},
+				},
+			}),
+		},
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "tokens and policies",
+			fn: func(t *testing.T) {
+				res, err := b.readProjectRoleTokens(getTestProjectClientContext(&projectClient), "some-project", "some-role", tokenRecords{idPrefix: tokenIdPrefix, issued: map[string]bool{"vault-live": true}})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal([]string{"p, proj:some-project:some-role, applications, get, some-project/*, allow"}, res.Data["policies"])
+				tokens := res.Data["tokens"].([]map[string]interface{})
+				require.Len(t, tokens, 2)
+				a.Equal("live", tokens[0]["status"])
+				a.Equal(true, tokens[0]["plugin_issued"])
+				a.Equal(false, tokens[0]["expired"])
+				a.Equal("foreign", tokens[1]["status"])
+				a.Equal(false, tokens[1]["plugin_issued"])
+				a.Equal(true, tokens[1]["expired"])
+			},
+		},
+		{
+			name: "missing role",
+			fn: func(t *testing.T) {
+				res, err := b.readProjectRoleTokens(getTestProjectClientContext(&projectClient), "some-project", "missing", tokenRecords{})
+				require.NoError(t, err)
+				require.Nil(t, res)
+			},
+		},
+		{
+			name: "missing project",
+			fn: func(t *testing.T) {
+				res, err := b.readProjectRoleTokens(getTestProjectClientContext(&projectClient), "missing", "some-role", tokenRecords{})
+				require.Error(t, err)
+				assert.Equal(t, "not_found", res.Data[fldErrorCode])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,146 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	reconcileStatusKey = "reconcile-status"
+	fldDeleteOrphans   = "delete_orphans"
+)
+
+var reconcileSchema = map[string]*framework.FieldSchema{
+	fldDeleteOrphans: {
+		Type:        framework.TypeBool,
+		Description: `Delete the orphan tokens from argo cd (default: false, the orphans are only reported)`,
+	},
+}
+
+func reconcileStatusStorageKey(instance string) string {
+	if instance == "" {
+		return reconcileStatusKey
+	}
+
+	return reconcileStatusKey + "/" + instance
+}
+
+func (report *reconcileReport) toResponse() *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"started_at":      report.StartedAt,
+			"duration":        report.Duration.String(),
+			fldDeleteOrphans:  report.DeleteOrphans,
+			"orphans":         report.Orphans,
+			"ghosts":          report.Ghosts,
+			"deleted_orphans": report.DeletedOrphans,
+			"errors":          report.Errors,
+		},
+	}
+}
+
+func pathReconcile(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "reconcile",
+			Fields:  reconcileSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathReconcileCallback,
+					Summary:  "reconciles the issued tokens with the tokens in argo cd",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathReconcileSynopsis),
+			HelpDescription: trimHelp(helpPathReconcileDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/reconcile", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(reconcileSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathReconcileCallback,
+					Summary:  "reconciles the issued tokens with the tokens in a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathReconcileSynopsis),
+			HelpDescription: trimHelp(helpPathReconcileDescription),
+		},
+		{
+			Pattern: "reconcile-status",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReconcileStatusCallback,
+					Summary:  "reports the last reconcile run",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathReconcileStatusSynopsis),
+			HelpDescription: trimHelp(helpPathReconcileStatusDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/reconcile-status", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(map[string]*framework.FieldSchema{}),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathReconcileStatusCallback,
+					Summary:  "reports the last reconcile run of a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathReconcileStatusSynopsis),
+			HelpDescription: trimHelp(helpPathReconcileStatusDescription),
+		},
+	}
+}
+
+func (b *backend) pathReconcileCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	deleteOrphans, _ := getFromFieldData[bool](data, fldDeleteOrphans)
+
+	accountCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	defer closeClient(b, accountCtx.closer)
+
+	projectCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	defer closeClient(b, projectCtx.closer)
+
+	report, err := b.reconcile(ctx, req.Storage, config.Instance, config.adminTokenId(), accountCtx, projectCtx, deleteOrphans)
+	if err != nil {
+		b.logger.Error(err.Error())
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	return report.toResponse(), nil
+}
+
+func (b *backend) pathReconcileStatusCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instance := getInstanceFromFieldData(data)
+	report, err := tryReadFromStorage[reconcileReport](ctx, req.Storage, reconcileStatusStorageKey(instance))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading reconcile status from storage: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if report.StartedAt.IsZero() {
+		return nil, nil
+	}
+
+	return report.toResponse(), nil
+}
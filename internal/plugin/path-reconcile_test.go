@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func readReconcileStatus(t *testing.T, b *backend, s logical.Storage, path string) *logical.Response {
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ReadOperation,
+		Path:      path,
+		Storage:   s,
+	})
+	require.NoError(t, err)
+	return res
+}
+
+func TestReconcile(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "no status before the first run",
+			fn: func(t *testing.T) {
+				require.Nil(t, readReconcileStatus(t, b, s, "reconcile-status"))
+			},
+		},
+		{
+			name: "only the records of the instance are reconciled",
+			fn: func(t *testing.T) {
+				for _, record := range getTestReconcileRecords(now) {
+					record := record
+					require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey(record.Id), &record))
+				}
+				other := issuedToken{Id: "vault-other", Instance: "i1", AccountName: "a1", IssuedAt: now.Add(-time.Hour)}
+				require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey(other.Id), &other))
+
+				accountClient, projectClient := getTestReconcileClients(now)
+				report, err := b.reconcile(ctx, s, "", "", getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), false)
+				require.NoError(t, err)
+				assert.Len(t, report.Ghosts, 2)
+			},
+		},
+		{
+			name: "status of the last run",
+			fn: func(t *testing.T) {
+				res := readReconcileStatus(t, b, s, "reconcile-status")
+				require.NotNil(t, res)
+				a := assert.New(t)
+				a.Len(res.Data["orphans"], 2)
+				a.Len(res.Data["ghosts"], 2)
+				a.Equal(false, res.Data[fldDeleteOrphans])
+				require.Nil(t, readReconcileStatus(t, b, s, "i1/reconcile-status"))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
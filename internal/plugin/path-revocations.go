@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	pendingRevocationsStoragePrefix = "revocations/pending/"
+	revocationInitialBackoff        = 1 * time.Minute
+	revocationMaxBackoff            = 1 * time.Hour
+)
+
+// pendingRevocation is a token deletion that failed when vault revoked its lease, retried from the periodic func
+type pendingRevocation struct {
+	Id            string                 `json:"id"`
+	SecretType    string                 `json:"secret_type"`
+	LeaseData     map[string]interface{} `json:"lease_data"`
+	ExpiresAt     time.Time              `json:"expires_at"`
+	QueuedAt      time.Time              `json:"queued_at"`
+	Attempts      int                    `json:"attempts"`
+	NextAttemptAt time.Time              `json:"next_attempt_at"`
+	LastError     string                 `json:"last_error"`
+}
+
+func pendingRevocationStorageKey(id string) string {
+	return pendingRevocationsStoragePrefix + id
+}
+
+// expired returns true once the token expired in argo cd. Tokens without expiry never expire
+func (rev *pendingRevocation) expired(now time.Time) bool {
+	return !rev.ExpiresAt.IsZero() && now.After(rev.ExpiresAt)
+}
+
+// scheduleRetry records the failed attempt and backs off exponentially, up to revocationMaxBackoff
+func (rev *pendingRevocation) scheduleRetry(now time.Time, err error) {
+	backoff := revocationInitialBackoff
+	for i := 0; i < rev.Attempts && backoff < revocationMaxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > revocationMaxBackoff {
+		backoff = revocationMaxBackoff
+	}
+
+	rev.Attempts++
+	rev.LastError = err.Error()
+	rev.NextAttemptAt = now.Add(backoff)
+}
+
+func (rev *pendingRevocation) keyInfo() map[string]interface{} {
+	info := map[string]interface{}{
+		"secret_type":     rev.SecretType,
+		fldInstance:       getInstanceFromData(rev.LeaseData),
+		"reason":          rev.LastError,
+		"attempts":        rev.Attempts,
+		"queued_at":       rev.QueuedAt,
+		"next_attempt_at": rev.NextAttemptAt,
+		"expires_at":      rev.ExpiresAt,
+	}
+	for _, attr := range []string{fldAccountName, fldProjectName, fldProjectRoleName} {
+		if value, err := getFromData[string](rev.LeaseData, attr); err == nil {
+			info[attr] = value
+		}
+	}
+
+	return info
+}
+
+func pathRevocations(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "revocations/pending/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathPendingRevocationsList,
+					Summary:  "lists the token deletions that failed and are retried",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathPendingRevocationsSynopsis),
+			HelpDescription: trimHelp(helpPathPendingRevocationsDescription),
+		},
+	}
+}
+
+func (b *backend) pathPendingRevocationsList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	ids, err := req.Storage.List(ctx, pendingRevocationsStoragePrefix)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing the pending revocations: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	keyInfo := map[string]interface{}{}
+	for _, id := range ids {
+		rev, err := tryReadFromStorage[pendingRevocation](ctx, req.Storage, pendingRevocationStorageKey(id))
+		if err != nil {
+			errMsg := fmt.Sprintf("error while reading the pending revocation(%s): %s", id, err)
+			b.logger.Error(errMsg)
+			return logical.ErrorResponse(errMsg), err
+		}
+		keyInfo[id] = rev.keyInfo()
+	}
+
+	return logical.ListResponseWithInfo(ids, keyInfo), nil
+}
+
+// queueRevocation saves the failed token deletion so it is retried from the periodic func, and acknowledges the revocation to vault.
+// The revocation error is returned to vault only when the deletion cannot be queued
+func (b *backend) queueRevocation(ctx context.Context, req *logical.Request, secretType string, id string, revokeErr error) (*logical.Response, error) {
+	now := time.Now()
+	rev := pendingRevocation{
+		Id:            id,
+		SecretType:    secretType,
+		LeaseData:     req.Secret.InternalData,
+		QueuedAt:      now,
+		LastError:     revokeErr.Error(),
+		NextAttemptAt: now,
+	}
+	// the lease governed tokens never expire in argo cd, their deletion is retried until it succeeds
+	if !req.Secret.IssueTime.IsZero() && req.Secret.TTL > 0 && !isLeaseGoverned(req.Secret.InternalData) {
+		rev.ExpiresAt = req.Secret.IssueTime.Add(req.Secret.TTL)
+	}
+
+	if err := saveToStorage[pendingRevocation](ctx, req.Storage, pendingRevocationStorageKey(id), &rev); err != nil {
+		errMsg := fmt.Sprintf("error while queueing the revocation of token(%s): %s, revocation error: %s", id, err, revokeErr)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), revokeErr
+	}
+
+	b.logger.Warn(fmt.Sprintf("revocation of token(%s) failed and is queued for retry: %s", id, revokeErr))
+
+	return nil, nil
+}
+
+// revokePending deletes the token of the pending revocation from the argo cd server that issued it
+func (b *backend) revokePending(ctx context.Context, req *logical.Request, rev *pendingRevocation) error {
+	switch rev.SecretType {
+	case accountTokenSecretType:
+		return b.revokeAccountToken(ctx, req, rev.LeaseData)
+	case projectTokenSecretType:
+		return b.revokeProjectToken(ctx, req, rev.LeaseData)
+	default:
+		return fmt.Errorf("unknown secret type(%s)", rev.SecretType)
+	}
+}
+
+// retryPendingRevocations retries the pending revocations that are due.
+// A revocation is dropped once it succeeds, or once the token expired in argo cd after at least one retry,
+// the garbage collector then deletes the expired token
+func (b *backend) retryPendingRevocations(
+	ctx context.Context,
+	req *logical.Request,
+	revoke func(ctx context.Context, req *logical.Request, rev *pendingRevocation) error) error {
+	ids, err := req.Storage.List(ctx, pendingRevocationsStoragePrefix)
+	if err != nil {
+		return fmt.Errorf("error while listing the pending revocations: %s", err)
+	}
+
+	for _, id := range ids {
+		key := pendingRevocationStorageKey(id)
+		rev, err := tryReadFromStorage[pendingRevocation](ctx, req.Storage, key)
+		if err != nil {
+			b.logger.Error(fmt.Sprintf("error while reading the pending revocation(%s): %s", id, err))
+			continue
+		}
+
+		now := time.Now()
+		if rev.Attempts > 0 && rev.expired(now) {
+			b.logger.Warn(fmt.Sprintf("giving up on the revocation of token(%s) as it expired, last error: %s", id, rev.LastError))
+			if err := req.Storage.Delete(ctx, key); err != nil {
+				b.logger.Error(fmt.Sprintf("error while deleting the pending revocation(%s): %s", id, err))
+			}
+			b.forgetIssuedToken(ctx, req.Storage, id)
+			continue
+		}
+
+		if now.Before(rev.NextAttemptAt) {
+			continue
+		}
+
+		if err := revoke(ctx, req, &rev); err != nil {
+			rev.scheduleRetry(now, err)
+			if err := saveToStorage[pendingRevocation](ctx, req.Storage, key, &rev); err != nil {
+				b.logger.Error(fmt.Sprintf("error while saving the pending revocation(%s): %s", id, err))
+			}
+			continue
+		}
+
+		b.logger.Info(fmt.Sprintf("revoked token(%s) after %d retries", id, rev.Attempts+1))
+		if err := req.Storage.Delete(ctx, key); err != nil {
+			b.logger.Error(fmt.Sprintf("error while deleting the pending revocation(%s): %s", id, err))
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,170 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func revokeRequest(s logical.Storage, leaseData map[string]interface{}, ttl time.Duration) *logical.Request {
+	secret := &logical.Secret{InternalData: leaseData}
+	secret.IssueTime = time.Now()
+	secret.TTL = ttl
+	return &logical.Request{Storage: s, Secret: secret}
+}
+
+func listPendingRevocations(t *testing.T, b *backend, s logical.Storage) *logical.Response {
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: logical.ListOperation,
+		Path:      "revocations/pending",
+		Storage:   s,
+	})
+	require.NoError(t, err)
+	return res
+}
+
+func TestQueueRevocation(t *testing.T) {
+	b, s := getTestBackend(t)
+
+	// without config the deletion fails and is queued
+	res, err := b.deleteAccountTokenCallback(context.Background(), revokeRequest(s, map[string]interface{}{
+		fldID:          "vault-account-id",
+		fldAccountName: "some-account",
+	}, time.Hour), nil)
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	res, err = b.deleteProjectTokenCallback(context.Background(), revokeRequest(s, map[string]interface{}{
+		fldID:              "vault-project-id",
+		fldInstance:        "i1",
+		fldProjectName:     "some-project",
+		fldProjectRoleName: "some-role",
+	}, 0), nil)
+	require.NoError(t, err)
+	require.Nil(t, res)
+
+	res = listPendingRevocations(t, b, s)
+	a := assert.New(t)
+	a.EqualValues([]string{"vault-account-id", "vault-project-id"}, res.Data["keys"])
+	keyInfo := res.Data["key_info"].(map[string]interface{})
+
+	accountInfo := keyInfo["vault-account-id"].(map[string]interface{})
+	a.EqualValues(accountTokenSecretType, accountInfo["secret_type"])
+	a.EqualValues("some-account", accountInfo[fldAccountName])
+	a.EqualValues(0, accountInfo["attempts"])
+	a.Contains(accountInfo["reason"], "error while reading config")
+	a.WithinDuration(time.Now().Add(time.Hour), accountInfo["expires_at"].(time.Time), time.Minute)
+
+	projectInfo := keyInfo["vault-project-id"].(map[string]interface{})
+	a.EqualValues(projectTokenSecretType, projectInfo["secret_type"])
+	a.EqualValues("i1", projectInfo[fldInstance])
+	a.EqualValues("some-role", projectInfo[fldProjectRoleName])
+	a.True(projectInfo["expires_at"].(time.Time).IsZero())
+
+	// a lease without token id is not queued
+	_, err = b.deleteAccountTokenCallback(context.Background(), revokeRequest(s, map[string]interface{}{
+		fldAccountName: "some-account",
+	}, time.Hour), nil)
+	require.Error(t, err)
+}
+
+func TestRetryPendingRevocations(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	ctx := context.Background()
+
+	var revoked []string
+	revokeErr := fmt.Errorf("argo cd unavailable")
+	failure := func(_ context.Context, _ *logical.Request, rev *pendingRevocation) error {
+		revoked = append(revoked, rev.Id)
+		return revokeErr
+	}
+	success := func(_ context.Context, _ *logical.Request, rev *pendingRevocation) error {
+		revoked = append(revoked, rev.Id)
+		return nil
+	}
+
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "failure is retried with backoff",
+			fn: func(t *testing.T) {
+				_, err := b.queueRevocation(ctx, revokeRequest(s, map[string]interface{}{fldID: "id-1"}, time.Hour), accountTokenSecretType, "id-1", revokeErr)
+				require.NoError(t, err)
+
+				revoked = nil
+				require.NoError(t, b.retryPendingRevocations(ctx, r, failure))
+				a := assert.New(t)
+				a.EqualValues([]string{"id-1"}, revoked)
+
+				rev, err := readFromStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey("id-1"))
+				require.NoError(t, err)
+				a.EqualValues(1, rev.Attempts)
+				a.EqualValues(revokeErr.Error(), rev.LastError)
+				a.WithinDuration(time.Now().Add(revocationInitialBackoff), rev.NextAttemptAt, 10*time.Second)
+
+				// not due yet
+				revoked = nil
+				require.NoError(t, b.retryPendingRevocations(ctx, r, success))
+				a.Empty(revoked)
+
+				rev.NextAttemptAt = time.Now().Add(-time.Second)
+				require.NoError(t, saveToStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey("id-1"), &rev))
+				require.NoError(t, b.retryPendingRevocations(ctx, r, success))
+				a.EqualValues([]string{"id-1"}, revoked)
+				a.Empty(listPendingRevocations(t, b, s).Data)
+			},
+		},
+		{
+			name: "expired token is dropped after a retry",
+			fn: func(t *testing.T) {
+				req := revokeRequest(s, map[string]interface{}{fldID: "id-2"}, time.Second)
+				req.Secret.IssueTime = time.Now().Add(-time.Hour)
+				_, err := b.queueRevocation(ctx, req, accountTokenSecretType, "id-2", revokeErr)
+				require.NoError(t, err)
+
+				// retried once even though it already expired
+				revoked = nil
+				require.NoError(t, b.retryPendingRevocations(ctx, r, failure))
+				a := assert.New(t)
+				a.EqualValues([]string{"id-2"}, revoked)
+
+				revoked = nil
+				require.NoError(t, b.retryPendingRevocations(ctx, r, failure))
+				a.Empty(revoked)
+				a.Empty(listPendingRevocations(t, b, s).Data)
+			},
+		},
+		{
+			name: "unknown secret type",
+			fn: func(t *testing.T) {
+				rev := pendingRevocation{Id: "id-3", SecretType: "some-type"}
+				require.ErrorContains(t, b.revokePending(ctx, r, &rev), "unknown secret type")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestScheduleRetry(t *testing.T) {
+	now := time.Now()
+	rev := pendingRevocation{}
+	a := assert.New(t)
+	for _, backoff := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		rev.scheduleRetry(now, fmt.Errorf("some error"))
+		a.EqualValues(now.Add(backoff), rev.NextAttemptAt)
+	}
+
+	rev.Attempts = 20
+	rev.scheduleRetry(now, fmt.Errorf("some error"))
+	a.EqualValues(now.Add(revocationMaxBackoff), rev.NextAttemptAt)
+}
@@ -0,0 +1,428 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/helper/strutil"
+	"github.com/hashicorp/vault/sdk/logical"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// revokeConcurrency is the max number of token deletions in flight during a bulk revocation
+	revokeConcurrency      = 8
+	fldPluginIssuedOnly    = "plugin_issued_only"
+	fldLeasePrefixes       = "lease_prefixes"
+	fldDeleted             = "deleted"
+	fldFailed              = "failed"
+	fldError               = "error"
+	revokeStatusDeleted    = "deleted"
+	revokeStatusNotFound   = "already_deleted"
+	revokeStatusFailed     = "failed"
+	revokeStatusSkipped    = "skipped"
+	fldSkipped             = "skipped"
+	fldLeasesRevoked       = "leases_revoked"
+	bulkRevokeLeaseWarning = "vault leases cannot be revoked by the plugin, revoke them with vault lease revoke -prefix on the lease_prefixes. " +
+		"The tokens are already deleted from argo cd, the revocation of their leases succeeds"
+	// adminTokenSkipMessage is the error of the admin token in the results, it is kept so the plugin keeps its access to argo cd
+	adminTokenSkipMessage = "the admin token of the config is not deleted"
+)
+
+// revokedToken is the result of the deletion of a token during a bulk revocation
+type revokedToken struct {
+	id           string
+	iat          int64
+	pluginIssued bool
+	status       string
+	err          error
+}
+
+func (token *revokedToken) toResponseData() map[string]interface{} {
+	data := map[string]interface{}{
+		fldID:           token.id,
+		fldIssuedAt:     unixTime(token.iat),
+		fldPluginIssued: token.pluginIssued,
+		fldStatus:       token.status,
+	}
+	if token.err != nil {
+		data[fldError] = token.err.Error()
+	}
+
+	return data
+}
+
+var revokeAccountSchema = map[string]*framework.FieldSchema{
+	fldAccountName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Account name`,
+	},
+	fldPluginIssuedOnly: {
+		Type:        framework.TypeBool,
+		Description: `Only revoke the tokens issued by the plugin (default: false, all the tokens are revoked)`,
+	},
+}
+
+var revokeProjectSchema = map[string]*framework.FieldSchema{
+	fldProjectName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Project name`,
+	},
+	fldProjectRoleName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Project Role name`,
+	},
+	fldPluginIssuedOnly: {
+		Type:        framework.TypeBool,
+		Description: `Only revoke the tokens issued by the plugin (default: false, all the tokens are revoked)`,
+	},
+}
+
+func pathRevoke(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: fmt.Sprintf("revoke/account/%s", framework.GenericNameRegex(fldAccountName)),
+			Fields:  revokeAccountSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.revokeAccountTokensCallback,
+					Summary:  "deletes all the tokens of an argo cd account from argo cd, without revoking their vault leases",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRevokeSynopsis),
+			HelpDescription: trimHelp(helpPathRevokeDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/revoke/account/%s", framework.GenericNameRegex(fldInstance), framework.GenericNameRegex(fldAccountName)),
+			Fields:  withInstanceField(revokeAccountSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.revokeAccountTokensCallback,
+					Summary:  "deletes all the tokens of an argo cd account of a named argo cd instance, without revoking their vault leases",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRevokeSynopsis),
+			HelpDescription: trimHelp(helpPathRevokeDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("revoke/project/%s/role/%s", framework.GenericNameRegex(fldProjectName), framework.GenericNameRegex(fldProjectRoleName)),
+			Fields:  revokeProjectSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.revokeProjectRoleTokensCallback,
+					Summary:  "deletes all the tokens of a project role from argo cd, without revoking their vault leases",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRevokeSynopsis),
+			HelpDescription: trimHelp(helpPathRevokeDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/revoke/project/%s/role/%s", framework.GenericNameRegex(fldInstance), framework.GenericNameRegex(fldProjectName), framework.GenericNameRegex(fldProjectRoleName)),
+			Fields:  withInstanceField(revokeProjectSchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.revokeProjectRoleTokensCallback,
+					Summary:  "deletes all the tokens of a project role of a named argo cd instance, without revoking their vault leases",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRevokeSynopsis),
+			HelpDescription: trimHelp(helpPathRevokeDescription),
+		},
+	}
+}
+
+func (b *backend) revokeAccountTokensCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	accountName, err := getFromFieldData[string](data, fldAccountName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+	pluginIssuedOnly, _ := getFromFieldData[bool](data, fldPluginIssuedOnly)
+	instance := getInstanceFromFieldData(data)
+
+	config, err := getInstanceConfig(ctx, req, instance)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	tokens, err := b.revokeAccountTokens(clientCtx, accountName, pluginIssuedOnly, config.adminTokenId())
+	if err != nil {
+		errMsg := fmt.Sprintf("error while revoking the tokens of account(%s): %s", accountName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	prefixes, err := leasePrefixes(ctx, req, instance, "account/"+accountName, func(role *roleEntry) bool {
+		return role.AccountName == accountName
+	}, issuedTokenFilters{accountName: accountName})
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing the lease prefixes of account(%s): %s", accountName, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	response := b.bulkRevokeResponse(ctx, req, tokens, prefixes)
+	response.Data[fldAccountName] = accountName
+	response.Data[fldPluginIssuedOnly] = pluginIssuedOnly
+
+	return response, nil
+}
+
+func (b *backend) revokeProjectRoleTokensCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	projectName, err := getFromFieldData[string](data, fldProjectName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	projectRoleName, err := getFromFieldData[string](data, fldProjectRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+	pluginIssuedOnly, _ := getFromFieldData[bool](data, fldPluginIssuedOnly)
+	instance := getInstanceFromFieldData(data)
+
+	config, err := getInstanceConfig(ctx, req, instance)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	tokens, err := b.revokeProjectRoleTokens(clientCtx, projectName, projectRoleName, pluginIssuedOnly)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while revoking the tokens of project role(%s/%s): %s", projectName, projectRoleName, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	prefixes, err := leasePrefixes(ctx, req, instance, fmt.Sprintf("project/%s/role/%s", projectName, projectRoleName), func(role *roleEntry) bool {
+		return role.ProjectName == projectName && role.ProjectRoleName == projectRoleName
+	}, issuedTokenFilters{projectName: projectName, projectRoleName: projectRoleName})
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing the lease prefixes of project role(%s/%s): %s", projectName, projectRoleName, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	response := b.bulkRevokeResponse(ctx, req, tokens, prefixes)
+	response.Data[fldProjectName] = projectName
+	response.Data[fldProjectRoleName] = projectRoleName
+	response.Data[fldPluginIssuedOnly] = pluginIssuedOnly
+
+	return response, nil
+}
+
+// revokeAccountTokens deletes the tokens of the account, only the tokens issued by the plugin when pluginIssuedOnly is set.
+// The admin token is skipped
+func (b *backend) revokeAccountTokens(clientCtx *accountClientContext, accountName string, pluginIssuedOnly bool, adminTokenId string) ([]revokedToken, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	acc, err := clientCtx.GetAccount(accountName)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]revokedToken, 0, len(acc.Tokens))
+	for _, token := range acc.Tokens {
+		if pluginIssuedOnly && !isPluginTokenId(token.Id) {
+			continue
+		}
+		revoked := revokedToken{id: token.Id, iat: token.IssuedAt, pluginIssued: isPluginTokenId(token.Id)}
+		if adminTokenId != "" && token.Id == adminTokenId {
+			revoked.status = revokeStatusSkipped
+			revoked.err = errors.New(adminTokenSkipMessage)
+		}
+		tokens = append(tokens, revoked)
+	}
+
+	deleteConcurrently(tokens, func(token *revokedToken) error {
+		return clientCtx.DeleteToken(token.id, accountName)
+	})
+	b.logger.Warn(fmt.Sprintf("bulk revocation of %d tokens for account(%s)", len(tokens), accountName))
+
+	return tokens, nil
+}
+
+// revokeProjectRoleTokens deletes the tokens of the project role, only the tokens issued by the plugin when pluginIssuedOnly is set
+func (b *backend) revokeProjectRoleTokens(
+	clientCtx *projectClientContext,
+	projectName string,
+	projectRoleName string,
+	pluginIssuedOnly bool) ([]revokedToken, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	proj, err := clientCtx.GetProject(projectName)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, role := range proj.Spec.Roles {
+		if role.Name != projectRoleName {
+			continue
+		}
+
+		tokens := make([]revokedToken, 0, len(role.JWTTokens))
+		for _, token := range role.JWTTokens {
+			if pluginIssuedOnly && !isPluginTokenId(token.ID) {
+				continue
+			}
+			tokens = append(tokens, revokedToken{id: token.ID, iat: token.IssuedAt, pluginIssued: isPluginTokenId(token.ID)})
+		}
+
+		deleteConcurrently(tokens, func(token *revokedToken) error {
+			return clientCtx.DeleteTokenWithIat(token.id, token.iat, projectName, projectRoleName)
+		})
+		b.logger.Warn(fmt.Sprintf("bulk revocation of %d tokens for project role(%s/%s)", len(tokens), projectName, projectRoleName))
+
+		return tokens, nil
+	}
+
+	return nil, status.Errorf(codes.NotFound, "role(%s) does not exist in project(%s)", projectRoleName, projectName)
+}
+
+// deleteConcurrently deletes the tokens with at most revokeConcurrency deletions in flight, and records the result in each token.
+// The skipped tokens are not deleted
+func deleteConcurrently(tokens []revokedToken, deleteToken func(token *revokedToken) error) {
+	slots := make(chan struct{}, revokeConcurrency)
+	var wg sync.WaitGroup
+	for i := range tokens {
+		if tokens[i].status == revokeStatusSkipped {
+			continue
+		}
+		wg.Add(1)
+		slots <- struct{}{}
+		go func(token *revokedToken) {
+			defer wg.Done()
+			defer func() { <-slots }()
+
+			err := deleteToken(token)
+			switch {
+			case isNotFound(err):
+				token.status = revokeStatusNotFound
+			case err != nil:
+				token.status = revokeStatusFailed
+				token.err = err
+			default:
+				token.status = revokeStatusDeleted
+			}
+		}(&tokens[i])
+	}
+	wg.Wait()
+}
+
+// bulkRevokeResponse forgets the deleted tokens issued by the plugin, and returns the result of each deletion with the lease prefixes to revoke
+func (b *backend) bulkRevokeResponse(ctx context.Context, req *logical.Request, tokens []revokedToken, prefixes []string) *logical.Response {
+	deleted, failed, skipped := 0, 0, 0
+	results := make([]map[string]interface{}, 0, len(tokens))
+	for i := range tokens {
+		token := &tokens[i]
+		results = append(results, token.toResponseData())
+		if token.status == revokeStatusSkipped {
+			skipped++
+			continue
+		}
+		if token.status == revokeStatusFailed {
+			failed++
+			continue
+		}
+
+		deleted++
+		if token.pluginIssued {
+			b.forgetIssuedToken(ctx, req.Storage, token.id)
+			if err := req.Storage.Delete(ctx, pendingRevocationStorageKey(token.id)); err != nil {
+				b.logger.Error(fmt.Sprintf("error while deleting the pending revocation(%s): %s", token.id, err))
+			}
+		}
+	}
+
+	response := &logical.Response{
+		Data: map[string]interface{}{
+			fldTokens:        results,
+			fldDeleted:       deleted,
+			fldFailed:        failed,
+			fldSkipped:       skipped,
+			fldLeasePrefixes: prefixes,
+			fldLeasesRevoked: false,
+		},
+	}
+	response.AddWarning(bulkRevokeLeaseWarning)
+
+	return response
+}
+
+// leasePrefixes returns the prefixes of the leases issued for the account or project role: its token path, the creds paths of the roles bound to it,
+// and the issuing paths recorded by the inventory for the tokens matching the filters, as the application paths and the roles with dynamic project roles
+func leasePrefixes(
+	ctx context.Context,
+	req *logical.Request,
+	instance string,
+	tokenPath string,
+	isBound func(role *roleEntry) bool,
+	filters issuedTokenFilters) ([]string, error) {
+	instancePath := ""
+	if instance != "" {
+		instancePath = instance + "/"
+	}
+	prefixes := []string{req.MountPoint + instancePath + tokenPath + "/"}
+
+	names, err := req.Storage.List(ctx, roleStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, name := range names {
+		role, err := tryReadFromStorage[roleEntry](ctx, req.Storage, roleStorageKey(name))
+		if err != nil {
+			return nil, err
+		}
+		if role.Name != "" && role.Instance == instance && isBound(&role) {
+			prefixes = append(prefixes, req.MountPoint+"creds/"+role.Name+"/")
+		}
+	}
+
+	tokens, err := listIssuedTokens(ctx, req.Storage, filters)
+	if err != nil {
+		return nil, err
+	}
+
+	var recorded []string
+	for _, token := range tokens {
+		if token.Instance != instance {
+			continue
+		}
+		if token.RoleName != "" {
+			recorded = append(recorded, req.MountPoint+"creds/"+token.RoleName+"/")
+		}
+		if token.ApplicationName != "" {
+			recorded = append(recorded, req.MountPoint+instancePath+"application/"+token.ApplicationName+"/")
+		}
+	}
+	sort.Strings(recorded)
+	for _, prefix := range recorded {
+		if !strutil.StrListContains(prefixes, prefix) {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+
+	return prefixes, nil
+}
@@ -0,0 +1,277 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRevokeTokens(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "account tokens",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					accounts: []*account.Account{
+						{Name: "a1", Tokens: []*account.Token{{Id: "vault-1"}, {Id: "manual"}}},
+					},
+				}
+				tokens, err := b.revokeAccountTokens(getTestAccountClientContext(&accountClient), "a1", false, "")
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Len(tokens, 2)
+				a.Len(accountClient.deleteTokenRequests, 2)
+				for _, token := range tokens {
+					a.Equal(revokeStatusDeleted, token.status)
+				}
+			},
+		},
+		{
+			name: "plugin issued account tokens only",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					accounts: []*account.Account{
+						{Name: "a1", Tokens: []*account.Token{{Id: "vault-1"}, {Id: "manual"}}},
+					},
+					DeleteTokenError: status.Error(codes.NotFound, "token does not exist"),
+				}
+				tokens, err := b.revokeAccountTokens(getTestAccountClientContext(&accountClient), "a1", true, "")
+				require.NoError(t, err)
+				require.Len(t, tokens, 1)
+				a := assert.New(t)
+				a.Equal("vault-1", tokens[0].id)
+				a.True(tokens[0].pluginIssued)
+				a.Equal(revokeStatusNotFound, tokens[0].status)
+			},
+		},
+		{
+			name: "admin token is skipped",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					accounts: []*account.Account{
+						{Name: "a1", Tokens: []*account.Token{{Id: "vault-1"}, {Id: "admin-id"}}},
+					},
+				}
+				tokens, err := b.revokeAccountTokens(getTestAccountClientContext(&accountClient), "a1", false, "admin-id")
+				require.NoError(t, err)
+				require.Len(t, tokens, 2)
+				a := assert.New(t)
+				a.Equal(revokeStatusDeleted, tokens[0].status)
+				a.Equal(revokeStatusSkipped, tokens[1].status)
+				a.ErrorContains(tokens[1].err, adminTokenSkipMessage)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.Equal("vault-1", accountClient.deleteTokenRequests[0].Id)
+
+				res := b.bulkRevokeResponse(ctx, &logical.Request{Storage: s}, tokens, nil)
+				a.EqualValues(1, res.Data[fldDeleted])
+				a.EqualValues(1, res.Data[fldSkipped])
+				a.EqualValues(false, res.Data[fldLeasesRevoked])
+			},
+		},
+		{
+			name: "project role tokens",
+			fn: func(t *testing.T) {
+				projectClient := testProjectClient{
+					projects: []*v1alpha1.AppProject{
+						getTestProject("p1", v1alpha1.ProjectRole{
+							Name:      "r1",
+							JWTTokens: []v1alpha1.JWTToken{{ID: "vault-1", IssuedAt: 1}, {IssuedAt: 2}},
+						}),
+					},
+					DeleteTokenError: fmt.Errorf("some error"),
+				}
+				tokens, err := b.revokeProjectRoleTokens(getTestProjectClientContext(&projectClient), "p1", "r1", false)
+				require.NoError(t, err)
+				require.Len(t, tokens, 2)
+				a := assert.New(t)
+				a.Equal(revokeStatusFailed, tokens[0].status)
+				a.ErrorContains(tokens[0].err, "some error")
+				// tokens created without id are deleted by their issued at time
+				a.ElementsMatch([]int64{1, 2}, []int64{projectClient.deleteTokenRequests[0].Iat, projectClient.deleteTokenRequests[1].Iat})
+			},
+		},
+		{
+			name: "missing project role",
+			fn: func(t *testing.T) {
+				projectClient := testProjectClient{projects: []*v1alpha1.AppProject{getTestProject("p1")}}
+				_, err := b.revokeProjectRoleTokens(getTestProjectClientContext(&projectClient), "p1", "r1", false)
+				require.True(t, isNotFound(err))
+			},
+		},
+		{
+			name: "bounded concurrency",
+			fn: func(t *testing.T) {
+				var lock sync.Mutex
+				inFlight, maxInFlight := 0, 0
+				tokens := make([]revokedToken, 4*revokeConcurrency)
+				deleteConcurrently(tokens, func(token *revokedToken) error {
+					lock.Lock()
+					inFlight++
+					maxInFlight = max(maxInFlight, inFlight)
+					lock.Unlock()
+					time.Sleep(time.Millisecond)
+					lock.Lock()
+					inFlight--
+					lock.Unlock()
+					return nil
+				})
+				assert.LessOrEqual(t, maxInFlight, revokeConcurrency)
+				for _, token := range tokens {
+					assert.Equal(t, revokeStatusDeleted, token.status)
+				}
+			},
+		},
+		{
+			name: "response forgets the deleted tokens",
+			fn: func(t *testing.T) {
+				req := &logical.Request{Storage: s, MountPoint: "argocd/"}
+				require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey("vault-1"), &issuedToken{Id: "vault-1"}))
+				require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey("vault-2"), &issuedToken{Id: "vault-2"}))
+				require.NoError(t, saveToStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey("vault-1"), &pendingRevocation{Id: "vault-1"}))
+
+				res := b.bulkRevokeResponse(ctx, req, []revokedToken{
+					{id: "vault-1", pluginIssued: true, status: revokeStatusDeleted},
+					{id: "vault-2", pluginIssued: true, status: revokeStatusFailed, err: fmt.Errorf("some error")},
+				}, []string{"argocd/account/a1/"})
+				a := assert.New(t)
+				a.Equal(1, res.Data[fldDeleted])
+				a.Equal(1, res.Data[fldFailed])
+				a.Equal("some error", res.Data[fldTokens].([]map[string]interface{})[1][fldError])
+				a.Len(res.Warnings, 1)
+
+				tokens, err := listIssuedTokens(ctx, s, issuedTokenFilters{})
+				require.NoError(t, err)
+				require.Len(t, tokens, 1)
+				a.Equal("vault-2", tokens[0].Id)
+				pending, err := pendingRevocationIds(ctx, s)
+				require.NoError(t, err)
+				a.Empty(pending)
+			},
+		},
+		{
+			name: "lease prefixes",
+			fn: func(t *testing.T) {
+				req := &logical.Request{Storage: s, MountPoint: "argocd/"}
+				require.NoError(t, saveToStorage[roleEntry](ctx, s, roleStorageKey("r1"), &roleEntry{Name: "r1", AccountName: "a1"}))
+				require.NoError(t, saveToStorage[roleEntry](ctx, s, roleStorageKey("r2"), &roleEntry{Name: "r2", AccountName: "a2"}))
+				require.NoError(t, saveToStorage[roleEntry](ctx, s, roleStorageKey("r3"), &roleEntry{Name: "r3", Instance: "i1", AccountName: "a1"}))
+
+				// the inventory records the issuing paths of the roles deleted since and of the application tokens
+				records := []issuedToken{
+					{Id: "vault-r1", AccountName: "a1", RoleName: "r1"},
+					{Id: "vault-r4", AccountName: "a1", RoleName: "r4"},
+					{Id: "vault-r5", Instance: "i1", AccountName: "a1", RoleName: "r5"},
+					{Id: "vault-app1", ProjectName: "p1", ProjectRoleName: "pr1", ApplicationName: "app1"},
+					{Id: "vault-app2", Instance: "i1", ProjectName: "p1", ProjectRoleName: "pr1", ApplicationName: "app2"},
+					{Id: "vault-dynamic", ProjectName: "p1", ProjectRoleName: "pr1", RoleName: "dynamic", ApplicationName: "app3"},
+					{Id: "vault-other-role", ProjectName: "p1", ProjectRoleName: "pr2", ApplicationName: "app4"},
+				}
+				for i := range records {
+					require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey(records[i].Id), &records[i]))
+				}
+
+				isBound := func(role *roleEntry) bool { return role.AccountName == "a1" }
+				filters := issuedTokenFilters{accountName: "a1"}
+				prefixes, err := leasePrefixes(ctx, req, "", "account/a1", isBound, filters)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"argocd/account/a1/", "argocd/creds/r1/", "argocd/creds/r4/"}, prefixes)
+
+				prefixes, err = leasePrefixes(ctx, req, "i1", "account/a1", isBound, filters)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"argocd/i1/account/a1/", "argocd/creds/r3/", "argocd/creds/r5/"}, prefixes)
+
+				isProjectRoleBound := func(role *roleEntry) bool { return role.ProjectName == "p1" && role.ProjectRoleName == "pr1" }
+				filters = issuedTokenFilters{projectName: "p1", projectRoleName: "pr1"}
+				prefixes, err = leasePrefixes(ctx, req, "", "project/p1/role/pr1", isProjectRoleBound, filters)
+				require.NoError(t, err)
+				assert.Equal(t, []string{
+					"argocd/project/p1/role/pr1/",
+					"argocd/application/app1/",
+					"argocd/application/app3/",
+					"argocd/creds/dynamic/",
+				}, prefixes)
+
+				prefixes, err = leasePrefixes(ctx, req, "i1", "project/p1/role/pr1", isProjectRoleBound, filters)
+				require.NoError(t, err)
+				assert.Equal(t, []string{"argocd/i1/project/p1/role/pr1/", "argocd/i1/application/app2/"}, prefixes)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestRevokePaths(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token"})
+	config := readConfigSuccess(t, r)
+	accountClient := testAccountClient{
+		accounts: []*account.Account{{Name: "a1", Tokens: []*account.Token{{Id: "vault-1"}, {Id: "manual"}}}},
+	}
+	projectClient := testProjectClient{
+		projects: []*v1alpha1.AppProject{getTestProject("p1", v1alpha1.ProjectRole{Name: "r1", JWTTokens: []v1alpha1.JWTToken{{ID: "vault-2"}}})},
+	}
+	cacheTestClients(b, &config, &accountClient, &projectClient)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "account tokens of the default instance",
+			fn: func(t *testing.T) {
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Operation: logical.UpdateOperation,
+					Path:      "revoke/account/a1",
+					Storage:   s,
+				})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues("a1", res.Data[fldAccountName])
+				a.EqualValues(2, res.Data[fldDeleted])
+				a.Len(accountClient.deleteTokenRequests, 2)
+			},
+		},
+		{
+			name: "project role tokens of the default instance",
+			fn: func(t *testing.T) {
+				record := issuedToken{Id: "vault-2", ProjectName: "p1", ProjectRoleName: "r1", ApplicationName: "app1"}
+				require.NoError(t, saveToStorage[issuedToken](context.Background(), s, issuedTokenStorageKey(record.Id), &record))
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Operation:  logical.UpdateOperation,
+					Path:       "revoke/project/p1/role/r1",
+					Storage:    s,
+					MountPoint: "argocd/",
+				})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal([]string{"argocd/project/p1/role/r1/", "argocd/application/app1/"}, res.Data[fldLeasePrefixes])
+				a.EqualValues("p1", res.Data[fldProjectName])
+				a.EqualValues("r1", res.Data[fldProjectRoleName])
+				a.EqualValues(1, res.Data[fldDeleted])
+				require.Len(t, projectClient.deleteTokenRequests, 1)
+				a.EqualValues("vault-2", projectClient.deleteTokenRequests[0].Id)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,269 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	roleStoragePrefix = "roles/"
+	fldRoleName       = "name"
+	fldDefaultTTL     = "default_ttl"
+	fldMaxTTL         = "max_ttl"
+)
+
+// roleEntry binds a vault role to a single argo cd account or project role
+type roleEntry struct {
+	Name            string `json:"name" structs:"name" mapstructure:"name"`
+	Instance        string `json:"instance" structs:"instance" mapstructure:"instance"`
+	AccountName     string `json:"account_name" structs:"account_name" mapstructure:"account_name"`
+	ProjectName     string `json:"project_name" structs:"project_name" mapstructure:"project_name"`
+	ProjectRoleName string `json:"project_role_name" structs:"project_role_name" mapstructure:"project_role_name"`
+	// Policies are the policy templates of the dynamic project roles, created for each lease instead of a static project role
+	Policies   []string      `json:"policies" structs:"policies" mapstructure:"policies"`
+	DefaultTTL time.Duration `json:"default_ttl" structs:"default_ttl" mapstructure:"default_ttl"`
+	MaxTTL     time.Duration `json:"max_ttl" structs:"max_ttl" mapstructure:"max_ttl"`
+}
+
+var roleSchema = map[string]*framework.FieldSchema{
+	fldRoleName: {
+		Type:        framework.TypeString,
+		Description: `Name of the role`,
+	},
+	fldInstance: {
+		Type:        framework.TypeString,
+		Description: `Name of the argo cd instance (default: the instance configured on the config path)`,
+	},
+	fldAccountName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Account name (mutually exclusive with project_name/project_role_name)`,
+	},
+	fldProjectName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Project name`,
+	},
+	fldProjectRoleName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Project Role name`,
+	},
+	fldPolicies: {
+		Type:        framework.TypeStringSlice,
+		Description: `Policy templates (resource, action, object, effect) of a dynamic project role created for each lease (mutually exclusive with project_role_name)`,
+	},
+	fldDefaultTTL: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Default TTL for tokens issued from this role (default: the default TTL in the config)`,
+	},
+	fldMaxTTL: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Max TTL for tokens issued from this role, capped by the config max TTL`,
+	},
+}
+
+func roleStorageKey(name string) string {
+	return roleStoragePrefix + name
+}
+
+func (r *roleEntry) isAccountRole() bool {
+	return r.AccountName != ""
+}
+
+// isDynamicProjectRole returns true if the role creates a project role for each lease
+func (r *roleEntry) isDynamicProjectRole() bool {
+	return len(r.Policies) > 0
+}
+
+// toResponse returns the logical response corresponding to the role entry
+func (r *roleEntry) toResponse() *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			fldRoleName:        r.Name,
+			fldInstance:        r.Instance,
+			fldAccountName:     r.AccountName,
+			fldProjectName:     r.ProjectName,
+			fldProjectRoleName: r.ProjectRoleName,
+			fldPolicies:        r.Policies,
+			fldDefaultTTL:      r.DefaultTTL.String(),
+			fldMaxTTL:          r.MaxTTL.String(),
+		},
+	}
+}
+
+// initFromInputs updates the entry from partial input data, keeping the stored values for missing fields
+func (r *roleEntry) initFromInputs(data *framework.FieldData) error {
+	if instance, err := getFromFieldData[string](data, fldInstance); err == nil {
+		r.Instance = instance
+	}
+
+	if accountName, err := getFromFieldData[string](data, fldAccountName); err == nil {
+		r.AccountName = accountName
+	}
+
+	if projectName, err := getFromFieldData[string](data, fldProjectName); err == nil {
+		r.ProjectName = projectName
+	}
+
+	if projectRoleName, err := getFromFieldData[string](data, fldProjectRoleName); err == nil {
+		r.ProjectRoleName = projectRoleName
+	}
+
+	if policies, err := getFromFieldData[[]string](data, fldPolicies); err == nil {
+		r.Policies = policies
+	}
+
+	if defaultTTL, err := getFromFieldData[int](data, fldDefaultTTL); err == nil {
+		r.DefaultTTL = time.Duration(defaultTTL) * time.Second
+	}
+
+	if maxTTL, err := getFromFieldData[int](data, fldMaxTTL); err == nil {
+		r.MaxTTL = time.Duration(maxTTL) * time.Second
+	}
+
+	return r.assertValid()
+}
+
+func (r *roleEntry) assertValid() error {
+	isProjectRole := r.ProjectName != "" || r.ProjectRoleName != "" || r.isDynamicProjectRole()
+	switch {
+	case r.isAccountRole() && isProjectRole:
+		return fmt.Errorf("invalid role: account_name and project_name/project_role_name are mutually exclusive")
+	case !r.isAccountRole() && !isProjectRole:
+		return fmt.Errorf("invalid role: either account_name or project_name/project_role_name must be set")
+	case r.isDynamicProjectRole() && r.ProjectRoleName != "":
+		return fmt.Errorf("invalid role: project_role_name and policies are mutually exclusive")
+	case r.isDynamicProjectRole() && r.ProjectName == "":
+		return fmt.Errorf("invalid role: project_name must be set with policies")
+	case isProjectRole && !r.isDynamicProjectRole() && (r.ProjectName == "" || r.ProjectRoleName == ""):
+		return fmt.Errorf("invalid role: both project_name and project_role_name must be set")
+	case r.MaxTTL > 0 && r.DefaultTTL > r.MaxTTL:
+		return fmt.Errorf("invalid role: default_ttl(%s) should not be greater than max_ttl(%s)", r.DefaultTTL, r.MaxTTL)
+	}
+
+	for _, policy := range r.Policies {
+		if err := assertValidPolicyTemplate(policy); err != nil {
+			return fmt.Errorf("invalid role: %s", err)
+		}
+	}
+
+	return nil
+}
+
+// getRole returns the role from storage, or an error if it does not exist
+func getRole(ctx context.Context, req *logical.Request, name string) (roleEntry, error) {
+	return readFromStorage[roleEntry](ctx, req.Storage, roleStorageKey(name))
+}
+
+func pathRoles(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "roles/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathRolesList,
+					Summary:  "lists the configured roles",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRolesListSynopsis),
+			HelpDescription: trimHelp(helpPathRolesListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("roles/%s", framework.GenericNameRegex(fldRoleName)),
+			Fields:  roleSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathRoleRead,
+					Summary:  "retrieves a role",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRoleWrite,
+					Summary:  "creates or updates a role",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathRoleDelete,
+					Summary:  "deletes a role",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRolesSynopsis),
+			HelpDescription: trimHelp(helpPathRolesDescription),
+		},
+	}
+}
+
+func (b *backend) pathRolesList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, roleStoragePrefix)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing roles: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathRoleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	role, err := tryReadFromStorage[roleEntry](ctx, req.Storage, roleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if role.Name == "" {
+		return nil, nil
+	}
+
+	return role.toResponse(), nil
+}
+
+func (b *backend) pathRoleWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	role, err := tryReadFromStorage[roleEntry](ctx, req.Storage, roleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	role.Name = name
+	if err := role.initFromInputs(data); err != nil {
+		errMsg := fmt.Sprintf("error while init in role(%s): %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), nil
+	}
+
+	if err := saveToStorage[roleEntry](ctx, req.Storage, roleStorageKey(name), &role); err != nil {
+		errMsg := fmt.Sprintf("error while writing role(%s) to storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return role.toResponse(), nil
+}
+
+func (b *backend) pathRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	if err := req.Storage.Delete(ctx, roleStorageKey(name)); err != nil {
+		errMsg := fmt.Sprintf("error while deleting role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return nil, nil
+}
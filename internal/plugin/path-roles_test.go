@@ -0,0 +1,177 @@
+package plugin
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func roleRequest(b logical.Backend, s logical.Storage, op logical.Operation, path string, d map[string]interface{}) (*logical.Response, error) {
+	r := &logical.Request{
+		Storage:   s,
+		Operation: op,
+		Path:      path,
+		Data:      d,
+	}
+	return b.HandleRequest(context.Background(), r)
+}
+
+func TestRoles(t *testing.T) {
+	b, s := getTestBackend(t)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "missing binding",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{"default_ttl": "1h"})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "either account_name or project_name/project_role_name must be set")
+			},
+		},
+		{
+			name: "account and project are mutually exclusive",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{
+					"account_name":      "a1",
+					"project_name":      "p1",
+					"project_role_name": "pr1",
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "mutually exclusive")
+			},
+		},
+		{
+			name: "project without role",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{"project_name": "p1"})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "both project_name and project_role_name must be set")
+			},
+		},
+		{
+			name: "default ttl greater than max ttl",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{
+					"account_name": "a1",
+					"default_ttl":  "2h",
+					"max_ttl":      "1h",
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "should not be greater than max_ttl")
+			},
+		},
+		{
+			name: "create account role",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{
+					"account_name": "a1",
+					"default_ttl":  "30m",
+					"max_ttl":      "2h",
+				})
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				role, err := getRole(context.Background(), &logical.Request{Storage: s}, "r1")
+				require.NoError(t, err)
+				require.EqualValues(t, roleEntry{Name: "r1", AccountName: "a1", DefaultTTL: 30 * time.Minute, MaxTTL: 2 * time.Hour}, role)
+			},
+		},
+		{
+			name: "partial update keeps the stored values",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r1", map[string]interface{}{"max_ttl": "3h"})
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				res, err = roleRequest(b, s, logical.ReadOperation, "roles/r1", nil)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues("r1", res.Data["name"])
+				a.EqualValues("a1", res.Data["account_name"])
+				a.EqualValues((30 * time.Minute).String(), res.Data["default_ttl"])
+				a.EqualValues((3 * time.Hour).String(), res.Data["max_ttl"])
+			},
+		},
+		{
+			name: "create project role and list",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r2", map[string]interface{}{
+					"project_name":      "p1",
+					"project_role_name": "pr1",
+				})
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				res, err = roleRequest(b, s, logical.ListOperation, "roles/", nil)
+				require.NoError(t, err)
+				require.EqualValues(t, []string{"r1", "r2"}, res.Data["keys"])
+			},
+		},
+		{
+			name: "delete role",
+			fn: func(t *testing.T) {
+				_, err := roleRequest(b, s, logical.DeleteOperation, "roles/r2", nil)
+				require.NoError(t, err)
+
+				res, err := roleRequest(b, s, logical.ReadOperation, "roles/r2", nil)
+				require.NoError(t, err)
+				require.Nil(t, res)
+			},
+		},
+		{
+			name: "policies and project role are mutually exclusive",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r3", map[string]interface{}{
+					"project_name":      "p1",
+					"project_role_name": "pr1",
+					"policies":          []string{"applications, sync, p1/*, allow"},
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "project_role_name and policies are mutually exclusive")
+
+				res, err = roleRequest(b, s, logical.UpdateOperation, "roles/r3", map[string]interface{}{
+					"policies": []string{"applications, sync, p1/*, allow"},
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "project_name must be set with policies")
+			},
+		},
+		{
+			name: "invalid policy template",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r3", map[string]interface{}{
+					"project_name": "p1",
+					"policies":     []string{"applications, sync, p1/*"},
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "should have the format: resource, action, object, effect")
+			},
+		},
+		{
+			name: "create dynamic project role",
+			fn: func(t *testing.T) {
+				policies := []string{"applications, sync, p1/app-*, allow", "applications, get, p1/*, allow"}
+				res, err := roleRequest(b, s, logical.UpdateOperation, "roles/r3", map[string]interface{}{
+					"project_name": "p1",
+					"policies":     policies,
+				})
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+
+				role, err := getRole(context.Background(), &logical.Request{Storage: s}, "r3")
+				require.NoError(t, err)
+				require.True(t, role.isDynamicProjectRole())
+				require.EqualValues(t, roleEntry{Name: "r3", ProjectName: "p1", Policies: policies}, role)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,191 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+func pathRotateRoot(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "config/rotate-root",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRotateRootCallback,
+					Summary:  "rotates the admin token of the argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRotateRootSynopsis),
+			HelpDescription: trimHelp(helpPathRotateRootDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("config/%s/rotate-root", framework.GenericNameRegex(fldInstance)),
+			Fields: map[string]*framework.FieldSchema{
+				fldInstance: {
+					Type:        framework.TypeString,
+					Description: `Name of the argo cd instance`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathRotateRootCallback,
+					Summary:  "rotates the admin token of a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathRotateRootSynopsis),
+			HelpDescription: trimHelp(helpPathRotateRootDescription),
+		},
+	}
+}
+
+func (b *backend) pathRotateRootCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	// the config is read under the lock, so a concurrent rotation is not overwritten with a token minted from a stale config
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return b.rotateRoot(ctx, req.Storage, &config, clientCtx)
+}
+
+// rotateRoot replaces the admin token with a new token for the same account.
+// The new token is saved before the old one is deleted, so the plugin is never left without a valid admin token.
+// The caller holds rotateRootLock and read the config under it
+func (b *backend) rotateRoot(ctx context.Context, storage logical.Storage, config *configEntry, clientCtx *accountClientContext) (*logical.Response, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	claims, err := parseTokenClaims(config.AdminToken)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading the admin token: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	accountName, err := claims.accountName()
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading the admin token: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	token, err := clientCtx.GenerateAdminToken(accountName, claims.lifetime())
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new admin token for account(%s): %s", accountName, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	previous := *config
+	config.AdminToken = token.token
+	config.RootRotatedAt = time.Now()
+	if err := saveToStorage[configEntry](ctx, storage, configStorageKey(config.Instance), config); err != nil {
+		errMsg := fmt.Sprintf("error while writing config to storage: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	b.clients.invalidate(&previous)
+
+	response := config.toResponse()
+	if claims.Id == "" {
+		warning := fmt.Sprintf("the previous admin token for account(%s) has no id and needs to be deleted manually", accountName)
+		b.logger.Warn(warning)
+		response.AddWarning(warning)
+	} else if err := clientCtx.DeleteToken(claims.Id, accountName); err != nil {
+		warning := fmt.Sprintf("the admin token was rotated but the previous token(%s) for account(%s) could not be deleted: %s", claims.Id, accountName, err)
+		b.logger.Warn(warning)
+		response.AddWarning(warning)
+	}
+
+	b.logger.Info(fmt.Sprintf("rotated the admin token of instance(%s) for account(%s)", config.Instance, accountName))
+
+	return response, nil
+}
+
+// isRootRotationDue returns true once the rotation period of the admin token has elapsed
+func (config *configEntry) isRootRotationDue() (bool, error) {
+	if config.RootRotationPeriod == 0 {
+		return false, nil
+	}
+
+	lastRotation := config.RootRotatedAt
+	if lastRotation.IsZero() {
+		claims, err := parseTokenClaims(config.AdminToken)
+		if err != nil {
+			return false, fmt.Errorf("error while reading the admin token of instance(%s): %s", config.Instance, err)
+		}
+		lastRotation = time.Unix(claims.IssuedAt, 0)
+	}
+
+	return time.Since(lastRotation) >= config.RootRotationPeriod, nil
+}
+
+// checkAdminTokenReplacement checks the admin token written to a config whose admin token was rotated by the plugin.
+// A token issued before the rotation is rejected, as it is a previous admin token posted again, likely deleted from argo cd by the rotation.
+// A token issued since is accepted with a warning, the rotated admin token is left in argo cd
+func (c *configEntry) checkAdminTokenReplacement(adminToken string) (string, error) {
+	if c.RootRotatedAt.IsZero() {
+		return "", nil
+	}
+
+	claims, err := parseTokenClaims(adminToken)
+	if err != nil {
+		return "", fmt.Errorf("admin_token can not replace the admin token rotated by the plugin at %s: %s", c.RootRotatedAt.Format(time.RFC3339), err)
+	}
+	if !time.Unix(claims.IssuedAt, 0).After(c.RootRotatedAt) {
+		return "", fmt.Errorf("admin_token was issued before the admin token rotated by the plugin at %s, omit admin_token to keep the rotated admin token", c.RootRotatedAt.Format(time.RFC3339))
+	}
+
+	rotated, err := parseTokenClaims(c.AdminToken)
+	if err != nil || rotated.Id == "" {
+		return "replaced the admin token rotated by the plugin, it is left in argo cd", nil
+	}
+
+	return fmt.Sprintf("replaced the admin token(%s) rotated by the plugin, it is left in argo cd", rotated.Id), nil
+}
+
+// rotateRootIfDue rotates the admin token of the instance once its rotation period has elapsed.
+// The config is read again under the lock, as a manual rotation may have replaced the admin token meanwhile,
+// and the given config is updated so the other periodic jobs use the current admin token
+func (b *backend) rotateRootIfDue(ctx context.Context, req *logical.Request, config *configEntry) error {
+	if due, err := config.isRootRotationDue(); err != nil || !due {
+		return err
+	}
+
+	b.rotateRootLock.Lock()
+	defer b.rotateRootLock.Unlock()
+
+	current, err := getInstanceConfig(ctx, req, config.Instance)
+	if err != nil {
+		return fmt.Errorf("error while reading config of instance(%s): %s", config.Instance, err)
+	}
+	current.Instance = config.Instance
+	*config = current
+
+	if due, err := config.isRootRotationDue(); err != nil || !due {
+		return err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, config)
+	if err != nil {
+		return fmt.Errorf("error while creating a new account client: %s", err)
+	}
+
+	_, err = b.rotateRoot(ctx, req.Storage, config, clientCtx)
+	return err
+}
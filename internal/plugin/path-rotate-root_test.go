@@ -0,0 +1,141 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRotateRoot(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "success",
+			fn: func(t *testing.T) {
+				adminToken := getTestToken(t, tokenClaims{Subject: "admin-account:apiKey", Id: "old-id", IssuedAt: 1700000000, ExpiresAt: 1700003600})
+				config := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: adminToken}
+				accountClient := testAccountClient{
+					createTokenResponse: &account.CreateTokenResponse{Token: "new-admin-token"},
+				}
+				res, err := b.rotateRoot(context.Background(), s, &config, getTestAccountClientContext(&accountClient))
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				require.Empty(t, res.Warnings)
+
+				a := assert.New(t)
+				a.Len(accountClient.createTokenRequests, 1)
+				a.EqualValues("admin-account", accountClient.createTokenRequests[0].Name)
+				a.EqualValues(3600, accountClient.createTokenRequests[0].ExpiresIn)
+				a.Len(accountClient.deleteTokenRequests, 1)
+				a.EqualValues("admin-account", accountClient.deleteTokenRequests[0].Name)
+				a.EqualValues("old-id", accountClient.deleteTokenRequests[0].Id)
+				a.True(strings.HasPrefix(accountClient.createTokenRequests[0].Id, adminTokenIdPrefix))
+				a.False(isPluginTokenId(accountClient.createTokenRequests[0].Id))
+
+				c := readConfigSuccess(t, r)
+				a.EqualValues("new-admin-token", c.AdminToken)
+				a.False(c.RootRotatedAt.IsZero())
+			},
+		},
+		{
+			name: "previous admin token posted again",
+			fn: func(t *testing.T) {
+				previous := getTestToken(t, tokenClaims{Subject: "admin-account:apiKey", Id: "old-id", IssuedAt: 1700000000, ExpiresAt: 1700003600})
+				updateConfigError(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": previous},
+					"admin_token was issued before the admin token rotated by the plugin")
+				assert.EqualValues(t, "new-admin-token", readConfigSuccess(t, r).AdminToken)
+
+				// the rotated admin token is kept when admin_token is not provided
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol"})
+				assert.EqualValues(t, "new-admin-token", readConfigSuccess(t, r).AdminToken)
+			},
+		},
+		{
+			name: "newer admin token replaces the rotated admin token with a warning",
+			fn: func(t *testing.T) {
+				newer := getTestToken(t, tokenClaims{Subject: "admin-account:apiKey", Id: "newer-id", IssuedAt: time.Now().Add(time.Minute).Unix()})
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Storage:   s,
+					Operation: logical.UpdateOperation,
+					Path:      "config",
+					Data:      map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": newer},
+				})
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				require.Len(t, res.Warnings, 1)
+				assert.Contains(t, res.Warnings[0], "rotated by the plugin, it is left in argo cd")
+
+				c := readConfigSuccess(t, r)
+				assert.EqualValues(t, newer, c.AdminToken)
+				assert.True(t, c.RootRotatedAt.IsZero())
+			},
+		},
+		{
+			name: "old token deletion failure is a warning",
+			fn: func(t *testing.T) {
+				adminToken := getTestToken(t, tokenClaims{Subject: "admin-account:apiKey", Id: "old-id", IssuedAt: 1700000000})
+				config := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: adminToken}
+				accountClient := testAccountClient{
+					createTokenResponse: &account.CreateTokenResponse{Token: "new-admin-token-2"},
+					DeleteTokenError:    fmt.Errorf("argo cd unavailable"),
+				}
+				res, err := b.rotateRoot(context.Background(), s, &config, getTestAccountClientContext(&accountClient))
+				require.NoError(t, err)
+				require.Len(t, res.Warnings, 1)
+				require.Contains(t, res.Warnings[0], "argo cd unavailable")
+
+				c := readConfigSuccess(t, r)
+				require.EqualValues(t, "new-admin-token-2", c.AdminToken)
+			},
+		},
+		{
+			name: "admin token is not an account token",
+			fn: func(t *testing.T) {
+				config := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "some-dummy-token"}
+				accountClient := testAccountClient{}
+				res, err := b.rotateRoot(context.Background(), s, &config, getTestAccountClientContext(&accountClient))
+				require.ErrorContains(t, err, "invalid token")
+				require.ErrorContains(t, res.Error(), "error while reading the admin token")
+				require.Empty(t, accountClient.createTokenRequests)
+			},
+		},
+		{
+			name: "not due",
+			fn: func(t *testing.T) {
+				config := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "some-dummy-token", RootRotationPeriod: 24 * time.Hour, RootRotatedAt: time.Now()}
+				require.NoError(t, b.rotateRootIfDue(context.Background(), r, &config))
+
+				config = configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "some-dummy-token"}
+				require.NoError(t, b.rotateRootIfDue(context.Background(), r, &config))
+			},
+		},
+		{
+			name: "stale config is read again",
+			fn: func(t *testing.T) {
+				current := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "rotated-admin-token", RootRotationPeriod: 24 * time.Hour, RootRotatedAt: time.Now()}
+				require.NoError(t, saveToStorage[configEntry](context.Background(), s, configStorageKey(""), &current))
+
+				// the stale config is due, the rotation that just happened is not
+				stale := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "stale-admin-token", RootRotationPeriod: 24 * time.Hour, RootRotatedAt: time.Now().Add(-48 * time.Hour)}
+				require.NoError(t, b.rotateRootIfDue(context.Background(), r, &stale))
+				a := assert.New(t)
+				a.EqualValues("rotated-admin-token", stale.AdminToken)
+				a.EqualValues("rotated-admin-token", readConfigSuccess(t, r).AdminToken)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,333 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	staticRoleStoragePrefix = "static-roles/"
+	fldRotationPeriod       = "rotation_period"
+	fldGracePeriod          = "grace_period"
+	fldLastRotated          = "last_rotated"
+	fldNextRotation         = "next_rotation"
+	defaultRotationPeriod   = 24 * time.Hour
+	defaultGracePeriod      = 1 * time.Hour
+	minRotationPeriod       = 1 * time.Minute
+)
+
+// staticRoleEntry binds a vault static role to an argo cd account, the plugin keeps a single current token for it and rotates it on a schedule
+type staticRoleEntry struct {
+	Name           string        `json:"name" structs:"name" mapstructure:"name"`
+	Instance       string        `json:"instance" structs:"instance" mapstructure:"instance"`
+	AccountName    string        `json:"account_name" structs:"account_name" mapstructure:"account_name"`
+	RotationPeriod time.Duration `json:"rotation_period" structs:"rotation_period" mapstructure:"rotation_period"`
+	GracePeriod    time.Duration `json:"grace_period" structs:"grace_period" mapstructure:"grace_period"`
+}
+
+var staticRoleSchema = map[string]*framework.FieldSchema{
+	fldRoleName: {
+		Type:        framework.TypeString,
+		Description: `Name of the static role`,
+	},
+	fldInstance: {
+		Type:        framework.TypeString,
+		Description: `Name of the argo cd instance (default: the instance configured on the config path)`,
+	},
+	fldAccountName: {
+		Type:        framework.TypeString,
+		Description: `ArgoCD Account name`,
+	},
+	fldRotationPeriod: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Period after which the token is rotated (default: 24h, min: 1m)`,
+	},
+	fldGracePeriod: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Time the previous token stays valid after a rotation (default: 1h, lower than rotation_period)`,
+	},
+}
+
+func staticRoleStorageKey(name string) string {
+	return staticRoleStoragePrefix + name
+}
+
+// toResponse returns the logical response corresponding to the static role entry
+func (r *staticRoleEntry) toResponse() *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			fldRoleName:       r.Name,
+			fldInstance:       r.Instance,
+			fldAccountName:    r.AccountName,
+			fldRotationPeriod: r.RotationPeriod.String(),
+			fldGracePeriod:    r.GracePeriod.String(),
+		},
+	}
+}
+
+// initFromInputs updates the entry from partial input data, keeping the stored values for missing fields.
+// The account and instance of an existing static role cannot be changed, as its tokens would be left behind
+func (r *staticRoleEntry) initFromInputs(data *framework.FieldData) error {
+	existing := *r
+
+	if instance, err := getFromFieldData[string](data, fldInstance); err == nil {
+		r.Instance = instance
+	}
+
+	if accountName, err := getFromFieldData[string](data, fldAccountName); err == nil {
+		r.AccountName = accountName
+	}
+
+	if existing.AccountName != "" && (r.AccountName != existing.AccountName || r.Instance != existing.Instance) {
+		return fmt.Errorf("invalid static role: account_name and instance cannot be changed, the static role must be deleted and created again")
+	}
+
+	if rotationPeriod, err := getFromFieldData[int](data, fldRotationPeriod); err == nil {
+		r.RotationPeriod = time.Duration(rotationPeriod) * time.Second
+	} else if existing.AccountName == "" {
+		r.RotationPeriod = defaultRotationPeriod
+	}
+
+	if gracePeriod, err := getFromFieldData[int](data, fldGracePeriod); err == nil {
+		r.GracePeriod = time.Duration(gracePeriod) * time.Second
+	} else if existing.AccountName == "" {
+		r.GracePeriod = defaultGracePeriod
+	}
+
+	return r.assertValid()
+}
+
+func (r *staticRoleEntry) assertValid() error {
+	switch {
+	case r.AccountName == "":
+		return fmt.Errorf("invalid static role: account_name must be set")
+	case r.RotationPeriod < minRotationPeriod:
+		return fmt.Errorf("invalid static role: rotation_period(%s) should be at least %s", r.RotationPeriod, minRotationPeriod)
+	case r.GracePeriod >= r.RotationPeriod:
+		return fmt.Errorf("invalid static role: grace_period(%s) should be lower than rotation_period(%s)", r.GracePeriod, r.RotationPeriod)
+	}
+
+	return nil
+}
+
+func pathStaticRoles(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "static-roles/?$",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathStaticRolesList,
+					Summary:  "lists the configured static roles",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathStaticRolesListSynopsis),
+			HelpDescription: trimHelp(helpPathStaticRolesListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("static-roles/%s", framework.GenericNameRegex(fldRoleName)),
+			Fields:  staticRoleSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathStaticRoleRead,
+					Summary:  "retrieves a static role",
+				},
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathStaticRoleWrite,
+					Summary:  "creates or updates a static role",
+				},
+				logical.DeleteOperation: &framework.PathOperation{
+					Callback: b.pathStaticRoleDelete,
+					Summary:  "deletes a static role and its tokens",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathStaticRolesSynopsis),
+			HelpDescription: trimHelp(helpPathStaticRolesDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("static-creds/%s", framework.GenericNameRegex(fldRoleName)),
+			Fields: map[string]*framework.FieldSchema{
+				fldRoleName: {
+					Type:        framework.TypeString,
+					Description: `Name of the static role`,
+				},
+			},
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathStaticCredsRead,
+					Summary:  "gets the current token of a static role",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathStaticCredsSynopsis),
+			HelpDescription: trimHelp(helpPathStaticCredsDescription),
+		},
+	}
+}
+
+func (b *backend) pathStaticRolesList(ctx context.Context, req *logical.Request, _ *framework.FieldData) (*logical.Response, error) {
+	roles, err := req.Storage.List(ctx, staticRoleStoragePrefix)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing static roles: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return logical.ListResponse(roles), nil
+}
+
+func (b *backend) pathStaticRoleRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	role, err := tryReadFromStorage[staticRoleEntry](ctx, req.Storage, staticRoleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading static role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if role.Name == "" {
+		return nil, nil
+	}
+
+	return role.toResponse(), nil
+}
+
+// pathStaticRoleWrite saves the static role and creates its first token, so the static creds are available once the role exists
+func (b *backend) pathStaticRoleWrite(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	b.staticRolesLock.Lock()
+	defer b.staticRolesLock.Unlock()
+
+	role, err := tryReadFromStorage[staticRoleEntry](ctx, req.Storage, staticRoleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading static role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	role.Name = name
+	if err := role.initFromInputs(data); err != nil {
+		errMsg := fmt.Sprintf("error while init in static role(%s): %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), nil
+	}
+
+	config, err := getInstanceConfig(ctx, req, role.Instance)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if err := saveToStorage[staticRoleEntry](ctx, req.Storage, staticRoleStorageKey(name), &role); err != nil {
+		errMsg := fmt.Sprintf("error while writing static role(%s) to storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if _, err := b.rotateStaticRole(ctx, req.Storage, clientCtx, &role, time.Now()); err != nil {
+		errMsg := fmt.Sprintf("error while creating the token of static role(%s): %s", name, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	return role.toResponse(), nil
+}
+
+// pathStaticRoleDelete deletes the tokens of the static role from argo cd before deleting the role, so no token is left behind
+func (b *backend) pathStaticRoleDelete(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	b.staticRolesLock.Lock()
+	defer b.staticRolesLock.Unlock()
+
+	role, err := tryReadFromStorage[staticRoleEntry](ctx, req.Storage, staticRoleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading static role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if role.Name == "" {
+		return nil, nil
+	}
+
+	config, err := getInstanceConfig(ctx, req, role.Instance)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if err := b.deleteStaticRoleTokens(ctx, req.Storage, clientCtx, &role); err != nil {
+		errMsg := fmt.Sprintf("error while deleting the tokens of static role(%s): %s", name, err)
+		b.logger.Error(errMsg)
+		return argoCDErrorResponse(errMsg, err)
+	}
+
+	if err := req.Storage.Delete(ctx, staticRoleStorageKey(name)); err != nil {
+		errMsg := fmt.Sprintf("error while deleting static role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	return nil, nil
+}
+
+func (b *backend) pathStaticCredsRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	name, err := getFromFieldData[string](data, fldRoleName)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	role, err := tryReadFromStorage[staticRoleEntry](ctx, req.Storage, staticRoleStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading static role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if role.Name == "" {
+		return logical.ErrorResponse(fmt.Sprintf("static role(%s) does not exist", name)), nil
+	}
+
+	cred, err := tryReadFromStorage[staticCred](ctx, req.Storage, staticCredStorageKey(name))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading the token of static role(%s) from storage: %s", name, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if cred.Id == "" {
+		return logical.ErrorResponse(fmt.Sprintf("static role(%s) has no token yet, it is created on the next rotation", name)), nil
+	}
+
+	return cred.toResponse(&role, time.Now()), nil
+}
@@ -0,0 +1,105 @@
+package plugin
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestStaticRoles(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "missing account",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "static-roles/s1", map[string]interface{}{"rotation_period": "2h"})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "account_name must be set")
+			},
+		},
+		{
+			name: "invalid periods",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.UpdateOperation, "static-roles/s1", map[string]interface{}{
+					"account_name":    "a1",
+					"rotation_period": "30s",
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "rotation_period(30s) should be at least 1m0s")
+
+				res, err = roleRequest(b, s, logical.UpdateOperation, "static-roles/s1", map[string]interface{}{
+					"account_name":    "a1",
+					"rotation_period": "1h",
+					"grace_period":    "1h",
+				})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "grace_period(1h0m0s) should be lower than rotation_period(1h0m0s)")
+			},
+		},
+		{
+			name: "account cannot be changed",
+			fn: func(t *testing.T) {
+				role := staticRoleEntry{Name: "s1", AccountName: "a1", RotationPeriod: defaultRotationPeriod, GracePeriod: defaultGracePeriod}
+				require.NoError(t, saveToStorage[staticRoleEntry](ctx, s, staticRoleStorageKey(role.Name), &role))
+
+				res, err := roleRequest(b, s, logical.UpdateOperation, "static-roles/s1", map[string]interface{}{"account_name": "a2"})
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "account_name and instance cannot be changed")
+
+				res, err = roleRequest(b, s, logical.ReadOperation, "static-roles/s1", nil)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal("a1", res.Data[fldAccountName])
+				a.Equal(defaultRotationPeriod.String(), res.Data[fldRotationPeriod])
+				a.Equal(defaultGracePeriod.String(), res.Data[fldGracePeriod])
+
+				res, err = roleRequest(b, s, logical.ListOperation, "static-roles/", nil)
+				require.NoError(t, err)
+				a.EqualValues([]string{"s1"}, res.Data["keys"])
+			},
+		},
+		{
+			name: "static creds",
+			fn: func(t *testing.T) {
+				res, err := roleRequest(b, s, logical.ReadOperation, "static-creds/missing", nil)
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "static role(missing) does not exist")
+
+				res, err = roleRequest(b, s, logical.ReadOperation, "static-creds/s1", nil)
+				require.NoError(t, err)
+				require.ErrorContains(t, res.Error(), "static role(s1) has no token yet")
+
+				rotatedAt := time.Now().Add(-1 * time.Hour)
+				cred := staticCred{Id: "vault-1", Token: "some-dummy-token", RotatedAt: rotatedAt}
+				require.NoError(t, saveToStorage[staticCred](ctx, s, staticCredStorageKey("s1"), &cred))
+
+				res, err = roleRequest(b, s, logical.ReadOperation, "static-creds/s1", nil)
+				require.NoError(t, err)
+				require.False(t, res.IsError())
+				a := assert.New(t)
+				a.Nil(res.Secret)
+				a.Equal("some-dummy-token", res.Data[fldToken])
+				a.Equal("vault-1", res.Data[fldID])
+				a.WithinDuration(rotatedAt.Add(defaultRotationPeriod), res.Data[fldNextRotation].(time.Time), 0)
+				a.InDelta(int64((23 * time.Hour).Seconds()), res.Data[fldTTL], 5)
+			},
+		},
+		{
+			name: "static creds are seal wrapped",
+			fn: func(t *testing.T) {
+				assert.Contains(t, b.SpecialPaths().SealWrapStorage, staticCredsStoragePrefix)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,280 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	tidyStatusKey   = "tidy-status"
+	fldDryRun       = "dry_run"
+	fldSafetyBuffer = "safety_buffer"
+	fldAccounts     = "accounts"
+	fldProjects     = "projects"
+	fldScope        = "scope"
+	fldBatchSize    = "batch_size"
+	fldBatchReached = "batch_size_reached"
+)
+
+// tidyStatus reports the last run of the tidy endpoint
+type tidyStatus struct {
+	StartedAt     time.Time     `json:"started_at" structs:"started_at" mapstructure:"started_at"`
+	Duration      time.Duration `json:"duration" structs:"duration" mapstructure:"duration"`
+	DryRun        bool          `json:"dry_run" structs:"dry_run" mapstructure:"dry_run"`
+	Scope         string        `json:"scope" structs:"scope" mapstructure:"scope"`
+	AccountTokens int           `json:"account_tokens" structs:"account_tokens" mapstructure:"account_tokens"`
+	ProjectTokens int           `json:"project_tokens" structs:"project_tokens" mapstructure:"project_tokens"`
+	Errors        []string      `json:"errors" structs:"errors" mapstructure:"errors"`
+	// BatchSizeReached tells the run stopped at the batch size, the tidy is run again to delete the remaining expired tokens
+	BatchSizeReached bool `json:"batch_size_reached" structs:"batch_size_reached" mapstructure:"batch_size_reached"`
+}
+
+var tidySchema = map[string]*framework.FieldSchema{
+	fldDryRun: {
+		Type:        framework.TypeBool,
+		Description: `Only report the expired tokens without deleting them (default: false)`,
+	},
+	fldSafetyBuffer: {
+		Type:        framework.TypeDurationSecond,
+		Description: `Only delete the tokens that expired for longer than the safety buffer (default: 0)`,
+	},
+	fldAccounts: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Accounts to tidy. When accounts or projects are set, only the given accounts and projects are tidied`,
+	},
+	fldProjects: {
+		Type:        framework.TypeCommaStringSlice,
+		Description: `Projects to tidy. When accounts or projects are set, only the given accounts and projects are tidied`,
+	},
+	fldBatchSize: {
+		Type:        framework.TypeInt,
+		Description: `Max number of expired tokens deleted by the run, so it completes within the request timeout (default: the gc_batch_size of the config)`,
+	},
+	fldScope: {
+		Type:        framework.TypeString,
+		Description: `Expired tokens to delete: plugin (issued by the plugin), all, or legacy (bare uuid ids, issued before the plugin prefixed them) (default: the gc_scope of the config)`,
+	},
+}
+
+func tidyStatusStorageKey(instance string) string {
+	if instance == "" {
+		return tidyStatusKey
+	}
+
+	return tidyStatusKey + "/" + instance
+}
+
+func (status *tidyStatus) toResponse() *logical.Response {
+	return &logical.Response{
+		Data: map[string]interface{}{
+			"started_at":     status.StartedAt,
+			"duration":       status.Duration.String(),
+			fldDryRun:        status.DryRun,
+			fldScope:         status.Scope,
+			"account_tokens": status.AccountTokens,
+			"project_tokens": status.ProjectTokens,
+			"errors":         status.Errors,
+			fldBatchReached:  status.BatchSizeReached,
+		},
+	}
+}
+
+func pathTidy(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "tidy",
+			Fields:  tidySchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathTidyCallback,
+					Summary:  "deletes the expired tokens from argo cd",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathTidySynopsis),
+			HelpDescription: trimHelp(helpPathTidyDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/tidy", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(tidySchema),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.UpdateOperation: &framework.PathOperation{
+					Callback: b.pathTidyCallback,
+					Summary:  "deletes the expired tokens from a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathTidySynopsis),
+			HelpDescription: trimHelp(helpPathTidyDescription),
+		},
+		{
+			Pattern: "tidy-status",
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathTidyStatusCallback,
+					Summary:  "reports the last tidy run",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathTidyStatusSynopsis),
+			HelpDescription: trimHelp(helpPathTidyStatusDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("%s/tidy-status", framework.GenericNameRegex(fldInstance)),
+			Fields:  withInstanceField(map[string]*framework.FieldSchema{}),
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathTidyStatusCallback,
+					Summary:  "reports the last tidy run of a named argo cd instance",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathTidyStatusSynopsis),
+			HelpDescription: trimHelp(helpPathTidyStatusDescription),
+		},
+	}
+}
+
+func (b *backend) pathTidyCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	config, err := getInstanceConfig(ctx, req, getInstanceFromFieldData(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading config: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	opts, err := getTidyOptions(data, &config)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), nil
+	}
+
+	opts.expiries, err = inventoryExpiries(ctx, req.Storage, config.Instance)
+	if err != nil {
+		b.logger.Error(err.Error())
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	accountCtx, err := NewAccountClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	defer closeClient(b, accountCtx.closer)
+
+	projectCtx, err := NewProjectClient(ctx, b.clients, &config)
+	if err != nil {
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+	defer closeClient(b, projectCtx.closer)
+
+	opts.idPrefix = accountCtx.tokenIdPrefix
+	return b.tidy(ctx, req.Storage, config.Instance, accountCtx, projectCtx, opts)
+}
+
+// getTidyOptions returns the sweep options from the tidy request, with the defaults from the config
+func getTidyOptions(data *framework.FieldData, config *configEntry) (sweepOptions, error) {
+	opts := sweepOptions{
+		scope:        config.GCScope,
+		cutoff:       time.Now(),
+		batchSize:    config.GCBatchSize,
+		maxLifetime:  config.leaseMaxLifetime(),
+		adminTokenId: config.adminTokenId(),
+	}
+
+	if dryRun, err := getFromFieldData[bool](data, fldDryRun); err == nil {
+		opts.dryRun = dryRun
+	}
+
+	if safetyBuffer, err := getFromFieldData[int](data, fldSafetyBuffer); err == nil {
+		opts.cutoff = opts.cutoff.Add(-time.Duration(safetyBuffer) * time.Second)
+	}
+
+	if batchSize, err := getFromFieldData[int](data, fldBatchSize); err == nil {
+		opts.batchSize = batchSize
+	}
+	if opts.batchSize <= 0 {
+		return opts, fmt.Errorf("invalid batch size: batch size(%d) should be greater than 0", opts.batchSize)
+	}
+
+	if scope, err := getFromFieldData[string](data, fldScope); err == nil {
+		opts.scope = scope
+	}
+	if opts.scope != gcScopePlugin && opts.scope != gcScopeAll && opts.scope != gcScopeLegacy {
+		return opts, fmt.Errorf("invalid scope: scope(%s) should be %s, %s or %s", opts.scope, gcScopePlugin, gcScopeAll, gcScopeLegacy)
+	}
+
+	accounts, accountsErr := getFromFieldData[[]string](data, fldAccounts)
+	projects, projectsErr := getFromFieldData[[]string](data, fldProjects)
+	if accountsErr == nil || projectsErr == nil {
+		opts.accounts = append([]string{}, accounts...)
+		opts.projects = append([]string{}, projects...)
+	}
+
+	return opts, nil
+}
+
+// tidy sweeps the expired tokens and records the status of the run
+func (b *backend) tidy(
+	ctx context.Context,
+	storage logical.Storage,
+	instance string,
+	accountCtx *accountClientContext,
+	projectCtx *projectClientContext,
+	opts sweepOptions) (*logical.Response, error) {
+	startedAt := time.Now()
+	result := b.sweepExpiredTokens(accountCtx, projectCtx, opts)
+
+	status := tidyStatus{
+		StartedAt:        startedAt,
+		Duration:         time.Since(startedAt),
+		DryRun:           opts.dryRun,
+		Scope:            opts.scope,
+		Errors:           result.Errors,
+		BatchSizeReached: result.BatchSizeReached,
+	}
+	for _, ids := range result.Accounts {
+		status.AccountTokens += len(ids)
+	}
+	for _, roles := range result.Projects {
+		for _, ids := range roles {
+			status.ProjectTokens += len(ids)
+		}
+	}
+
+	if err := saveToStorage[tidyStatus](ctx, storage, tidyStatusStorageKey(instance), &status); err != nil {
+		errMsg := fmt.Sprintf("error while writing tidy status to storage: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	b.logger.Info(fmt.Sprintf("tidy (dry run: %t) of instance(%s) found %d expired tokens", opts.dryRun, instance, result.Deleted))
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			fldDryRun:       opts.dryRun,
+			fldAccounts:     result.Accounts,
+			fldProjects:     result.Projects,
+			"errors":        result.Errors,
+			fldBatchReached: result.BatchSizeReached,
+		},
+	}, nil
+}
+
+func (b *backend) pathTidyStatusCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	instance := getInstanceFromFieldData(data)
+	status, err := tryReadFromStorage[tidyStatus](ctx, req.Storage, tidyStatusStorageKey(instance))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading tidy status from storage: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if status.StartedAt.IsZero() {
+		return nil, nil
+	}
+
+	return status.toResponse(), nil
+}
@@ -0,0 +1,200 @@
+package plugin
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"time"
+)
+
+func getTidyFieldData(raw map[string]interface{}) *framework.FieldData {
+	return &framework.FieldData{Raw: raw, Schema: tidySchema}
+}
+
+func TestGetTidyOptions(t *testing.T) {
+	config := configEntry{GCScope: gcScopePlugin, GCBatchSize: defaultGCBatchSize}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "defaults",
+			fn: func(t *testing.T) {
+				opts, err := getTidyOptions(getTidyFieldData(map[string]interface{}{}), &config)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.False(opts.dryRun)
+				a.EqualValues(gcScopePlugin, opts.scope)
+				a.EqualValues(defaultGCBatchSize, opts.batchSize)
+				a.Nil(opts.accounts)
+				a.Nil(opts.projects)
+				a.WithinDuration(time.Now(), opts.cutoff, time.Minute)
+			},
+		},
+		{
+			name: "all options",
+			fn: func(t *testing.T) {
+				opts, err := getTidyOptions(getTidyFieldData(map[string]interface{}{
+					fldDryRun:       true,
+					fldSafetyBuffer: "2h",
+					fldBatchSize:    500,
+					fldAccounts:     "a1,a2",
+					fldScope:        gcScopeAll,
+				}), &config)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.True(opts.dryRun)
+				a.EqualValues(500, opts.batchSize)
+				a.EqualValues(gcScopeAll, opts.scope)
+				a.EqualValues([]string{"a1", "a2"}, opts.accounts)
+				a.NotNil(opts.projects)
+				a.Empty(opts.projects)
+				a.WithinDuration(time.Now().Add(-2*time.Hour), opts.cutoff, time.Minute)
+			},
+		},
+		{
+			name: "legacy scope",
+			fn: func(t *testing.T) {
+				opts, err := getTidyOptions(getTidyFieldData(map[string]interface{}{fldScope: gcScopeLegacy}), &config)
+				require.NoError(t, err)
+				assert.EqualValues(t, gcScopeLegacy, opts.scope)
+			},
+		},
+		{
+			name: "invalid batch size",
+			fn: func(t *testing.T) {
+				_, err := getTidyOptions(getTidyFieldData(map[string]interface{}{fldBatchSize: 0}), &config)
+				require.ErrorContains(t, err, "invalid batch size")
+			},
+		},
+		{
+			name: "invalid scope",
+			fn: func(t *testing.T) {
+				_, err := getTidyOptions(getTidyFieldData(map[string]interface{}{fldScope: "some"}), &config)
+				require.Error(t, err)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestTidy(t *testing.T) {
+	b, s := getTestBackend(t)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "no status before the first run",
+			fn: func(t *testing.T) {
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Operation: logical.ReadOperation,
+					Path:      "tidy-status",
+					Storage:   s,
+				})
+				require.NoError(t, err)
+				require.Nil(t, res)
+			},
+		},
+		{
+			name: "dry run",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				res, err := b.tidy(context.Background(), s, "", getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    time.Now(),
+					batchSize: math.MaxInt,
+					dryRun:    true,
+				})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues(true, res.Data[fldDryRun])
+				a.EqualValues(map[string][]string{"a1": {"vault-expired"}, "a2": {"vault-expired-2"}}, res.Data[fldAccounts])
+				a.EqualValues(map[string]map[string][]string{"p1": {"r1": {"vault-expired"}}}, res.Data[fldProjects])
+				a.Empty(accountClient.deleteTokenRequests)
+				a.Empty(projectClient.deleteTokenRequests)
+
+				res, err = b.HandleRequest(context.Background(), &logical.Request{
+					Operation: logical.ReadOperation,
+					Path:      "tidy-status",
+					Storage:   s,
+				})
+				require.NoError(t, err)
+				a.EqualValues(true, res.Data[fldDryRun])
+				a.EqualValues(2, res.Data["account_tokens"])
+				a.EqualValues(1, res.Data["project_tokens"])
+			},
+		},
+		{
+			name: "batch size reached",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				res, err := b.tidy(context.Background(), s, "", getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    time.Now(),
+					batchSize: 2,
+				})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues(true, res.Data[fldBatchReached])
+				a.Len(accountClient.deleteTokenRequests, 2)
+				a.Empty(projectClient.deleteTokenRequests)
+
+				res, err = b.HandleRequest(context.Background(), &logical.Request{
+					Operation: logical.ReadOperation,
+					Path:      "tidy-status",
+					Storage:   s,
+				})
+				require.NoError(t, err)
+				a.EqualValues(true, res.Data[fldBatchReached])
+
+				// the batch size is not reached when no expired token is left
+				accountClient, projectClient = getTestSweepClients()
+				res, err = b.tidy(context.Background(), s, "", getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopePlugin,
+					cutoff:    time.Now(),
+					batchSize: 3,
+				})
+				require.NoError(t, err)
+				a.EqualValues(false, res.Data[fldBatchReached])
+				a.Len(projectClient.deleteTokenRequests, 1)
+			},
+		},
+		{
+			name: "status is kept per instance",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestSweepClients()
+				_, err := b.tidy(context.Background(), s, "other", getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), sweepOptions{
+					scope:     gcScopeAll,
+					cutoff:    time.Now(),
+					batchSize: math.MaxInt,
+				})
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Len(accountClient.deleteTokenRequests, 3)
+				a.Len(projectClient.deleteTokenRequests, 2)
+
+				res, err := b.HandleRequest(context.Background(), &logical.Request{
+					Operation: logical.ReadOperation,
+					Path:      "other/tidy-status",
+					Storage:   s,
+				})
+				require.NoError(t, err)
+				a.EqualValues(false, res.Data[fldDryRun])
+				a.EqualValues(3, res.Data["account_tokens"])
+				a.EqualValues(2, res.Data["project_tokens"])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
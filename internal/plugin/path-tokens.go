@@ -0,0 +1,261 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	issuedTokensStoragePrefix = "tokens/"
+	fldSecretType             = "secret_type"
+	fldEntityID               = "entity_id"
+	fldDisplayName            = "display_name"
+	// fldVaultRoleName is the role the token was issued from, fldRoleName is the name of the role on the roles path
+	fldVaultRoleName = "role_name"
+)
+
+// issuedToken is the inventory record of a token issued by the plugin, kept until its lease is revoked.
+// The token itself is never recorded
+type issuedToken struct {
+	Id              string    `json:"id" structs:"id" mapstructure:"id"`
+	SecretType      string    `json:"secret_type" structs:"secret_type" mapstructure:"secret_type"`
+	Instance        string    `json:"instance" structs:"instance" mapstructure:"instance"`
+	AccountName     string    `json:"account_name" structs:"account_name" mapstructure:"account_name"`
+	ProjectName     string    `json:"project_name" structs:"project_name" mapstructure:"project_name"`
+	ProjectRoleName string    `json:"project_role_name" structs:"project_role_name" mapstructure:"project_role_name"`
+	ApplicationName string    `json:"application_name" structs:"application_name" mapstructure:"application_name"`
+	RoleName        string    `json:"role_name" structs:"role_name" mapstructure:"role_name"`
+	EntityID        string    `json:"entity_id" structs:"entity_id" mapstructure:"entity_id"`
+	DisplayName     string    `json:"display_name" structs:"display_name" mapstructure:"display_name"`
+	IssuedAt        time.Time `json:"issued_at" structs:"issued_at" mapstructure:"issued_at"`
+	ExpiresAt       time.Time `json:"expires_at" structs:"expires_at" mapstructure:"expires_at"`
+	// ConfigFingerprint keeps the retained connection profile of the token (profile.go) until its lease is revoked
+	ConfigFingerprint string `json:"config_fingerprint" structs:"config_fingerprint" mapstructure:"config_fingerprint"`
+}
+
+func issuedTokenStorageKey(id string) string {
+	return issuedTokensStoragePrefix + id
+}
+
+// newIssuedToken returns the inventory record of the token issued in the response to the request, roleName is set for the tokens issued from a role
+func newIssuedToken(req *logical.Request, roleName string, response *logical.Response, now time.Time) (issuedToken, error) {
+	leaseData := response.Secret.InternalData
+	id, err := getFromData[string](leaseData, fldID)
+	if err != nil {
+		return issuedToken{}, err
+	}
+
+	secretType, err := getFromData[string](leaseData, fldSecretType)
+	if err != nil {
+		return issuedToken{}, err
+	}
+
+	token := issuedToken{
+		Id:          id,
+		SecretType:  secretType,
+		Instance:    getInstanceFromData(leaseData),
+		RoleName:    roleName,
+		EntityID:    req.EntityID,
+		DisplayName: req.DisplayName,
+		IssuedAt:    now,
+	}
+	token.AccountName, _ = getFromData[string](leaseData, fldAccountName)
+	token.ProjectName, _ = getFromData[string](leaseData, fldProjectName)
+	token.ProjectRoleName, _ = getFromData[string](leaseData, fldProjectRoleName)
+	token.ApplicationName, _ = getFromData[string](leaseData, fldApplicationName)
+	token.ConfigFingerprint, _ = getFromData[string](leaseData, fldConfigFingerprint)
+	// the renewable leases of the lease governed tokens expire at the latest after their max ttl
+	if response.Secret.Renewable && response.Secret.MaxTTL > 0 {
+		token.ExpiresAt = now.Add(response.Secret.MaxTTL)
+	} else if response.Secret.TTL > 0 {
+		token.ExpiresAt = now.Add(response.Secret.TTL)
+	}
+
+	return token, nil
+}
+
+func (token *issuedToken) toResponseData() map[string]interface{} {
+	return map[string]interface{}{
+		fldID:              token.Id,
+		fldSecretType:      token.SecretType,
+		fldInstance:        token.Instance,
+		fldAccountName:     token.AccountName,
+		fldProjectName:     token.ProjectName,
+		fldProjectRoleName: token.ProjectRoleName,
+		fldApplicationName: token.ApplicationName,
+		fldVaultRoleName:   token.RoleName,
+		fldEntityID:        token.EntityID,
+		fldDisplayName:     token.DisplayName,
+		fldIssuedAt:        token.IssuedAt,
+		fldExpiresAt:       token.ExpiresAt,
+	}
+}
+
+// matches returns true if the token matches all the filters that are set
+func (token *issuedToken) matches(filters *issuedTokenFilters) bool {
+	return (filters.accountName == "" || filters.accountName == token.AccountName) &&
+		(filters.projectName == "" || filters.projectName == token.ProjectName) &&
+		(filters.projectRoleName == "" || filters.projectRoleName == token.ProjectRoleName) &&
+		(filters.roleName == "" || filters.roleName == token.RoleName)
+}
+
+// issuedTokenFilters selects the tokens listed from the inventory, empty filters match all the tokens
+type issuedTokenFilters struct {
+	accountName     string
+	projectName     string
+	projectRoleName string
+	roleName        string
+}
+
+func getIssuedTokenFilters(data *framework.FieldData) issuedTokenFilters {
+	filters := issuedTokenFilters{}
+	filters.accountName, _ = getFromFieldData[string](data, fldAccountName)
+	filters.projectName, _ = getFromFieldData[string](data, fldProjectName)
+	filters.projectRoleName, _ = getFromFieldData[string](data, fldProjectRoleName)
+	filters.roleName, _ = getFromFieldData[string](data, fldVaultRoleName)
+
+	return filters
+}
+
+var listIssuedTokensSchema = map[string]*framework.FieldSchema{
+	fldAccountName: {
+		Type:        framework.TypeString,
+		Description: `Only list the tokens of the account`,
+	},
+	fldProjectName: {
+		Type:        framework.TypeString,
+		Description: `Only list the tokens of the project`,
+	},
+	fldProjectRoleName: {
+		Type:        framework.TypeString,
+		Description: `Only list the tokens of the project role`,
+	},
+	fldVaultRoleName: {
+		Type:        framework.TypeString,
+		Description: `Only list the tokens issued from the role`,
+	},
+}
+
+var readIssuedTokenSchema = map[string]*framework.FieldSchema{
+	fldID: {
+		Type:        framework.TypeString,
+		Description: `Id of the token`,
+	},
+}
+
+func pathTokens(b *backend) []*framework.Path {
+	return []*framework.Path{
+		{
+			Pattern: "tokens/?$",
+			Fields:  listIssuedTokensSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ListOperation: &framework.PathOperation{
+					Callback: b.pathIssuedTokensList,
+					Summary:  "lists the tokens issued by the plugin whose lease was not revoked",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathTokensListSynopsis),
+			HelpDescription: trimHelp(helpPathTokensListDescription),
+		},
+		{
+			Pattern: fmt.Sprintf("tokens/%s", framework.GenericNameRegex(fldID)),
+			Fields:  readIssuedTokenSchema,
+			Operations: map[logical.Operation]framework.OperationHandler{
+				logical.ReadOperation: &framework.PathOperation{
+					Callback: b.pathIssuedTokenRead,
+					Summary:  "reads the inventory record of a token issued by the plugin",
+				},
+			},
+			HelpSynopsis:    trimHelp(helpPathTokensSynopsis),
+			HelpDescription: trimHelp(helpPathTokensDescription),
+		},
+	}
+}
+
+func (b *backend) pathIssuedTokensList(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	tokens, err := listIssuedTokens(ctx, req.Storage, getIssuedTokenFilters(data))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while listing the issued tokens: %s", err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	ids := make([]string, 0, len(tokens))
+	keyInfo := map[string]interface{}{}
+	for _, token := range tokens {
+		ids = append(ids, token.Id)
+		keyInfo[token.Id] = token.toResponseData()
+	}
+
+	return logical.ListResponseWithInfo(ids, keyInfo), nil
+}
+
+func (b *backend) pathIssuedTokenRead(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
+	id, err := getFromFieldData[string](data, fldID)
+	if err != nil {
+		return logical.ErrorResponse(err.Error()), err
+	}
+
+	token, err := tryReadFromStorage[issuedToken](ctx, req.Storage, issuedTokenStorageKey(id))
+	if err != nil {
+		errMsg := fmt.Sprintf("error while reading the issued token(%s): %s", id, err)
+		b.logger.Error(errMsg)
+		return logical.ErrorResponse(errMsg), err
+	}
+
+	if token.Id == "" {
+		return nil, nil
+	}
+
+	return &logical.Response{Data: token.toResponseData()}, nil
+}
+
+// listIssuedTokens returns the tokens of the inventory matching the filters
+func listIssuedTokens(ctx context.Context, storage logical.Storage, filters issuedTokenFilters) ([]issuedToken, error) {
+	ids, err := storage.List(ctx, issuedTokensStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	tokens := make([]issuedToken, 0, len(ids))
+	for _, id := range ids {
+		token, err := tryReadFromStorage[issuedToken](ctx, storage, issuedTokenStorageKey(id))
+		if err != nil {
+			return nil, fmt.Errorf("error while reading the issued token(%s): %s", id, err)
+		}
+		if token.Id != "" && token.matches(&filters) {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens, nil
+}
+
+// recordIssuedToken adds the token issued in the response to the inventory.
+// The token is already created in argo cd and its lease is returned even when it cannot be recorded, with a warning
+func (b *backend) recordIssuedToken(ctx context.Context, req *logical.Request, roleName string, response *logical.Response) {
+	if response == nil || response.Secret == nil {
+		return
+	}
+
+	token, err := newIssuedToken(req, roleName, response, time.Now())
+	if err == nil {
+		err = saveToStorage[issuedToken](ctx, req.Storage, issuedTokenStorageKey(token.Id), &token)
+	}
+	if err != nil {
+		errMsg := fmt.Sprintf("error while recording the issued token in the inventory: %s", err)
+		b.logger.Error(errMsg)
+		response.AddWarning(errMsg)
+	}
+}
+
+// forgetIssuedToken removes the token from the inventory once its lease is revoked
+func (b *backend) forgetIssuedToken(ctx context.Context, storage logical.Storage, id string) {
+	if err := storage.Delete(ctx, issuedTokenStorageKey(id)); err != nil {
+		b.logger.Error(fmt.Sprintf("error while removing token(%s) from the inventory: %s", id, err))
+	}
+}
@@ -0,0 +1,110 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/project"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func tokensRequest(t *testing.T, b *backend, s logical.Storage, op logical.Operation, path string, d map[string]interface{}) *logical.Response {
+	res, err := b.HandleRequest(context.Background(), &logical.Request{
+		Operation: op,
+		Path:      path,
+		Storage:   s,
+		Data:      d,
+	})
+	require.NoError(t, err)
+	return res
+}
+
+func TestIssuedTokens(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	req := &logical.Request{Storage: s, EntityID: "some-entity", DisplayName: "some-user"}
+
+	accountClient := testAccountClient{createTokenResponse: &account.CreateTokenResponse{Token: "some-token"}}
+	accountRes, err := b.getAccountToken(getTestAccountClientContext(&accountClient), "some-account", time.Hour)
+	require.NoError(t, err)
+	b.recordIssuedToken(ctx, req, "", accountRes)
+
+	projectClient := testProjectClient{createTokenResponse: &project.ProjectTokenResponse{Token: "some-token"}}
+	projectRes, err := b.getProjectToken(getTestProjectClientContext(&projectClient), "some-project", "some-role", time.Hour)
+	require.NoError(t, err)
+	b.recordIssuedToken(ctx, req, "r1", projectRes)
+
+	accountId := accountRes.Data[fldID].(string)
+	projectId := projectRes.Data[fldID].(string)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "read",
+			fn: func(t *testing.T) {
+				res := tokensRequest(t, b, s, logical.ReadOperation, "tokens/"+accountId, nil)
+				a := assert.New(t)
+				a.Equal(accountId, res.Data[fldID])
+				a.Equal(accountTokenSecretType, res.Data[fldSecretType])
+				a.Equal("some-account", res.Data[fldAccountName])
+				a.Equal("some-entity", res.Data[fldEntityID])
+				a.Equal("some-user", res.Data[fldDisplayName])
+				a.WithinDuration(res.Data[fldIssuedAt].(time.Time).Add(time.Hour), res.Data[fldExpiresAt].(time.Time), time.Second)
+				a.NotContains(res.Data, fldToken)
+			},
+		},
+		{
+			name: "read missing",
+			fn: func(t *testing.T) {
+				require.Nil(t, tokensRequest(t, b, s, logical.ReadOperation, "tokens/missing", nil))
+			},
+		},
+		{
+			name: "list",
+			fn: func(t *testing.T) {
+				res := tokensRequest(t, b, s, logical.ListOperation, "tokens/", nil)
+				assert.ElementsMatch(t, []string{accountId, projectId}, res.Data["keys"])
+			},
+		},
+		{
+			name: "list with filters",
+			fn: func(t *testing.T) {
+				a := assert.New(t)
+				res := tokensRequest(t, b, s, logical.ListOperation, "tokens/", map[string]interface{}{fldAccountName: "some-account"})
+				a.Equal([]string{accountId}, res.Data["keys"])
+
+				res = tokensRequest(t, b, s, logical.ListOperation, "tokens/", map[string]interface{}{fldProjectName: "some-project", fldProjectRoleName: "some-role"})
+				a.Equal([]string{projectId}, res.Data["keys"])
+
+				res = tokensRequest(t, b, s, logical.ListOperation, "tokens/", map[string]interface{}{fldVaultRoleName: "r1"})
+				a.Equal([]string{projectId}, res.Data["keys"])
+
+				res = tokensRequest(t, b, s, logical.ListOperation, "tokens/", map[string]interface{}{fldVaultRoleName: "r2"})
+				a.Empty(res.Data["keys"])
+			},
+		},
+		{
+			name: "forget",
+			fn: func(t *testing.T) {
+				b.forgetIssuedToken(ctx, s, accountId)
+				require.Nil(t, tokensRequest(t, b, s, logical.ReadOperation, "tokens/"+accountId, nil))
+			},
+		},
+		{
+			name: "error responses are not recorded",
+			fn: func(t *testing.T) {
+				b.recordIssuedToken(ctx, req, "", logical.ErrorResponse("some error"))
+				res := tokensRequest(t, b, s, logical.ListOperation, "tokens/", nil)
+				assert.Equal(t, []string{projectId}, res.Data["keys"])
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,69 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+// periodicFunc is invoked by vault on a schedule (about every minute) to run the background jobs of the plugin
+func (b *backend) periodicFunc(ctx context.Context, req *logical.Request) error {
+	configs, err := listConfigs(ctx, req)
+	if err != nil {
+		b.logger.Error(fmt.Sprintf("error while listing the argo cd instances: %s", err))
+		return err
+	}
+
+	for i := range configs {
+		config := &configs[i]
+		if err := b.rotateRootIfDue(ctx, req, config); err != nil {
+			b.logger.Error(fmt.Sprintf("error while rotating the admin token of instance(%s): %s", config.Instance, err))
+		}
+		if err := b.sweepIfDue(ctx, req.Storage, config); err != nil {
+			b.logger.Error(fmt.Sprintf("error while running the garbage collector for instance(%s): %s", config.Instance, err))
+		}
+		if err := b.reconcileIfDue(ctx, req, config); err != nil {
+			b.logger.Error(fmt.Sprintf("error while reconciling instance(%s): %s", config.Instance, err))
+		}
+	}
+
+	if err := b.retryPendingRevocations(ctx, req, b.revokePending); err != nil {
+		b.logger.Error(fmt.Sprintf("error while retrying the pending revocations: %s", err))
+	}
+
+	if err := b.rotateStaticRoles(ctx, req); err != nil {
+		b.logger.Error(fmt.Sprintf("error while rotating the static roles: %s", err))
+	}
+
+	if err := b.pruneProfiles(ctx, req.Storage, b.System().MaxLeaseTTL(), time.Now()); err != nil {
+		b.logger.Error(fmt.Sprintf("error while pruning the retained connection profiles: %s", err))
+	}
+
+	return nil
+}
+
+// listConfigs returns the config of the default instance, if set, and of all the named instances
+func listConfigs(ctx context.Context, req *logical.Request) ([]configEntry, error) {
+	instances, err := req.Storage.List(ctx, cfgStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	configs := make([]configEntry, 0, len(instances)+1)
+	for _, instance := range append([]string{""}, instances...) {
+		config, err := tryReadFromStorage[configEntry](ctx, req.Storage, configStorageKey(instance))
+		if err != nil {
+			return nil, err
+		}
+		if config.ArgoCDUrl == "" {
+			continue
+		}
+		config.applyGCDefaults()
+		config.Instance = instance
+		configs = append(configs, config)
+	}
+
+	return configs, nil
+}
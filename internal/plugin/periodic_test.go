@@ -0,0 +1,71 @@
+package plugin
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestListConfigs(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+
+	configs, err := listConfigs(context.Background(), r)
+	require.NoError(t, err)
+	require.Empty(t, configs)
+
+	r.Operation = logical.UpdateOperation
+	r.Path = "config/i1"
+	r.Data = map[string]interface{}{"argo_cd_url": "argocd-1.wfecd.splunk.lol", "admin_token": "some-dummy-token-1", "gc_interval": 0, "reconcile_interval": 0}
+	_, err = b.HandleRequest(context.Background(), r)
+	require.NoError(t, err)
+	updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd.wfecd.splunk.lol", "admin_token": "some-dummy-token", "gc_interval": 0, "reconcile_interval": 0})
+
+	configs, err = listConfigs(context.Background(), r)
+	require.NoError(t, err)
+	a := assert.New(t)
+	a.Len(configs, 2)
+	a.EqualValues("", configs[0].Instance)
+	a.EqualValues("argocd.wfecd.splunk.lol", configs[0].ArgoCDUrl)
+	a.EqualValues("i1", configs[1].Instance)
+	a.EqualValues("argocd-1.wfecd.splunk.lol", configs[1].ArgoCDUrl)
+
+	// nothing is due, so the periodic func has nothing to do
+	require.NoError(t, b.periodicFunc(context.Background(), r))
+}
+
+func TestLegacyConfigGCDefaults(t *testing.T) {
+	_, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+
+	// config written before the garbage collector existed
+	legacy := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "some-dummy-token", AccountTokenMaxTTL: 6 * time.Hour}
+	require.NoError(t, saveToStorage[configEntry](context.Background(), s, configStorageKey(""), &legacy))
+
+	configs, err := listConfigs(context.Background(), r)
+	require.NoError(t, err)
+	require.Len(t, configs, 1)
+	a := assert.New(t)
+	a.EqualValues(gcScopePlugin, configs[0].GCScope)
+	a.EqualValues(defaultGCInterval, configs[0].GCInterval)
+	a.EqualValues(defaultGCBatchSize, configs[0].GCBatchSize)
+
+	config, err := getConfig(context.Background(), r)
+	require.NoError(t, err)
+	a.EqualValues(configs[0], config)
+
+	opts, err := getTidyOptions(getTidyFieldData(map[string]interface{}{}), &config)
+	require.NoError(t, err)
+	a.EqualValues(gcScopePlugin, opts.scope)
+
+	// the gc interval of the configs written since is kept, 0 disables the garbage collector
+	disabled := configEntry{ArgoCDUrl: "argocd.wfecd.splunk.lol", AdminToken: "some-dummy-token", GCScope: gcScopeAll, GCBatchSize: 10}
+	require.NoError(t, saveToStorage[configEntry](context.Background(), s, configStorageKey(""), &disabled))
+	config, err = getConfig(context.Background(), r)
+	require.NoError(t, err)
+	a.Zero(config.GCInterval)
+	a.EqualValues(gcScopeAll, config.GCScope)
+}
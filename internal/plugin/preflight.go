@@ -0,0 +1,72 @@
+package plugin
+
+import (
+	"fmt"
+	"slices"
+	"time"
+
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// accountCheckTTL is how long the result of an account preflight is reused
+	accountCheckTTL      = 30 * time.Second
+	apiKeyCapability     = "apiKey"
+	accountCheckCapacity = 1000
+)
+
+// accountCheck is the cached result of an account preflight, reason is empty when tokens can be issued for the account
+type accountCheck struct {
+	reason    string
+	checkedAt time.Time
+}
+
+// accountCheckReason returns the reason why tokens cannot be issued for the account, empty if they can. A nil account does not exist
+func accountCheckReason(accountName string, acc *account.Account) string {
+	switch {
+	case acc == nil:
+		return fmt.Sprintf("account(%s) does not exist in argo cd", accountName)
+	case !acc.Enabled:
+		return fmt.Sprintf("account(%s) is disabled in argo cd", accountName)
+	case !slices.Contains(acc.Capabilities, apiKeyCapability):
+		return fmt.Sprintf("account(%s) does not have the %s capability in argo cd", accountName, apiKeyCapability)
+	default:
+		return ""
+	}
+}
+
+// preflightAccount checks that tokens can be issued for the account before creating one, and returns a bad request response when they cannot.
+// The results are cached for accountCheckTTL. When argo cd cannot be queried the check is skipped and the token creation reports the error
+func (b *backend) preflightAccount(clientCtx *accountClientContext, accountName string) *logical.Response {
+	key := clientCtx.fingerprint + "/" + accountName
+
+	b.accountChecksLock.Lock()
+	check, ok := b.accountChecks[key]
+	b.accountChecksLock.Unlock()
+
+	if !ok || time.Since(check.checkedAt) > accountCheckTTL {
+		acc, err := clientCtx.GetAccount(accountName)
+		if isNotFound(err) {
+			acc = nil
+		} else if err != nil {
+			b.logger.Warn(fmt.Sprintf("skipping the preflight of account(%s): %s", accountName, err))
+			return nil
+		}
+
+		check = accountCheck{reason: accountCheckReason(accountName, acc), checkedAt: time.Now()}
+		b.accountChecksLock.Lock()
+		if len(b.accountChecks) >= accountCheckCapacity {
+			b.accountChecks = map[string]accountCheck{}
+		}
+		b.accountChecks[key] = check
+		b.accountChecksLock.Unlock()
+	}
+
+	if check.reason == "" {
+		return nil
+	}
+
+	b.logger.Info(check.reason)
+	return logical.ErrorResponse(check.reason)
+}
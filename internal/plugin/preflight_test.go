@@ -0,0 +1,83 @@
+package plugin
+
+import (
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestPreflightAccount(t *testing.T) {
+	b, _ := getTestBackend(t)
+	accountClient := testAccountClient{
+		accounts: []*account.Account{
+			{Name: "valid", Enabled: true, Capabilities: []string{"login", "apiKey"}},
+			{Name: "disabled", Enabled: false, Capabilities: []string{"apiKey"}},
+			{Name: "login-only", Enabled: true, Capabilities: []string{"login"}},
+		},
+	}
+	clientCtx := getTestAccountClientContext(&accountClient)
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "valid account",
+			fn: func(t *testing.T) {
+				require.Nil(t, b.preflightAccount(clientCtx, "valid"))
+			},
+		},
+		{
+			name: "unknown account",
+			fn: func(t *testing.T) {
+				res := b.preflightAccount(clientCtx, "unknown")
+				require.True(t, res.IsError())
+				require.ErrorContains(t, res.Error(), "account(unknown) does not exist")
+			},
+		},
+		{
+			name: "disabled account",
+			fn: func(t *testing.T) {
+				res := b.preflightAccount(clientCtx, "disabled")
+				require.ErrorContains(t, res.Error(), "account(disabled) is disabled")
+			},
+		},
+		{
+			name: "missing apiKey capability",
+			fn: func(t *testing.T) {
+				res := b.preflightAccount(clientCtx, "login-only")
+				require.ErrorContains(t, res.Error(), "does not have the apiKey capability")
+			},
+		},
+		{
+			name: "results are cached",
+			fn: func(t *testing.T) {
+				accountClient.accounts[0].Enabled = false
+				defer func() { accountClient.accounts[0].Enabled = true }()
+				require.Nil(t, b.preflightAccount(clientCtx, "valid"))
+
+				check := b.accountChecks["/valid"]
+				check.checkedAt = time.Now().Add(-2 * accountCheckTTL)
+				b.accountChecks["/valid"] = check
+				require.NotNil(t, b.preflightAccount(clientCtx, "valid"))
+			},
+		},
+		{
+			name: "skipped when argo cd cannot be queried",
+			fn: func(t *testing.T) {
+				unavailableClient := testAccountClient{getAccountError: status.Error(codes.Unavailable, "unavailable")}
+				unavailableCtx := getTestAccountClientContext(&unavailableClient)
+				unavailableCtx.fingerprint = "other"
+				require.Nil(t, b.preflightAccount(unavailableCtx, "valid"))
+				assert.NotContains(t, b.accountChecks, "other/valid")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
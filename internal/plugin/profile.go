@@ -0,0 +1,215 @@
+package plugin
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	profileStoragePrefix       = "profiles/"
+	legacyProfileStoragePrefix = "profiles/legacy/"
+	fldConfigFingerprint       = "config_fingerprint"
+)
+
+// fingerprint identifies the argo cd server the config connects to.
+// The admin token is not part of the fingerprint, so rotating it does not orphan the existing leases
+func (c *configEntry) fingerprint() string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%t|%t", c.ArgoCDUrl, c.Insecure, c.Plaintext)))
+	return hex.EncodeToString(hash[:])
+}
+
+// retainedProfile is a connection config kept for the leases it issued, it is read as a configEntry by the revocations
+type retainedProfile struct {
+	configEntry
+	RetainedAt time.Time `json:"retained_at"`
+}
+
+// profileId identifies the connection profile retained by the instance for the given config fingerprint.
+// Instances connecting to the same server each retain their own admin token
+func profileId(instance string, fingerprint string) string {
+	hash := sha256.Sum256([]byte(fmt.Sprintf("%s|%s", instance, fingerprint)))
+	return hex.EncodeToString(hash[:])
+}
+
+func profileStorageKey(id string) string {
+	return profileStoragePrefix + id
+}
+
+func legacyProfileStorageKey(instance string) string {
+	return legacyProfileStoragePrefix + instance
+}
+
+// retainProfile keeps the connection config that is about to be replaced by next, or deleted when next is nil,
+// so the leases issued with it can still be revoked against the right argo cd server.
+// Nothing is retained when next still connects to the same server, as the current config then revokes the leases
+func retainProfile(ctx context.Context, storage logical.Storage, existing *configEntry, next *configEntry, now time.Time) error {
+	if existing.ArgoCDUrl == "" || (next != nil && next.fingerprint() == existing.fingerprint()) {
+		return nil
+	}
+
+	profile := retainedProfile{configEntry: *existing, RetainedAt: now}
+	if err := saveToStorage[retainedProfile](ctx, storage, profileStorageKey(profileId(existing.Instance, existing.fingerprint())), &profile); err != nil {
+		return err
+	}
+
+	// leases created before the config fingerprint was recorded were issued with the config
+	// that was in place when this version first replaced it
+	legacyProfile, err := tryReadFromStorage[configEntry](ctx, storage, legacyProfileStorageKey(existing.Instance))
+	if err != nil {
+		return err
+	}
+	if legacyProfile.ArgoCDUrl == "" {
+		return saveToStorage[retainedProfile](ctx, storage, legacyProfileStorageKey(existing.Instance), &profile)
+	}
+
+	return nil
+}
+
+// pruneProfiles deletes the retained profiles no lease can be revoked with anymore: the profiles retained longer than the max lease ttl ago,
+// whose instance and fingerprint are neither recorded by an issued token nor by a pending revocation
+func (b *backend) pruneProfiles(ctx context.Context, storage logical.Storage, maxLeaseTTL time.Duration, now time.Time) error {
+	keys, err := storage.List(ctx, profileStoragePrefix)
+	if err != nil || len(keys) == 0 {
+		return err
+	}
+
+	ids, legacyInstances, err := referencedProfiles(ctx, storage)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range keys {
+		if strings.HasSuffix(id, "/") {
+			continue
+		}
+		if err := b.pruneProfile(ctx, storage, profileStorageKey(id), ids[id], maxLeaseTTL, now); err != nil {
+			return err
+		}
+	}
+
+	instances, err := storage.List(ctx, legacyProfileStoragePrefix)
+	if err != nil {
+		return err
+	}
+	for _, instance := range instances {
+		if err := b.pruneProfile(ctx, storage, legacyProfileStorageKey(instance), legacyInstances[instance], maxLeaseTTL, now); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// pruneProfile deletes the retained profile once it is not referenced and older than the max lease ttl.
+// The profiles retained before their retention time was recorded are kept for another max lease ttl
+func (b *backend) pruneProfile(ctx context.Context, storage logical.Storage, key string, referenced bool, maxLeaseTTL time.Duration, now time.Time) error {
+	profile, err := tryReadFromStorage[retainedProfile](ctx, storage, key)
+	if err != nil || profile.ArgoCDUrl == "" {
+		return err
+	}
+
+	if profile.RetainedAt.IsZero() {
+		profile.RetainedAt = now
+		return saveToStorage[retainedProfile](ctx, storage, key, &profile)
+	}
+
+	if referenced || now.Before(profile.RetainedAt.Add(maxLeaseTTL)) {
+		return nil
+	}
+
+	b.logger.Info(fmt.Sprintf("deleting the retained connection profile(%s) of argo cd server(%s) as no lease uses it anymore", key, profile.ArgoCDUrl))
+	return storage.Delete(ctx, key)
+}
+
+// referencedProfiles returns the ids of the profiles of the issued tokens and of the pending revocations,
+// and the instances of the pending revocations without fingerprint, which are revoked with the legacy profiles.
+// The profiles retained before they were keyed by instance are referenced by the bare fingerprint
+func referencedProfiles(ctx context.Context, storage logical.Storage) (map[string]bool, map[string]bool, error) {
+	ids := map[string]bool{}
+	legacyInstances := map[string]bool{}
+
+	tokens, err := listIssuedTokens(ctx, storage, issuedTokenFilters{})
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, token := range tokens {
+		ids[profileId(token.Instance, token.ConfigFingerprint)] = true
+		ids[token.ConfigFingerprint] = true
+	}
+
+	revocations, err := storage.List(ctx, pendingRevocationsStoragePrefix)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, id := range revocations {
+		rev, err := tryReadFromStorage[pendingRevocation](ctx, storage, pendingRevocationStorageKey(id))
+		if err != nil {
+			return nil, nil, err
+		}
+		instance := getInstanceFromData(rev.LeaseData)
+		if fingerprint, err := getFromData[string](rev.LeaseData, fldConfigFingerprint); err == nil {
+			ids[profileId(instance, fingerprint)] = true
+			ids[fingerprint] = true
+		} else {
+			legacyInstances[instance] = true
+		}
+	}
+
+	return ids, legacyInstances, nil
+}
+
+// getLeaseConfig returns the config of the argo cd server the lease was issued by.
+// The current config of the instance is used when it still points to the same server, a retained profile otherwise
+func getLeaseConfig(ctx context.Context, req *logical.Request) (configEntry, error) {
+	return getLeaseConfigFromData(ctx, req, req.Secret.InternalData)
+}
+
+// getLeaseConfigFromData returns the config of the argo cd server that issued the lease with the given internal data
+func getLeaseConfigFromData(ctx context.Context, req *logical.Request, leaseData map[string]interface{}) (configEntry, error) {
+	instance := getInstanceFromData(leaseData)
+	config, configErr := getInstanceConfig(ctx, req, instance)
+
+	leaseFingerprint, err := getFromData[string](leaseData, fldConfigFingerprint)
+	if err != nil {
+		legacyProfile, err := tryReadFromStorage[configEntry](ctx, req.Storage, legacyProfileStorageKey(instance))
+		if err != nil {
+			return legacyProfile, err
+		}
+		if legacyProfile.ArgoCDUrl != "" && (configErr != nil || legacyProfile.fingerprint() != config.fingerprint()) {
+			return legacyProfile, nil
+		}
+
+		return config, configErr
+	}
+
+	if configErr == nil && config.fingerprint() == leaseFingerprint {
+		return config, nil
+	}
+
+	profile, err := tryReadFromStorage[configEntry](ctx, req.Storage, profileStorageKey(profileId(instance, leaseFingerprint)))
+	if err != nil {
+		return profile, err
+	}
+	if profile.ArgoCDUrl != "" {
+		return profile, nil
+	}
+
+	// the profiles retained before they were keyed by instance are shared by the instances of the same server,
+	// they are only used by the instance that retained them
+	profile, err = tryReadFromStorage[configEntry](ctx, req.Storage, profileStorageKey(leaseFingerprint))
+	if err != nil {
+		return profile, err
+	}
+	if profile.ArgoCDUrl != "" && profile.Instance == instance {
+		return profile, nil
+	}
+
+	leaseServer, _ := getFromData[string](leaseData, cfgFldArgoCdUrl)
+	return configEntry{}, fmt.Errorf("lease was issued by argo cd server(%s) with config fingerprint(%s) which is no longer configured for instance(%s) and has no retained connection profile", leaseServer, leaseFingerprint, instance)
+}
@@ -0,0 +1,244 @@
+package plugin
+
+import (
+	"context"
+	"github.com/hashicorp/vault/sdk/logical"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func leaseRequest(s logical.Storage, internalData map[string]interface{}) *logical.Request {
+	return &logical.Request{
+		Storage: s,
+		Secret: &logical.Secret{
+			InternalData: internalData,
+		},
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	c1 := configEntry{ArgoCDUrl: "argocd-1.wfecd.splunk.lol", AdminToken: "t1"}
+	c2 := configEntry{ArgoCDUrl: "argocd-1.wfecd.splunk.lol", AdminToken: "t2"}
+	c3 := configEntry{ArgoCDUrl: "argocd-2.wfecd.splunk.lol", AdminToken: "t1"}
+	c4 := configEntry{ArgoCDUrl: "argocd-1.wfecd.splunk.lol", AdminToken: "t1", Plaintext: true}
+	a := assert.New(t)
+	a.EqualValues(c1.fingerprint(), c2.fingerprint())
+	a.NotEqualValues(c1.fingerprint(), c3.fingerprint())
+	a.NotEqualValues(c1.fingerprint(), c4.fingerprint())
+}
+
+func TestGetLeaseConfig(t *testing.T) {
+	b, s := getTestBackend(t)
+	r := &logical.Request{Storage: s}
+	old := configEntry{ArgoCDUrl: "argocd-1.wfecd.splunk.lol", AdminToken: "some-dummy-token-1"}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "legacy lease without config uses the current config",
+			fn: func(t *testing.T) {
+				_, err := getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{fldID: "some-id"}))
+				require.ErrorContains(t, err, "error while reading the storage entry")
+
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": old.ArgoCDUrl, "admin_token": old.AdminToken})
+				c, err := getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{fldID: "some-id"}))
+				require.NoError(t, err)
+				require.EqualValues(t, old.ArgoCDUrl, c.ArgoCDUrl)
+			},
+		},
+		{
+			name: "lease of the current config",
+			fn: func(t *testing.T) {
+				c, err := getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{
+					fldID:                "some-id",
+					fldConfigFingerprint: old.fingerprint(),
+				}))
+				require.NoError(t, err)
+				require.EqualValues(t, old.ArgoCDUrl, c.ArgoCDUrl)
+			},
+		},
+		{
+			name: "admin token rotation keeps the same server",
+			fn: func(t *testing.T) {
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": old.ArgoCDUrl, "admin_token": "some-dummy-token-2"})
+				c, err := getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{
+					fldID:                "some-id",
+					fldConfigFingerprint: old.fingerprint(),
+				}))
+				require.NoError(t, err)
+				require.EqualValues(t, "some-dummy-token-2", c.AdminToken)
+
+				// legacy leases use the current config as it still points to the same server
+				c, err = getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{fldID: "some-id"}))
+				require.NoError(t, err)
+				require.EqualValues(t, "some-dummy-token-2", c.AdminToken)
+
+				// no profile is retained while the config points to the same server
+				keys, err := s.List(context.Background(), profileStoragePrefix)
+				require.NoError(t, err)
+				require.Empty(t, keys)
+			},
+		},
+		{
+			name: "repointed config uses the retained profile",
+			fn: func(t *testing.T) {
+				updateConfigSuccess(t, b, r, map[string]interface{}{"argo_cd_url": "argocd-2.wfecd.splunk.lol", "admin_token": "some-dummy-token-3"})
+				c, err := getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{
+					fldID:                "some-id",
+					fldConfigFingerprint: old.fingerprint(),
+				}))
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.EqualValues(old.ArgoCDUrl, c.ArgoCDUrl)
+				a.EqualValues("some-dummy-token-2", c.AdminToken)
+
+				// legacy leases use the config that was in place when the server was first replaced
+				c, err = getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{fldID: "some-id"}))
+				require.NoError(t, err)
+				a.EqualValues(old.ArgoCDUrl, c.ArgoCDUrl)
+				a.EqualValues("some-dummy-token-2", c.AdminToken)
+			},
+		},
+		{
+			name: "unknown server",
+			fn: func(t *testing.T) {
+				unknown := configEntry{ArgoCDUrl: "argocd-3.wfecd.splunk.lol"}
+				_, err := getLeaseConfig(context.Background(), leaseRequest(s, map[string]interface{}{
+					fldID:                "some-id",
+					cfgFldArgoCdUrl:      unknown.ArgoCDUrl,
+					fldConfigFingerprint: unknown.fingerprint(),
+				}))
+				require.ErrorContains(t, err, "argo cd server(argocd-3.wfecd.splunk.lol)")
+				require.ErrorContains(t, err, "no retained connection profile")
+			},
+		},
+		{
+			name: "instances of the same server retain their own profile",
+			fn: func(t *testing.T) {
+				ctx := context.Background()
+				server := "argocd-4.wfecd.splunk.lol"
+				i1 := configEntry{Instance: "i1", ArgoCDUrl: server, AdminToken: "some-dummy-token-i1"}
+				i2 := configEntry{Instance: "i2", ArgoCDUrl: server, AdminToken: "some-dummy-token-i2"}
+				next := configEntry{ArgoCDUrl: "argocd-5.wfecd.splunk.lol"}
+				require.NoError(t, retainProfile(ctx, s, &i1, &next, time.Now()))
+				require.NoError(t, retainProfile(ctx, s, &i2, &next, time.Now()))
+
+				for _, instance := range []configEntry{i1, i2} {
+					c, err := getLeaseConfig(ctx, leaseRequest(s, map[string]interface{}{
+						fldID:                "some-id",
+						fldInstance:          instance.Instance,
+						fldConfigFingerprint: instance.fingerprint(),
+					}))
+					require.NoError(t, err)
+					assert.EqualValues(t, instance.AdminToken, c.AdminToken)
+				}
+			},
+		},
+		{
+			name: "profiles retained before the instance keys are only used by their instance",
+			fn: func(t *testing.T) {
+				ctx := context.Background()
+				shared := configEntry{Instance: "i3", ArgoCDUrl: "argocd-6.wfecd.splunk.lol", AdminToken: "some-dummy-token-i3"}
+				require.NoError(t, saveToStorage[configEntry](ctx, s, profileStorageKey(shared.fingerprint()), &shared))
+
+				c, err := getLeaseConfig(ctx, leaseRequest(s, map[string]interface{}{
+					fldID:                "some-id",
+					fldInstance:          shared.Instance,
+					fldConfigFingerprint: shared.fingerprint(),
+				}))
+				require.NoError(t, err)
+				assert.EqualValues(t, shared.AdminToken, c.AdminToken)
+
+				_, err = getLeaseConfig(ctx, leaseRequest(s, map[string]interface{}{
+					fldID:                "some-id",
+					fldInstance:          "i4",
+					fldConfigFingerprint: shared.fingerprint(),
+				}))
+				require.ErrorContains(t, err, "no retained connection profile")
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
+func TestPruneProfiles(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	now := time.Now()
+	old := configEntry{Instance: "i1", ArgoCDUrl: "argocd-1.wfecd.splunk.lol", AdminToken: "some-dummy-token-1"}
+	next := configEntry{Instance: "i1", ArgoCDUrl: "argocd-2.wfecd.splunk.lol", AdminToken: "some-dummy-token-2"}
+	profileKey := profileStorageKey(profileId(old.Instance, old.fingerprint()))
+	legacyKey := legacyProfileStorageKey(old.Instance)
+	exists := func(t *testing.T, key string) bool {
+		profile, err := tryReadFromStorage[configEntry](ctx, s, key)
+		require.NoError(t, err)
+		return profile.ArgoCDUrl != ""
+	}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "kept until the max lease ttl",
+			fn: func(t *testing.T) {
+				require.NoError(t, retainProfile(ctx, s, &old, &next, now))
+				require.NoError(t, b.pruneProfiles(ctx, s, time.Hour, now.Add(30*time.Minute)))
+				assert.True(t, exists(t, profileKey))
+				assert.True(t, exists(t, legacyKey))
+			},
+		},
+		{
+			name: "kept while referenced",
+			fn: func(t *testing.T) {
+				token := issuedToken{Id: "vault-1", Instance: old.Instance, ConfigFingerprint: old.fingerprint()}
+				require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey(token.Id), &token))
+				rev := pendingRevocation{Id: "vault-2", LeaseData: map[string]interface{}{fldID: "vault-2", fldInstance: old.Instance}}
+				require.NoError(t, saveToStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey(rev.Id), &rev))
+
+				require.NoError(t, b.pruneProfiles(ctx, s, time.Hour, now.Add(2*time.Hour)))
+				assert.True(t, exists(t, profileKey))
+				assert.True(t, exists(t, legacyKey))
+			},
+		},
+		{
+			name: "deleted once unreferenced",
+			fn: func(t *testing.T) {
+				require.NoError(t, s.Delete(ctx, issuedTokenStorageKey("vault-1")))
+				require.NoError(t, s.Delete(ctx, pendingRevocationStorageKey("vault-2")))
+
+				require.NoError(t, b.pruneProfiles(ctx, s, time.Hour, now.Add(2*time.Hour)))
+				assert.False(t, exists(t, profileKey))
+				assert.False(t, exists(t, legacyKey))
+			},
+		},
+		{
+			name: "profiles without retention time",
+			fn: func(t *testing.T) {
+				require.NoError(t, saveToStorage[configEntry](ctx, s, profileKey, &old))
+				require.NoError(t, b.pruneProfiles(ctx, s, time.Hour, now))
+				profile, err := readFromStorage[retainedProfile](ctx, s, profileKey)
+				require.NoError(t, err)
+				assert.WithinDuration(t, now, profile.RetainedAt, 0)
+
+				require.NoError(t, b.pruneProfiles(ctx, s, time.Hour, now.Add(2*time.Hour)))
+				assert.False(t, exists(t, profileKey))
+			},
+		},
+		{
+			name: "profiles are seal wrapped",
+			fn: func(t *testing.T) {
+				assert.Contains(t, b.SpecialPaths().SealWrapStorage, profileStoragePrefix)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// reconcileGracePeriod skips the tokens issued recently, as a token is created in argo cd before it is recorded in the inventory
+	reconcileGracePeriod = 5 * time.Minute
+)
+
+// reconcileReport is the result of a reconciliation of the inventory with the tokens in argo cd.
+// Orphans are tokens with the id prefix of the mount in argo cd without inventory record, so without lease.
+// Ghosts are inventory records, so live leases, whose token is gone from argo cd
+type reconcileReport struct {
+	StartedAt      time.Time         `json:"started_at" structs:"started_at" mapstructure:"started_at"`
+	Duration       time.Duration     `json:"duration" structs:"duration" mapstructure:"duration"`
+	DeleteOrphans  bool              `json:"delete_orphans" structs:"delete_orphans" mapstructure:"delete_orphans"`
+	Orphans        []reconciledToken `json:"orphans" structs:"orphans" mapstructure:"orphans"`
+	Ghosts         []reconciledToken `json:"ghosts" structs:"ghosts" mapstructure:"ghosts"`
+	DeletedOrphans int               `json:"deleted_orphans" structs:"deleted_orphans" mapstructure:"deleted_orphans"`
+	Errors         []string          `json:"errors" structs:"errors" mapstructure:"errors"`
+}
+
+// reconciledToken is an orphan or a ghost token of a reconcile report
+type reconciledToken struct {
+	Id              string `json:"id" structs:"id" mapstructure:"id"`
+	AccountName     string `json:"account_name,omitempty" structs:"account_name" mapstructure:"account_name"`
+	ProjectName     string `json:"project_name,omitempty" structs:"project_name" mapstructure:"project_name"`
+	ProjectRoleName string `json:"project_role_name,omitempty" structs:"project_role_name" mapstructure:"project_role_name"`
+}
+
+func newReconcileReport(startedAt time.Time, deleteOrphans bool) reconcileReport {
+	return reconcileReport{
+		StartedAt:     startedAt,
+		DeleteOrphans: deleteOrphans,
+		Orphans:       []reconciledToken{},
+		Ghosts:        []reconciledToken{},
+		Errors:        []string{},
+	}
+}
+
+// reconcileTokens compares the inventory records of the instance with the tokens in argo cd, and deletes the orphans when deleteOrphans is set.
+// Only the tokens issued by the mount can be orphans, the admin token never is.
+// Accounts and projects that cannot be listed are reported as errors, their records are not reported as ghosts
+func (b *backend) reconcileTokens(
+	accountCtx *accountClientContext,
+	projectCtx *projectClientContext,
+	records []issuedToken,
+	adminTokenId string,
+	deleteOrphans bool,
+	now time.Time) reconcileReport {
+	report := newReconcileReport(now, deleteOrphans)
+	cutoff := now.Add(-reconcileGracePeriod)
+
+	recorded := make(map[string]bool, len(records))
+	for _, record := range records {
+		recorded[record.Id] = true
+	}
+	if adminTokenId != "" {
+		recorded[adminTokenId] = true
+	}
+	isOrphan := func(id string, issuedAt int64) bool {
+		return strings.HasPrefix(id, accountCtx.tokenIdPrefix) && !recorded[id] && time.Unix(issuedAt, 0).Before(cutoff)
+	}
+
+	found := map[string]bool{}
+	accountsListed, projectsListed := false, false
+
+	if accounts, err := accountCtx.ListAccounts(); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		accountsListed = true
+		for _, acc := range accounts {
+			for _, token := range acc.Tokens {
+				found[token.Id] = true
+				if !isOrphan(token.Id, token.IssuedAt) {
+					continue
+				}
+				report.Orphans = append(report.Orphans, reconciledToken{Id: token.Id, AccountName: acc.Name})
+				if !deleteOrphans {
+					continue
+				}
+				if err := accountCtx.DeleteToken(token.Id, acc.Name); err != nil && !isNotFound(err) {
+					report.Errors = append(report.Errors, fmt.Sprintf("token(%s) for account(%s): %s", token.Id, acc.Name, err))
+					continue
+				}
+				report.DeletedOrphans++
+			}
+		}
+	}
+
+	if projects, err := projectCtx.ListProjects(); err != nil {
+		report.Errors = append(report.Errors, err.Error())
+	} else {
+		projectsListed = true
+		for _, proj := range projects {
+			for _, role := range proj.Spec.Roles {
+				for _, token := range role.JWTTokens {
+					found[token.ID] = true
+					if !isOrphan(token.ID, token.IssuedAt) {
+						continue
+					}
+					report.Orphans = append(report.Orphans, reconciledToken{Id: token.ID, ProjectName: proj.Name, ProjectRoleName: role.Name})
+					if !deleteOrphans {
+						continue
+					}
+					if err := projectCtx.DeleteToken(token.ID, proj.Name, role.Name); err != nil {
+						report.Errors = append(report.Errors, fmt.Sprintf("token(%s) for project/role(%s/%s): %s", token.ID, proj.Name, role.Name, err))
+						continue
+					}
+					report.DeletedOrphans++
+				}
+			}
+		}
+	}
+
+	for _, record := range records {
+		listed := accountsListed
+		if record.AccountName == "" {
+			listed = projectsListed
+		}
+		if !listed || found[record.Id] || !record.IssuedAt.Before(cutoff) || (!record.ExpiresAt.IsZero() && now.After(record.ExpiresAt)) {
+			continue
+		}
+		report.Ghosts = append(report.Ghosts, reconciledToken{
+			Id:              record.Id,
+			AccountName:     record.AccountName,
+			ProjectName:     record.ProjectName,
+			ProjectRoleName: record.ProjectRoleName,
+		})
+	}
+	report.Duration = time.Since(now)
+
+	return report
+}
+
+// reconcile reconciles the inventory records of the instance with the tokens in argo cd, and records the report of the run
+func (b *backend) reconcile(
+	ctx context.Context,
+	storage logical.Storage,
+	instance string,
+	adminTokenId string,
+	accountCtx *accountClientContext,
+	projectCtx *projectClientContext,
+	deleteOrphans bool) (reconcileReport, error) {
+	tokens, err := listIssuedTokens(ctx, storage, issuedTokenFilters{})
+	if err != nil {
+		return reconcileReport{}, fmt.Errorf("error while listing the issued tokens: %s", err)
+	}
+
+	records := make([]issuedToken, 0, len(tokens))
+	for _, token := range tokens {
+		if token.Instance == instance {
+			records = append(records, token)
+		}
+	}
+
+	// the tokens of the static roles have no lease, they are not orphans
+	staticRecords, err := staticCredRecords(ctx, storage, instance)
+	if err != nil {
+		return reconcileReport{}, fmt.Errorf("error while listing the static roles: %s", err)
+	}
+	records = append(records, staticRecords...)
+
+	report := b.reconcileTokens(accountCtx, projectCtx, records, adminTokenId, deleteOrphans, time.Now())
+	if err := saveToStorage[reconcileReport](ctx, storage, reconcileStatusStorageKey(instance), &report); err != nil {
+		return report, fmt.Errorf("error while writing reconcile status to storage: %s", err)
+	}
+
+	b.logger.Info(fmt.Sprintf("reconcile of instance(%s) found %d orphans (%d deleted) and %d ghosts",
+		instance, len(report.Orphans), report.DeletedOrphans, len(report.Ghosts)))
+
+	return report, nil
+}
+
+// reconcileIfDue reconciles the instance once its interval has elapsed since the last run, the periodic runs only report the orphans.
+// The last runs are kept in memory, so the reconciliation also runs when the plugin starts
+func (b *backend) reconcileIfDue(ctx context.Context, req *logical.Request, config *configEntry) error {
+	if config.ReconcileInterval == 0 {
+		return nil
+	}
+
+	b.gcLock.Lock()
+	lastReconcile, ok := b.lastReconciles[config.Instance]
+	if ok && time.Since(lastReconcile) < config.ReconcileInterval {
+		b.gcLock.Unlock()
+		return nil
+	}
+	b.lastReconciles[config.Instance] = time.Now()
+	b.gcLock.Unlock()
+
+	accountCtx, err := NewAccountClient(ctx, b.clients, config)
+	if err != nil {
+		return fmt.Errorf("error while creating a new account client: %s", err)
+	}
+	defer closeClient(b, accountCtx.closer)
+
+	projectCtx, err := NewProjectClient(ctx, b.clients, config)
+	if err != nil {
+		return fmt.Errorf("error while creating a new project client: %s", err)
+	}
+	defer closeClient(b, projectCtx.closer)
+
+	_, err = b.reconcile(ctx, req.Storage, config.Instance, config.adminTokenId(), accountCtx, projectCtx, false)
+	return err
+}
@@ -0,0 +1,120 @@
+package plugin
+
+import (
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/argoproj/argo-cd/v2/pkg/apis/application/v1alpha1"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func getTestReconcileClients(now time.Time) (*testAccountClient, *testProjectClient) {
+	old := now.Add(-time.Hour).Unix()
+	recent := now.Add(-time.Minute).Unix()
+	accountClient := &testAccountClient{
+		accounts: []*account.Account{
+			{
+				Name: "a1",
+				Tokens: []*account.Token{
+					{Id: "vault-recorded", IssuedAt: old},
+					{Id: "vault-orphan", IssuedAt: old},
+					{Id: "vault-recent", IssuedAt: recent},
+					{Id: "manual", IssuedAt: old},
+				},
+			},
+		},
+	}
+	projectClient := &testProjectClient{
+		projects: []*v1alpha1.AppProject{
+			getTestProject("p1", v1alpha1.ProjectRole{
+				Name:      "r1",
+				JWTTokens: []v1alpha1.JWTToken{{ID: "vault-project-orphan", IssuedAt: old}},
+			}),
+		},
+	}
+
+	return accountClient, projectClient
+}
+
+func getTestReconcileRecords(now time.Time) []issuedToken {
+	return []issuedToken{
+		{Id: "vault-recorded", AccountName: "a1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{Id: "vault-ghost", AccountName: "a1", IssuedAt: now.Add(-time.Hour), ExpiresAt: now.Add(time.Hour)},
+		{Id: "vault-project-ghost", ProjectName: "p1", ProjectRoleName: "r1", IssuedAt: now.Add(-time.Hour)},
+		{Id: "vault-expired", AccountName: "a1", IssuedAt: now.Add(-2 * time.Hour), ExpiresAt: now.Add(-time.Hour)},
+		{Id: "vault-recent-record", AccountName: "a1", IssuedAt: now.Add(-time.Minute), ExpiresAt: now.Add(time.Hour)},
+	}
+}
+
+func TestReconcileTokens(t *testing.T) {
+	b, _ := getTestBackend(t)
+	now := time.Now()
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "report",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestReconcileClients(now)
+				report := b.reconcileTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), getTestReconcileRecords(now), "", false, now)
+				a := assert.New(t)
+				a.Equal([]reconciledToken{
+					{Id: "vault-orphan", AccountName: "a1"},
+					{Id: "vault-project-orphan", ProjectName: "p1", ProjectRoleName: "r1"},
+				}, report.Orphans)
+				a.Equal([]reconciledToken{
+					{Id: "vault-ghost", AccountName: "a1"},
+					{Id: "vault-project-ghost", ProjectName: "p1", ProjectRoleName: "r1"},
+				}, report.Ghosts)
+				a.Zero(report.DeletedOrphans)
+				a.Empty(accountClient.deleteTokenRequests)
+				a.Empty(projectClient.deleteTokenRequests)
+			},
+		},
+		{
+			name: "delete orphans",
+			fn: func(t *testing.T) {
+				accountClient, projectClient := getTestReconcileClients(now)
+				report := b.reconcileTokens(getTestAccountClientContext(accountClient), getTestProjectClientContext(projectClient), getTestReconcileRecords(now), "", true, now)
+				a := assert.New(t)
+				a.Equal(2, report.DeletedOrphans)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.Equal("vault-orphan", accountClient.deleteTokenRequests[0].Id)
+				require.Len(t, projectClient.deleteTokenRequests, 1)
+				a.Equal("vault-project-orphan", projectClient.deleteTokenRequests[0].Id)
+			},
+		},
+		{
+			name: "only the tokens of the mount are orphans",
+			fn: func(t *testing.T) {
+				old := now.Add(-time.Hour).Unix()
+				accountClient := &testAccountClient{
+					accounts: []*account.Account{
+						{
+							Name: "a1",
+							Tokens: []*account.Token{
+								{Id: "vault-1a2b3c4d-orphan", IssuedAt: old},
+								{Id: "vault-1a2b3c4d-admin", IssuedAt: old},
+								{Id: "vault-5e6f7a8b-other-mount", IssuedAt: old},
+								{Id: "vault-legacy", IssuedAt: old},
+							},
+						},
+					},
+				}
+				accountCtx := getTestAccountClientContext(accountClient)
+				accountCtx.tokenIdPrefix = "vault-1a2b3c4d-"
+				report := b.reconcileTokens(accountCtx, getTestProjectClientContext(&testProjectClient{}), nil, "vault-1a2b3c4d-admin", true, now)
+				a := assert.New(t)
+				a.Equal([]reconciledToken{{Id: "vault-1a2b3c4d-orphan", AccountName: "a1"}}, report.Orphans)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.Equal("vault-1a2b3c4d-orphan", accountClient.deleteTokenRequests[0].Id)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
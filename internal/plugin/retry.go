@@ -0,0 +1,106 @@
+package plugin
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultRetryMaxAttempts    = 4
+	defaultRetryInitialBackoff = 1 * time.Second
+	defaultRetryMaxBackoff     = 10 * time.Second
+	// cleanupTimeout bounds the cleanup done once the retries gave up, as it outlives the request
+	cleanupTimeout = 30 * time.Second
+	// k8sConflictMessage is reported when argo cd updates a resource that was modified concurrently
+	k8sConflictMessage = "the object has been modified"
+)
+
+// retryPolicy defines how the calls to argo cd are retried on transient errors
+type retryPolicy struct {
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+}
+
+// retryPolicy returns the retry policy of the config, with the defaults for configs written before it was configurable
+func (c *configEntry) retryPolicy() retryPolicy {
+	policy := retryPolicy{
+		maxAttempts:    c.RetryMaxAttempts,
+		initialBackoff: c.RetryInitialBackoff,
+		maxBackoff:     c.RetryMaxBackoff,
+	}
+	if policy.maxAttempts == 0 {
+		policy.maxAttempts = defaultRetryMaxAttempts
+	}
+	if policy.initialBackoff == 0 {
+		policy.initialBackoff = defaultRetryInitialBackoff
+	}
+	if policy.maxBackoff == 0 {
+		policy.maxBackoff = defaultRetryMaxBackoff
+	}
+
+	return policy
+}
+
+// isRetryable returns true for the errors that may succeed when the call is retried
+func isRetryable(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Aborted:
+		return true
+	default:
+		return strings.Contains(err.Error(), k8sConflictMessage)
+	}
+}
+
+// mayHaveSucceeded returns true if argo cd may have applied the failed call, as its response was lost or no longer awaited
+func mayHaveSucceeded(err error) bool {
+	return isRetryable(err) || status.Code(err) == codes.Canceled || errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)
+}
+
+// cleanupContext returns the context of the cleanup done once the retries gave up, it is not cancelled with the request
+func cleanupContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	return context.WithTimeout(context.WithoutCancel(ctx), cleanupTimeout)
+}
+
+// backoff returns the wait before the given retry: exponential up to the max backoff, with jitter in [backoff/2, backoff]
+func (p retryPolicy) backoff(retry int) time.Duration {
+	backoff := p.initialBackoff
+	for i := 0; i < retry && backoff < p.maxBackoff; i++ {
+		backoff *= 2
+	}
+	if backoff > p.maxBackoff {
+		backoff = p.maxBackoff
+	}
+	if backoff <= 1 {
+		return backoff
+	}
+
+	half := backoff / 2
+	return half + time.Duration(rand.Int63n(int64(backoff-half)+1))
+}
+
+// do calls fn until it succeeds, fails with an error that is not retryable or the max attempts are reached.
+// It stops waiting as soon as the context is cancelled
+func (p retryPolicy) do(ctx context.Context, fn func() error) error {
+	for retry := 0; ; retry++ {
+		err := fn()
+		if err == nil || !isRetryable(err) || retry+1 >= p.maxAttempts {
+			return err
+		}
+
+		timer := time.NewTimer(p.backoff(retry))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("%w, retry aborted: %w", err, ctx.Err())
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,142 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestIsRetryable(t *testing.T) {
+	a := assert.New(t)
+	a.True(isRetryable(status.Error(codes.Unavailable, "unavailable")))
+	a.True(isRetryable(status.Error(codes.DeadlineExceeded, "deadline exceeded")))
+	a.True(isRetryable(fmt.Errorf("wrapped: %w", status.Error(codes.Aborted, "aborted"))))
+	a.True(isRetryable(fmt.Errorf("Operation cannot be fulfilled on secrets \"argocd-secret\": the object has been modified")))
+	a.False(isRetryable(status.Error(codes.PermissionDenied, "permission denied")))
+	a.False(isRetryable(status.Error(codes.NotFound, "account does not exist")))
+	a.False(isRetryable(status.Error(codes.InvalidArgument, "invalid argument")))
+	a.False(isRetryable(fmt.Errorf("some error")))
+}
+
+func TestMayHaveSucceeded(t *testing.T) {
+	a := assert.New(t)
+	a.True(mayHaveSucceeded(status.Error(codes.Unavailable, "unavailable")))
+	a.True(mayHaveSucceeded(status.Error(codes.Canceled, "canceled")))
+	a.True(mayHaveSucceeded(fmt.Errorf("%w, retry aborted: %w", status.Error(codes.PermissionDenied, "permission denied"), context.DeadlineExceeded)))
+	a.False(mayHaveSucceeded(status.Error(codes.PermissionDenied, "permission denied")))
+	a.False(mayHaveSucceeded(status.Error(codes.NotFound, "account does not exist")))
+}
+
+func TestRetryPolicyBackoff(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 10, initialBackoff: time.Second, maxBackoff: 5 * time.Second}
+	a := assert.New(t)
+	for retry, backoff := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second, 5 * time.Second} {
+		d := policy.backoff(retry)
+		a.GreaterOrEqual(d, backoff/2)
+		a.LessOrEqual(d, backoff)
+	}
+}
+
+func TestRetryPolicyDefaults(t *testing.T) {
+	config := configEntry{}
+	a := assert.New(t)
+	a.EqualValues(retryPolicy{
+		maxAttempts:    defaultRetryMaxAttempts,
+		initialBackoff: defaultRetryInitialBackoff,
+		maxBackoff:     defaultRetryMaxBackoff,
+	}, config.retryPolicy())
+}
+
+func TestRetryPolicyDo(t *testing.T) {
+	policy := retryPolicy{maxAttempts: 3, initialBackoff: time.Millisecond, maxBackoff: time.Millisecond}
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "transient error is retried",
+			fn: func(t *testing.T) {
+				attempts := 0
+				err := policy.do(context.Background(), func() error {
+					attempts++
+					if attempts < 2 {
+						return status.Error(codes.Unavailable, "unavailable")
+					}
+					return nil
+				})
+				require.NoError(t, err)
+				assert.EqualValues(t, 2, attempts)
+			},
+		},
+		{
+			name: "max attempts",
+			fn: func(t *testing.T) {
+				attempts := 0
+				err := policy.do(context.Background(), func() error {
+					attempts++
+					return status.Error(codes.Unavailable, "unavailable")
+				})
+				require.ErrorContains(t, err, "unavailable")
+				assert.EqualValues(t, 3, attempts)
+			},
+		},
+		{
+			name: "permanent error is not retried",
+			fn: func(t *testing.T) {
+				attempts := 0
+				err := policy.do(context.Background(), func() error {
+					attempts++
+					return status.Error(codes.PermissionDenied, "permission denied")
+				})
+				require.ErrorContains(t, err, "permission denied")
+				assert.EqualValues(t, 1, attempts)
+			},
+		},
+		{
+			name: "cancelled context aborts the retries",
+			fn: func(t *testing.T) {
+				ctx, cancel := context.WithCancel(context.Background())
+				attempts := 0
+				slowPolicy := retryPolicy{maxAttempts: 3, initialBackoff: time.Hour, maxBackoff: time.Hour}
+				err := slowPolicy.do(ctx, func() error {
+					attempts++
+					cancel()
+					return status.Error(codes.Unavailable, "unavailable")
+				})
+				require.ErrorIs(t, err, context.Canceled)
+				assert.EqualValues(t, 1, attempts)
+			},
+		},
+		{
+			name: "generate token",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{
+					createTokenError: status.Error(codes.Unavailable, "unavailable"),
+					accounts:         []*account.Account{{Name: "some-account"}},
+				}
+				clientCtx := getTestAccountClientContext(&accountClient)
+				clientCtx.retryPolicy = policy
+				_, err := clientCtx.GenerateToken("some-account", time.Hour)
+				require.ErrorContains(t, err, "unavailable")
+				assert.Len(t, accountClient.createTokenRequests, 3)
+
+				projectClient := testProjectClient{createTokenError: status.Error(codes.NotFound, "project does not exist")}
+				projectCtx := getTestProjectClientContext(&projectClient)
+				projectCtx.retryPolicy = policy
+				_, err = projectCtx.GenerateToken("some-project", "some-role", time.Hour)
+				require.ErrorContains(t, err, "project does not exist")
+				assert.Len(t, projectClient.createTokenRequests, 1)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -12,6 +12,7 @@ func secretAccountToken(b *backend) *framework.Secret {
 		Type:   accountTokenSecretType,
 		Fields: map[string]*framework.FieldSchema{},
 		Revoke: b.deleteAccountTokenCallback,
+		Renew:  b.renewTokenCallback,
 	}
 }
 
@@ -20,45 +21,67 @@ func secretAccountToken(b *backend) *framework.Secret {
 // -- argo cd does not clear metadata from the k8s secret after the tokens expire
 // -- So the yaml manifest for the argocd-secret should be able to hold the metadata for all the tokens for all the accounts
 // -- If we don't clear expired tokens from the k8s secret, then the ephemeral token approach can make argo cd perform slower or bring it down completely
-// -- Calling this delete endpoint on a schedule or from the backend.PeriodicFunc would ensure that argocd-secret only keeps required tokens in the manifest
+// -- The token is removed from the inventory (path-tokens.go) once deleted
+// -- Failed deletions are queued and retried from backend.PeriodicFunc (path-revocations.go), so vault does not give up on them
+// -- The garbage collector (gc.go) also deletes the expired tokens from backend.PeriodicFunc, as a safety net when revocations were missed
+// -- The lease governed tokens (lease.go) have no expiry in argo cd and renewable leases, the garbage collector deletes them after the max ttl
 func (b *backend) deleteAccountTokenCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
-	accountName, err := getFromData[string](req.Secret.InternalData, fldAccountName)
+	id, err := getFromData[string](req.Secret.InternalData, fldID)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), err
 	}
 
-	id, err := getFromData[string](req.Secret.InternalData, fldID)
+	if err := b.revokeAccountToken(ctx, req, req.Secret.InternalData); err != nil {
+		return b.queueRevocation(ctx, req, accountTokenSecretType, id, err)
+	}
+
+	return nil, nil
+}
+
+// revokeAccountToken deletes the token of the lease from the argo cd server that issued it
+func (b *backend) revokeAccountToken(ctx context.Context, req *logical.Request, leaseData map[string]interface{}) error {
+	accountName, err := getFromData[string](leaseData, fldAccountName)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), err
+		return err
 	}
 
-	config, err := getConfig(ctx, req)
+	id, err := getFromData[string](leaseData, fldID)
+	if err != nil {
+		return err
+	}
+
+	config, err := getLeaseConfigFromData(ctx, req, leaseData)
 	if err != nil {
 		errMsg := fmt.Sprintf("error while reading config: %s", err)
 		b.logger.Error(errMsg)
-		return logical.ErrorResponse(errMsg), fmt.Errorf(errMsg)
+		return fmt.Errorf(errMsg)
 	}
 
-	clientCtx, err := NewAccountClient(ctx, &config)
+	clientCtx, err := NewAccountClient(ctx, b.clients, &config)
 	if err != nil {
 		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
 		b.logger.Error(errMsg)
-		return logical.ErrorResponse(errMsg), err
+		return err
+	}
+
+	if _, err := b.deleteAccountToken(clientCtx, id, accountName); err != nil {
+		return err
 	}
+	b.forgetIssuedToken(ctx, req.Storage, id)
 
-	return b.deleteAccountToken(clientCtx, id, accountName)
+	return nil
 }
 
 func (b *backend) deleteAccountToken(clientCtx *accountClientContext, id string, accountName string) (*logical.Response, error) {
-	if err := clientCtx.DeleteToken(id, accountName); err != nil {
+	defer closeClient(b, clientCtx.closer)
+
+	if err := clientCtx.DeleteToken(id, accountName); isNotFound(err) {
+		b.logger.Info(fmt.Sprintf("token(%s) for account(%s) is already deleted from argo cd: %s", id, accountName, err))
+		return nil, nil
+	} else if err != nil {
 		errMsg := fmt.Sprintf("error while deleting token(%s) for account(%s): %s", id, accountName, err)
 		b.logger.Error(errMsg)
-		return logical.ErrorResponse(errMsg), err
-	}
-
-	err := clientCtx.closer.Close()
-	if err != nil {
-		b.logger.Error(err.Error())
+		return argoCDErrorResponse(errMsg, err)
 	}
 
 	return nil, nil
@@ -6,6 +6,8 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"testing"
 )
 
@@ -53,6 +55,24 @@ func TestDeleteAccountToken(t *testing.T) {
 				require.ErrorContains(t, res.Error(), "token does not exist")
 			},
 		},
+		{
+			name: "not found is a success",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{DeleteTokenError: status.Error(codes.NotFound, "account does not exist")}
+				res, err := b.deleteAccountToken(getTestAccountClientContext(&accountClient), "some-id", "some-account")
+				require.NoError(t, err)
+				require.Nil(t, res)
+			},
+		},
+		{
+			name: "permission denied is a failure",
+			fn: func(t *testing.T) {
+				accountClient := testAccountClient{DeleteTokenError: status.Error(codes.PermissionDenied, "permission denied")}
+				res, err := b.deleteAccountToken(getTestAccountClientContext(&accountClient), "some-id", "some-account")
+				require.ErrorContains(t, err, "permission denied")
+				require.EqualValues(t, "permission_denied", res.Data[fldErrorCode])
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -12,6 +12,7 @@ func secretProjectToken(b *backend) *framework.Secret {
 		Type:   projectTokenSecretType,
 		Fields: map[string]*framework.FieldSchema{},
 		Revoke: b.deleteProjectTokenCallback,
+		Renew:  b.renewTokenCallback,
 	}
 }
 
@@ -20,50 +21,78 @@ func secretProjectToken(b *backend) *framework.Secret {
 // -- argo cd does not clear metadata from the appproj resource after the tokens expire
 // -- So the yaml manifest for the apprpoj should be able to hold the metadata for all the tokens for a given project
 // -- If we don't clear expired tokens from the apprpoj resource, then the ephemeral token approach can make argo cd perform slower or bring it down completely
-// -- Calling this delete endpoint on a schedule or from the backend.PeriodicFunc would ensure that appproj resource only keeps required tokens in the manifest
+// -- Failed deletions are queued and retried from backend.PeriodicFunc (path-revocations.go), so vault does not give up on them
+// -- The garbage collector (gc.go) also deletes the expired tokens from backend.PeriodicFunc, as a safety net when revocations were missed
+// -- The lease governed tokens (lease.go) have no expiry in argo cd and renewable leases, the garbage collector deletes them after the max ttl
+// -- The tokens of dynamic roles (dynamic-role.go) are deleted with their role
 func (b *backend) deleteProjectTokenCallback(ctx context.Context, req *logical.Request, data *framework.FieldData) (*logical.Response, error) {
 	id, err := getFromData[string](req.Secret.InternalData, fldID)
 	if err != nil {
 		return logical.ErrorResponse(err.Error()), err
 	}
 
-	projectName, err := getFromData[string](req.Secret.InternalData, fldProjectName)
+	if err := b.revokeProjectToken(ctx, req, req.Secret.InternalData); err != nil {
+		return b.queueRevocation(ctx, req, projectTokenSecretType, id, err)
+	}
+
+	return nil, nil
+}
+
+// revokeProjectToken deletes the token of the lease from the argo cd server that issued it
+func (b *backend) revokeProjectToken(ctx context.Context, req *logical.Request, leaseData map[string]interface{}) error {
+	id, err := getFromData[string](leaseData, fldID)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), err
+		return err
 	}
 
-	projectRoleName, err := getFromData[string](req.Secret.InternalData, fldProjectRoleName)
+	projectName, err := getFromData[string](leaseData, fldProjectName)
 	if err != nil {
-		return logical.ErrorResponse(err.Error()), err
+		return err
+	}
+
+	projectRoleName, err := getFromData[string](leaseData, fldProjectRoleName)
+	if err != nil {
+		return err
 	}
 
-	config, err := getConfig(ctx, req)
+	config, err := getLeaseConfigFromData(ctx, req, leaseData)
 	if err != nil {
 		errMsg := fmt.Sprintf("error while reading config: %s", err)
 		b.logger.Error(errMsg)
-		return logical.ErrorResponse(errMsg), fmt.Errorf(errMsg)
+		return fmt.Errorf(errMsg)
 	}
 
-	clientCtx, err := NewProjectClient(ctx, &config)
+	clientCtx, err := NewProjectClient(ctx, b.clients, &config)
 	if err != nil {
-		errMsg := fmt.Sprintf("error while creating a new account client: %s", err)
+		errMsg := fmt.Sprintf("error while creating a new project client: %s", err)
 		b.logger.Error(errMsg)
-		return logical.ErrorResponse(errMsg), err
+		return err
+	}
+
+	// the dynamic roles are created for a single lease, they are deleted with their token
+	if dynamicRole, _ := getFromData[bool](leaseData, fldDynamicRole); dynamicRole {
+		_, err = b.deleteDynamicRole(clientCtx, projectName, projectRoleName)
+	} else {
+		_, err = b.deleteProjectToken(clientCtx, id, projectName, projectRoleName)
+	}
+	if err != nil {
+		return err
 	}
+	b.forgetIssuedToken(ctx, req.Storage, id)
 
-	return b.deleteProjectToken(clientCtx, id, projectName, projectRoleName)
+	return nil
 }
 
 func (b *backend) deleteProjectToken(clientCtx *projectClientContext, id string, projectName string, projectRoleName string) (*logical.Response, error) {
-	if err := clientCtx.DeleteToken(id, projectName, projectRoleName); err != nil {
+	defer closeClient(b, clientCtx.closer)
+
+	if err := clientCtx.DeleteToken(id, projectName, projectRoleName); isNotFound(err) {
+		b.logger.Info(fmt.Sprintf("token(%s) for project/role(%s/%s) is already deleted from argo cd: %s", id, projectName, projectRoleName, err))
+		return nil, nil
+	} else if err != nil {
 		errMsg := fmt.Sprintf("error while deleting token(%s) for project/role(%s/%s): %s", id, projectName, projectRoleName, err)
 		b.logger.Error(errMsg)
-		return logical.ErrorResponse(errMsg), err
-	}
-
-	err := clientCtx.closer.Close()
-	if err != nil {
-		b.logger.Error(err.Error())
+		return argoCDErrorResponse(errMsg, err)
 	}
 
 	return nil, nil
@@ -6,6 +6,8 @@ import (
 	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 	"testing"
 )
 
@@ -53,6 +55,24 @@ func TestDeleteProjectToken(t *testing.T) {
 				require.ErrorContains(t, res.Error(), "token does not exist")
 			},
 		},
+		{
+			name: "not found is a success",
+			fn: func(t *testing.T) {
+				projectClient := testProjectClient{DeleteTokenError: status.Error(codes.NotFound, "project does not exist")}
+				res, err := b.deleteProjectToken(getTestProjectClientContext(&projectClient), "some-id", "some-project", "some-role")
+				require.NoError(t, err)
+				require.Nil(t, res)
+			},
+		},
+		{
+			name: "permission denied is a failure",
+			fn: func(t *testing.T) {
+				projectClient := testProjectClient{DeleteTokenError: status.Error(codes.PermissionDenied, "permission denied")}
+				res, err := b.deleteProjectToken(getTestProjectClientContext(&projectClient), "some-id", "some-project", "some-role")
+				require.ErrorContains(t, err, "permission denied")
+				require.EqualValues(t, "permission_denied", res.Data[fldErrorCode])
+			},
+		},
 	}
 
 	for _, test := range tests {
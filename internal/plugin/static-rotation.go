@@ -0,0 +1,212 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	// staticCredsStoragePrefix holds the tokens of the static roles, the prefix is seal wrapped
+	staticCredsStoragePrefix = "static-creds/"
+	staticTokenSecretType    = "static_account_token"
+)
+
+// staticCred is the current token of a static role, with the previous token kept until the end of its grace period
+type staticCred struct {
+	Id               string    `json:"id"`
+	Token            string    `json:"token"`
+	RotatedAt        time.Time `json:"rotated_at"`
+	PreviousId       string    `json:"previous_id"`
+	PreviousDeleteAt time.Time `json:"previous_delete_at"`
+}
+
+func staticCredStorageKey(name string) string {
+	return staticCredsStoragePrefix + name
+}
+
+// nextRotation returns the time the token of the static role is rotated
+func (cred *staticCred) nextRotation(role *staticRoleEntry) time.Time {
+	return cred.RotatedAt.Add(role.RotationPeriod)
+}
+
+// toResponse returns the current token with its rotation times, the ttl is the time left until the next rotation
+func (cred *staticCred) toResponse(role *staticRoleEntry, now time.Time) *logical.Response {
+	ttl := cred.nextRotation(role).Sub(now)
+	if ttl < 0 {
+		ttl = 0
+	}
+
+	return &logical.Response{
+		Data: map[string]interface{}{
+			fldID:             cred.Id,
+			fldInstance:       role.Instance,
+			fldAccountName:    role.AccountName,
+			fldToken:          cred.Token,
+			fldLastRotated:    cred.RotatedAt,
+			fldNextRotation:   cred.nextRotation(role),
+			fldRotationPeriod: role.RotationPeriod.String(),
+			fldTTL:            int64(ttl.Seconds()),
+		},
+	}
+}
+
+// rotateStaticRole deletes the previous token of the static role once its grace period is over, and rotates the current token when it is due.
+// The new token expires after the rotation and grace periods, so a token is left valid when the rotations fail
+func (b *backend) rotateStaticRole(
+	ctx context.Context,
+	storage logical.Storage,
+	clientCtx *accountClientContext,
+	role *staticRoleEntry,
+	now time.Time) (staticCred, error) {
+	defer closeClient(b, clientCtx.closer)
+
+	cred, err := tryReadFromStorage[staticCred](ctx, storage, staticCredStorageKey(role.Name))
+	if err != nil {
+		return cred, err
+	}
+
+	rotationDue := cred.Id == "" || !now.Before(cred.nextRotation(role))
+	if cred.PreviousId != "" && (rotationDue || !now.Before(cred.PreviousDeleteAt)) {
+		if err := clientCtx.DeleteToken(cred.PreviousId, role.AccountName); err != nil && !isNotFound(err) {
+			return cred, fmt.Errorf("error while deleting the previous token(%s) for account(%s): %w", cred.PreviousId, role.AccountName, err)
+		}
+		cred.PreviousId = ""
+		cred.PreviousDeleteAt = time.Time{}
+		if err := saveToStorage[staticCred](ctx, storage, staticCredStorageKey(role.Name), &cred); err != nil {
+			return cred, err
+		}
+	}
+
+	if !rotationDue {
+		return cred, nil
+	}
+
+	token, err := clientCtx.GenerateToken(role.AccountName, role.RotationPeriod+role.GracePeriod)
+	if err != nil {
+		return cred, err
+	}
+
+	if cred.Id != "" {
+		cred.PreviousId = cred.Id
+		cred.PreviousDeleteAt = now.Add(role.GracePeriod)
+	}
+	cred.Id = token.metadata.Id
+	cred.Token = token.token
+	cred.RotatedAt = now
+	if err := saveToStorage[staticCred](ctx, storage, staticCredStorageKey(role.Name), &cred); err != nil {
+		return cred, err
+	}
+
+	b.logger.Info(fmt.Sprintf("rotated the token of static role(%s) for account(%s)", role.Name, role.AccountName))
+
+	return cred, nil
+}
+
+// deleteStaticRoleTokens deletes the current and previous tokens of the static role from argo cd and from storage
+func (b *backend) deleteStaticRoleTokens(ctx context.Context, storage logical.Storage, clientCtx *accountClientContext, role *staticRoleEntry) error {
+	defer closeClient(b, clientCtx.closer)
+
+	cred, err := tryReadFromStorage[staticCred](ctx, storage, staticCredStorageKey(role.Name))
+	if err != nil {
+		return err
+	}
+
+	for _, id := range []string{cred.Id, cred.PreviousId} {
+		if id == "" {
+			continue
+		}
+		if err := clientCtx.DeleteToken(id, role.AccountName); err != nil && !isNotFound(err) {
+			return err
+		}
+	}
+
+	return storage.Delete(ctx, staticCredStorageKey(role.Name))
+}
+
+// rotateStaticRoles rotates the tokens of the static roles that are due, from the periodic func
+func (b *backend) rotateStaticRoles(ctx context.Context, req *logical.Request) error {
+	names, err := req.Storage.List(ctx, staticRoleStoragePrefix)
+	if err != nil {
+		return err
+	}
+
+	b.staticRolesLock.Lock()
+	defer b.staticRolesLock.Unlock()
+
+	for _, name := range names {
+		role, err := tryReadFromStorage[staticRoleEntry](ctx, req.Storage, staticRoleStorageKey(name))
+		if err != nil || role.Name == "" {
+			b.logger.Error(fmt.Sprintf("error while reading static role(%s) from storage: %s", name, err))
+			continue
+		}
+
+		config, err := getInstanceConfig(ctx, req, role.Instance)
+		if err != nil {
+			b.logger.Error(fmt.Sprintf("error while reading config of static role(%s): %s", name, err))
+			continue
+		}
+
+		clientCtx, err := NewAccountClient(ctx, b.clients, &config)
+		if err != nil {
+			b.logger.Error(fmt.Sprintf("error while creating a new account client for static role(%s): %s", name, err))
+			continue
+		}
+
+		if _, err := b.rotateStaticRole(ctx, req.Storage, clientCtx, &role, time.Now()); err != nil {
+			b.logger.Error(fmt.Sprintf("error while rotating the token of static role(%s): %s", name, err))
+		}
+	}
+
+	return nil
+}
+
+// staticCredRecords returns the tokens of the static roles of the instance as inventory records, so they are not reported as orphans
+func staticCredRecords(ctx context.Context, storage logical.Storage, instance string) ([]issuedToken, error) {
+	names, err := storage.List(ctx, staticRoleStoragePrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	records := []issuedToken{}
+	for _, name := range names {
+		role, err := tryReadFromStorage[staticRoleEntry](ctx, storage, staticRoleStorageKey(name))
+		if err != nil {
+			return nil, err
+		}
+		if role.Instance != instance {
+			continue
+		}
+
+		cred, err := tryReadFromStorage[staticCred](ctx, storage, staticCredStorageKey(name))
+		if err != nil {
+			return nil, err
+		}
+
+		if cred.Id != "" {
+			records = append(records, issuedToken{
+				Id:          cred.Id,
+				SecretType:  staticTokenSecretType,
+				Instance:    role.Instance,
+				AccountName: role.AccountName,
+				RoleName:    role.Name,
+				IssuedAt:    cred.RotatedAt,
+				ExpiresAt:   cred.RotatedAt.Add(role.RotationPeriod + role.GracePeriod),
+			})
+		}
+		if cred.PreviousId != "" {
+			records = append(records, issuedToken{
+				Id:          cred.PreviousId,
+				SecretType:  staticTokenSecretType,
+				Instance:    role.Instance,
+				AccountName: role.AccountName,
+				RoleName:    role.Name,
+				ExpiresAt:   cred.PreviousDeleteAt,
+			})
+		}
+	}
+
+	return records, nil
+}
@@ -0,0 +1,122 @@
+package plugin
+
+import (
+	"context"
+	"github.com/argoproj/argo-cd/v2/pkg/apiclient/account"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"testing"
+	"time"
+)
+
+func TestRotateStaticRole(t *testing.T) {
+	b, s := getTestBackend(t)
+	ctx := context.Background()
+	role := staticRoleEntry{Name: "s1", AccountName: "a1", RotationPeriod: 24 * time.Hour, GracePeriod: 1 * time.Hour}
+	now := time.Now()
+	var first, second staticCred
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "first token",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{createTokenResponse: &account.CreateTokenResponse{Token: "token-1"}}
+				cred, err := b.rotateStaticRole(ctx, s, getTestAccountClientContext(accountClient), &role, now)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.True(isPluginTokenId(cred.Id))
+				a.Equal("token-1", cred.Token)
+				a.Equal(now, cred.RotatedAt)
+				a.Empty(cred.PreviousId)
+				require.Len(t, accountClient.createTokenRequests, 1)
+				a.EqualValues(toDurationSeconds(25*time.Hour), accountClient.createTokenRequests[0].ExpiresIn)
+				first = cred
+			},
+		},
+		{
+			name: "not due",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{}
+				cred, err := b.rotateStaticRole(ctx, s, getTestAccountClientContext(accountClient), &role, now.Add(23*time.Hour))
+				require.NoError(t, err)
+				assert.Equal(t, first.Id, cred.Id)
+				assert.Empty(t, accountClient.createTokenRequests)
+			},
+		},
+		{
+			name: "rotation keeps the previous token for the grace period",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{createTokenResponse: &account.CreateTokenResponse{Token: "token-2"}}
+				rotatedAt := now.Add(24 * time.Hour)
+				cred, err := b.rotateStaticRole(ctx, s, getTestAccountClientContext(accountClient), &role, rotatedAt)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.NotEqual(first.Id, cred.Id)
+				a.Equal("token-2", cred.Token)
+				a.Equal(first.Id, cred.PreviousId)
+				a.Equal(rotatedAt.Add(time.Hour), cred.PreviousDeleteAt)
+				a.Empty(accountClient.deleteTokenRequests)
+				second = cred
+
+				stored, err := readFromStorage[staticCred](ctx, s, staticCredStorageKey(role.Name))
+				require.NoError(t, err)
+				a.Equal(cred.Id, stored.Id)
+			},
+		},
+		{
+			name: "previous token deleted after the grace period",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{DeleteTokenError: status.Error(codes.Unavailable, "unavailable")}
+				_, err := b.rotateStaticRole(ctx, s, getTestAccountClientContext(accountClient), &role, second.PreviousDeleteAt)
+				require.ErrorContains(t, err, "unavailable")
+
+				accountClient = &testAccountClient{}
+				cred, err := b.rotateStaticRole(ctx, s, getTestAccountClientContext(accountClient), &role, second.PreviousDeleteAt)
+				require.NoError(t, err)
+				a := assert.New(t)
+				a.Equal(second.Id, cred.Id)
+				a.Empty(cred.PreviousId)
+				require.Len(t, accountClient.deleteTokenRequests, 1)
+				a.Equal(first.Id, accountClient.deleteTokenRequests[0].Id)
+				a.Empty(accountClient.createTokenRequests)
+			},
+		},
+		{
+			name: "static tokens are not orphans",
+			fn: func(t *testing.T) {
+				require.NoError(t, saveToStorage[staticRoleEntry](ctx, s, staticRoleStorageKey(role.Name), &role))
+				records, err := staticCredRecords(ctx, s, "")
+				require.NoError(t, err)
+				require.Len(t, records, 1)
+				a := assert.New(t)
+				a.Equal(second.Id, records[0].Id)
+				a.Equal(staticTokenSecretType, records[0].SecretType)
+				a.Equal("s1", records[0].RoleName)
+
+				records, err = staticCredRecords(ctx, s, "other")
+				require.NoError(t, err)
+				a.Empty(records)
+			},
+		},
+		{
+			name: "delete the tokens",
+			fn: func(t *testing.T) {
+				accountClient := &testAccountClient{DeleteTokenError: status.Error(codes.NotFound, "token does not exist")}
+				require.NoError(t, b.deleteStaticRoleTokens(ctx, s, getTestAccountClientContext(accountClient), &role))
+				assert.Len(t, accountClient.deleteTokenRequests, 1)
+
+				cred, err := tryReadFromStorage[staticCred](ctx, s, staticCredStorageKey(role.Name))
+				require.NoError(t, err)
+				assert.Empty(t, cred.Id)
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
@@ -0,0 +1,134 @@
+package plugin
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/hashicorp/vault/sdk/logical"
+)
+
+const (
+	fldTokens    = "tokens"
+	fldIssuedAt  = "issued_at"
+	fldExpiresAt = "expires_at"
+	fldStatus    = "status"
+	// fldPluginIssued and fldExpired repeat the status, as foreign tokens can be expired as well.
+	// fldPluginIssued is set for the tokens issued by the mount
+	fldPluginIssued = "plugin_issued"
+	fldExpired      = "expired"
+	// tokenStatusLive is a token issued by the plugin whose lease is still live
+	tokenStatusLive = "live"
+	// tokenStatusExpired is a token issued by the plugin that expired, deleted by the garbage collector
+	tokenStatusExpired = "expired"
+	// tokenStatusRevoking is a token issued by the plugin whose lease was revoked, its deletion failed and is retried
+	tokenStatusRevoking = "revoking"
+	// tokenStatusForeign is a token that was not issued by the mount, including the tokens of the other mounts of the plugin
+	tokenStatusForeign = "foreign"
+
+	// tokenStatusUntracked is a token issued by the mount without a live lease recorded in the inventory,
+	// issued before the inventory existed or left behind by its lease
+	tokenStatusUntracked = "untracked"
+)
+
+// tokenRecords are the records the mount keeps of the tokens it issued, to tell the status of the tokens registered in argo cd
+type tokenRecords struct {
+	// idPrefix is the prefix of the ids of the tokens issued by the mount (mountTokenIdPrefix)
+	idPrefix string
+	// issued are the tokens of the inventory and of the static roles
+	issued map[string]bool
+	// pending are the tokens whose revocation is pending
+	pending map[string]bool
+}
+
+// isMountToken returns true if the token was issued by the mount: its id has the prefix of the mount,
+// or the mount recorded it, as the tokens issued before the ids were tagged with the mount
+func (records *tokenRecords) isMountToken(id string) bool {
+	return strings.HasPrefix(id, records.idPrefix) || records.issued[id] || records.pending[id]
+}
+
+// tokenStatus returns the status of a token registered in argo cd.
+// The lease of a token issued by the mount is live as long as its inventory record, unless its revocation is pending
+func tokenStatus(id string, expiresAt int64, records tokenRecords, now time.Time) string {
+	switch {
+	case !records.isMountToken(id):
+		return tokenStatusForeign
+	case records.pending[id]:
+		return tokenStatusRevoking
+	case isExpiredAt(expiresAt, now):
+		return tokenStatusExpired
+	case !records.issued[id]:
+		return tokenStatusUntracked
+	default:
+		return tokenStatusLive
+	}
+}
+
+// tokenInfo returns the response data of a token registered in argo cd, times are zero when not set
+func tokenInfo(id string, issuedAt int64, expiresAt int64, records tokenRecords, now time.Time) map[string]interface{} {
+	return map[string]interface{}{
+		fldID:           id,
+		fldIssuedAt:     unixTime(issuedAt),
+		fldExpiresAt:    unixTime(expiresAt),
+		fldStatus:       tokenStatus(id, expiresAt, records, now),
+		fldPluginIssued: records.isMountToken(id),
+		fldExpired:      isExpiredAt(expiresAt, now),
+	}
+}
+
+// isExpiredAt returns true if the token expired at the given time. Tokens without expiry never expire
+func isExpiredAt(expiresAt int64, now time.Time) bool {
+	return expiresAt > 0 && !now.Before(time.Unix(expiresAt, 0))
+}
+
+func unixTime(seconds int64) time.Time {
+	if seconds == 0 {
+		return time.Time{}
+	}
+
+	return time.Unix(seconds, 0).UTC()
+}
+
+// pendingRevocationIds returns the ids of the tokens whose revocation is pending
+func pendingRevocationIds(ctx context.Context, storage logical.Storage) (map[string]bool, error) {
+	ids, err := storage.List(ctx, pendingRevocationsStoragePrefix)
+	if err != nil {
+		return nil, fmt.Errorf("error while listing the pending revocations: %w", err)
+	}
+
+	pending := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		pending[id] = true
+	}
+
+	return pending, nil
+}
+
+// readTokenRecords returns the records of the tokens issued by the mount for the instance, idPrefix is the id prefix of the mount
+func readTokenRecords(ctx context.Context, storage logical.Storage, instance string, idPrefix string) (tokenRecords, error) {
+	pending, err := pendingRevocationIds(ctx, storage)
+	if err != nil {
+		return tokenRecords{}, err
+	}
+
+	ids, err := storage.List(ctx, issuedTokensStoragePrefix)
+	if err != nil {
+		return tokenRecords{}, fmt.Errorf("error while listing the issued tokens: %w", err)
+	}
+
+	issued := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		issued[id] = true
+	}
+
+	static, err := staticCredRecords(ctx, storage, instance)
+	if err != nil {
+		return tokenRecords{}, fmt.Errorf("error while reading the static roles: %w", err)
+	}
+	for _, record := range static {
+		issued[record.Id] = true
+	}
+
+	return tokenRecords{idPrefix: idPrefix, issued: issued, pending: pending}, nil
+}
@@ -0,0 +1,70 @@
+package plugin
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+	"time"
+)
+
+func TestTokenStatus(t *testing.T) {
+	now := time.Now()
+	records := tokenRecords{
+		idPrefix: "vault-0a1b2c3d-",
+		issued:   map[string]bool{"vault-0a1b2c3d-live": true, "vault-0a1b2c3d-expired": true, "vault-0a1b2c3d-pending": true, "vault-recorded": true},
+		pending:  map[string]bool{"vault-0a1b2c3d-pending": true},
+	}
+	tests := []struct {
+		name      string
+		id        string
+		expiresAt int64
+		expected  string
+	}{
+		{name: "live", id: "vault-0a1b2c3d-live", expiresAt: now.Add(time.Hour).Unix(), expected: tokenStatusLive},
+		{name: "without expiry", id: "vault-0a1b2c3d-live", expiresAt: 0, expected: tokenStatusLive},
+		{name: "expired", id: "vault-0a1b2c3d-expired", expiresAt: now.Add(-time.Hour).Unix(), expected: tokenStatusExpired},
+		{name: "revoking", id: "vault-0a1b2c3d-pending", expiresAt: now.Add(time.Hour).Unix(), expected: tokenStatusRevoking},
+		{name: "untracked", id: "vault-0a1b2c3d-untracked", expiresAt: now.Add(time.Hour).Unix(), expected: tokenStatusUntracked},
+		{name: "untracked expired", id: "vault-0a1b2c3d-untracked", expiresAt: now.Add(-time.Hour).Unix(), expected: tokenStatusExpired},
+		{name: "recorded before the mount tag", id: "vault-recorded", expiresAt: now.Add(time.Hour).Unix(), expected: tokenStatusLive},
+		{name: "other mount", id: "vault-9f8e7d6c-other", expiresAt: now.Add(time.Hour).Unix(), expected: tokenStatusForeign},
+		{name: "foreign", id: "manual", expiresAt: now.Add(time.Hour).Unix(), expected: tokenStatusForeign},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, tokenStatus(test.id, test.expiresAt, records, now))
+		})
+	}
+}
+
+func TestPendingRevocationIds(t *testing.T) {
+	_, s := getTestBackend(t)
+	ctx := context.Background()
+	require.NoError(t, saveToStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey("vault-1"), &pendingRevocation{Id: "vault-1"}))
+
+	pending, err := pendingRevocationIds(ctx, s)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"vault-1": true}, pending)
+}
+
+func TestReadTokenRecords(t *testing.T) {
+	_, s := getTestBackend(t)
+	ctx := context.Background()
+	require.NoError(t, saveToStorage[issuedToken](ctx, s, issuedTokenStorageKey("vault-1"), &issuedToken{Id: "vault-1"}))
+	require.NoError(t, saveToStorage[pendingRevocation](ctx, s, pendingRevocationStorageKey("vault-2"), &pendingRevocation{Id: "vault-2"}))
+	require.NoError(t, saveToStorage[staticRoleEntry](ctx, s, staticRoleStorageKey("s1"), &staticRoleEntry{Name: "s1", AccountName: "a1"}))
+	require.NoError(t, saveToStorage[staticCred](ctx, s, staticCredStorageKey("s1"), &staticCred{Id: "vault-3", RotatedAt: time.Now()}))
+
+	records, err := readTokenRecords(ctx, s, "", "vault-0a1b2c3d-")
+	require.NoError(t, err)
+	a := assert.New(t)
+	a.Equal("vault-0a1b2c3d-", records.idPrefix)
+	a.Equal(map[string]bool{"vault-1": true, "vault-3": true}, records.issued)
+	a.Equal(map[string]bool{"vault-2": true}, records.pending)
+
+	records, err = readTokenRecords(ctx, s, "other", "vault-0a1b2c3d-")
+	require.NoError(t, err)
+	a.Equal(map[string]bool{"vault-1": true}, records.issued)
+}
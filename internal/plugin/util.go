@@ -3,6 +3,7 @@ package plugin
 import (
 	"fmt"
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
 	"reflect"
 	"strings"
 	"time"
@@ -27,8 +28,14 @@ func getFromFieldData[T interface{}](data *framework.FieldData, attr string) (va
 }
 
 func getTTLFromFieldData(data *framework.FieldData, attr string, defaultTTL time.Duration, maxTTL time.Duration) time.Duration {
+	ttl, _ := getCappedTTLFromFieldData(data, attr, defaultTTL, maxTTL)
+	return ttl
+}
+
+// getCappedTTLFromFieldData returns the ttl from the field data, or the default ttl if not present, capped by maxTTL.
+// capped is true when the requested ttl was capped
+func getCappedTTLFromFieldData(data *framework.FieldData, attr string, defaultTTL time.Duration, maxTTL time.Duration) (ttl time.Duration, capped bool) {
 	ttlSeconds, err := getFromFieldData[int](data, attr)
-	var ttl time.Duration
 	if err != nil {
 		ttl = defaultTTL
 	} else {
@@ -36,10 +43,26 @@ func getTTLFromFieldData(data *framework.FieldData, attr string, defaultTTL time
 	}
 
 	if ttl > maxTTL {
-		ttl = maxTTL
+		return maxTTL, err == nil
 	}
 
-	return ttl
+	return ttl, false
+}
+
+// appendCappedTTLWarning appends a warning when the requested ttl was capped by the max ttl
+func appendCappedTTLWarning(warnings []string, attr string, capped bool, ttl time.Duration) []string {
+	if !capped {
+		return warnings
+	}
+
+	return append(warnings, fmt.Sprintf("requested %s was capped to the max ttl(%s)", attr, ttl))
+}
+
+// addCappedTTLWarning adds a warning to the response when the requested ttl was capped by the max ttl
+func addCappedTTLWarning(response *logical.Response, attr string, capped bool, ttl time.Duration) {
+	for _, warning := range appendCappedTTLWarning(nil, attr, capped, ttl) {
+		response.AddWarning(warning)
+	}
 }
 
 func getFromData[T interface{}](data map[string]interface{}, attr string) (value T, _ error) {
@@ -56,6 +79,17 @@ func getFromData[T interface{}](data map[string]interface{}, attr string) (value
 	return value, nil
 }
 
+// getInstanceFromData returns the instance from the secret internal data.
+// Leases created before named instances were supported have no instance and belong to the default instance
+func getInstanceFromData(data map[string]interface{}) string {
+	instance, err := getFromData[string](data, fldInstance)
+	if err != nil {
+		return ""
+	}
+
+	return instance
+}
+
 func toDurationSeconds(d time.Duration) int64 {
 	return int64(d / time.Second)
 }
@@ -63,6 +97,7 @@ func toDurationSeconds(d time.Duration) int64 {
 func (token *projectToken) toResponseData() map[string]interface{} {
 	return map[string]interface{}{
 		fldID:              token.metadata.Id,
+		fldInstance:        token.metadata.Instance,
 		fldProjectName:     token.metadata.ProjectName,
 		fldProjectRoleName: token.metadata.RoleName,
 		fldToken:           token.token,
@@ -72,6 +107,7 @@ func (token *projectToken) toResponseData() map[string]interface{} {
 func (token *accountToken) toResponseData() map[string]interface{} {
 	return map[string]interface{}{
 		fldID:          token.metadata.Id,
+		fldInstance:    token.metadata.Instance,
 		fldAccountName: token.metadata.AccountName,
 		fldToken:       token.token,
 	}
@@ -79,16 +115,22 @@ func (token *accountToken) toResponseData() map[string]interface{} {
 
 func (token *accountToken) toLeaseData() map[string]interface{} {
 	return map[string]interface{}{
-		fldID:          token.metadata.Id,
-		fldAccountName: token.metadata.AccountName,
+		fldID:                token.metadata.Id,
+		fldInstance:          token.metadata.Instance,
+		cfgFldArgoCdUrl:      token.metadata.ServerAddr,
+		fldConfigFingerprint: token.metadata.Fingerprint,
+		fldAccountName:       token.metadata.AccountName,
 	}
 }
 
 func (token *projectToken) toLeaseData() map[string]interface{} {
 	return map[string]interface{}{
-		fldID:              token.metadata.Id,
-		fldProjectName:     token.metadata.ProjectName,
-		fldProjectRoleName: token.metadata.RoleName,
+		fldID:                token.metadata.Id,
+		fldInstance:          token.metadata.Instance,
+		cfgFldArgoCdUrl:      token.metadata.ServerAddr,
+		fldConfigFingerprint: token.metadata.Fingerprint,
+		fldProjectName:       token.metadata.ProjectName,
+		fldProjectRoleName:   token.metadata.RoleName,
 	}
 }
 
@@ -2,6 +2,7 @@ package plugin
 
 import (
 	"github.com/hashicorp/vault/sdk/framework"
+	"github.com/hashicorp/vault/sdk/logical"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 	"testing"
@@ -160,6 +161,32 @@ func TestGetTTLFromFieldData(t *testing.T) {
 				a.EqualValues(1*time.Hour, ttl)
 			},
 		},
+		{
+			name: "capped TTL warning",
+			fn: func(t *testing.T) {
+				data := &framework.FieldData{
+					Raw: map[string]interface{}{
+						fldTTL: "5h",
+					},
+					Schema: getProjectTokenSchema,
+				}
+				a := assert.New(t)
+
+				ttl, capped := getCappedTTLFromFieldData(data, fldTTL, 1*time.Hour, 3*time.Hour)
+				a.EqualValues(3*time.Hour, ttl)
+				a.True(capped)
+
+				response := &logical.Response{}
+				addCappedTTLWarning(response, fldTTL, capped, ttl)
+				a.EqualValues([]string{"requested ttl was capped to the max ttl(3h0m0s)"}, response.Warnings)
+
+				// a default above the max ttl is not a requested ttl
+				data.Raw = map[string]interface{}{}
+				ttl, capped = getCappedTTLFromFieldData(data, fldTTL, 4*time.Hour, 3*time.Hour)
+				a.EqualValues(3*time.Hour, ttl)
+				a.False(capped)
+			},
+		},
 	}
 
 	for _, test := range tests {
@@ -270,6 +297,38 @@ func TestGetFromData(t *testing.T) {
 	}
 }
 
+func TestGetInstanceFromData(t *testing.T) {
+	tests := []struct {
+		name string
+		fn   func(t *testing.T)
+	}{
+		{
+			name: "named instance",
+			fn: func(t *testing.T) {
+				data := map[string]interface{}{
+					fldInstance: "i1",
+				}
+				a := assert.New(t)
+				a.EqualValues("i1", getInstanceFromData(data))
+			},
+		},
+		{
+			name: "lease without instance belongs to the default instance",
+			fn: func(t *testing.T) {
+				data := map[string]interface{}{
+					fldID: "some-id",
+				}
+				a := assert.New(t)
+				a.EqualValues("", getInstanceFromData(data))
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, test.fn)
+	}
+}
+
 func TestToDurationSeconds(t *testing.T) {
 	tests := []struct {
 		name string
@@ -313,6 +372,9 @@ func TestTokensUtils(t *testing.T) {
 				token := &projectToken{
 					metadata: projectTokenMetadata{
 						Id:          "some-id",
+						Instance:    "some-instance",
+						ServerAddr:  "argocd.wfecd.splunk.lol",
+						Fingerprint: "some-fingerprint",
 						ProjectName: "p1",
 						RoleName:    "r1",
 						TTL:         1 * time.Hour,
@@ -320,9 +382,12 @@ func TestTokensUtils(t *testing.T) {
 					token: "some-token",
 				}
 				expected := map[string]interface{}{
-					fldID:              "some-id",
-					fldProjectName:     "p1",
-					fldProjectRoleName: "r1",
+					fldID:                "some-id",
+					fldInstance:          "some-instance",
+					cfgFldArgoCdUrl:      "argocd.wfecd.splunk.lol",
+					fldConfigFingerprint: "some-fingerprint",
+					fldProjectName:       "p1",
+					fldProjectRoleName:   "r1",
 				}
 				actual := token.toLeaseData()
 				a := assert.New(t)
@@ -335,6 +400,9 @@ func TestTokensUtils(t *testing.T) {
 				token := &projectToken{
 					metadata: projectTokenMetadata{
 						Id:          "some-id",
+						Instance:    "some-instance",
+						ServerAddr:  "argocd.wfecd.splunk.lol",
+						Fingerprint: "some-fingerprint",
 						ProjectName: "p1",
 						RoleName:    "r1",
 						TTL:         1 * time.Hour,
@@ -343,6 +411,7 @@ func TestTokensUtils(t *testing.T) {
 				}
 				expected := map[string]interface{}{
 					fldID:              "some-id",
+					fldInstance:        "some-instance",
 					fldToken:           "some-token",
 					fldProjectName:     "p1",
 					fldProjectRoleName: "r1",
@@ -358,14 +427,20 @@ func TestTokensUtils(t *testing.T) {
 				token := &accountToken{
 					metadata: accountTokenMetadata{
 						Id:          "some-id",
+						Instance:    "some-instance",
+						ServerAddr:  "argocd.wfecd.splunk.lol",
+						Fingerprint: "some-fingerprint",
 						AccountName: "a1",
 						TTL:         1 * time.Hour,
 					},
 					token: "some-token",
 				}
 				expected := map[string]interface{}{
-					fldID:          "some-id",
-					fldAccountName: "a1",
+					fldID:                "some-id",
+					fldInstance:          "some-instance",
+					cfgFldArgoCdUrl:      "argocd.wfecd.splunk.lol",
+					fldConfigFingerprint: "some-fingerprint",
+					fldAccountName:       "a1",
 				}
 				actual := token.toLeaseData()
 				a := assert.New(t)
@@ -378,6 +453,9 @@ func TestTokensUtils(t *testing.T) {
 				token := &accountToken{
 					metadata: accountTokenMetadata{
 						Id:          "some-id",
+						Instance:    "some-instance",
+						ServerAddr:  "argocd.wfecd.splunk.lol",
+						Fingerprint: "some-fingerprint",
 						AccountName: "a1",
 						TTL:         1 * time.Hour,
 					},
@@ -385,6 +463,7 @@ func TestTokensUtils(t *testing.T) {
 				}
 				expected := map[string]interface{}{
 					fldID:          "some-id",
+					fldInstance:    "some-instance",
 					fldToken:       "some-token",
 					fldAccountName: "a1",
 				}